@@ -0,0 +1,344 @@
+package mserve
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"reflect"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/DarlingGoose/credentials/session"
+)
+
+// AdminConfig configures the internal admin router mounted by SetupAdmin.
+type AdminConfig struct {
+	// Prefix all admin routes are mounted under, defaults to "/_admin"
+	Prefix string
+	// Role required to access the admin routes, defaults to "admin"
+	Role string
+	// Configs are the effective config structs (as returned by LoadConfig)
+	// exposed on {Prefix}/config, keyed by a display name.
+	Configs map[string]interface{}
+	// DisablePprof skips mounting net/http/pprof under {Prefix}/debug/pprof/
+	DisablePprof bool
+}
+
+// RouteInfo describes a single registered endpoint for the admin route table.
+type RouteInfo struct {
+	Name       string   `json:"name"`
+	Path       string   `json:"path"`
+	Methods    []string `json:"methods"`
+	Prefix     bool     `json:"prefix"`
+	Internal   bool     `json:"internal"`
+	Resource   string   `json:"resource"`
+	Roles      []Role   `json:"roles"`
+	Scope      string   `json:"scope,omitempty"`
+	Middleware []string `json:"middleware"`
+}
+
+// RuntimeInfo is the payload of the admin runtime endpoint.
+type RuntimeInfo struct {
+	Service    string            `json:"service"`
+	Version    string            `json:"version"`
+	StartedAt  time.Time         `json:"started_at"`
+	Uptime     string            `json:"uptime"`
+	GoVersion  string            `json:"go_version"`
+	Goroutines int               `json:"goroutines"`
+	HeapAlloc  uint64            `json:"heap_alloc"`
+	HeapSys    uint64            `json:"heap_sys"`
+	NumGC      uint32            `json:"num_gc"`
+	Cache      CacheStats        `json:"cache"`
+	Build      map[string]string `json:"build"`
+}
+
+// CacheStats reports the state of the server's access cache.
+type CacheStats struct {
+	Items int `json:"items"`
+}
+
+// FlagUpdateRequest is the body of the admin flag toggle endpoint.
+type FlagUpdateRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+const redacted = "****"
+
+// secretFieldPattern matches config field names that hold credentials.
+var secretFieldPattern = regexp.MustCompile(`(?i)(secret|password|passwd|token|api[-_]?key|private[-_]?key|credential)`)
+
+// SetupAdmin mounts the internal admin router exposing the route table,
+// effective config, runtime state and pprof. Every admin route requires cfg.Role.
+func (s *Server) SetupAdmin(ctx context.Context, cfg AdminConfig) *Server {
+	if cfg.Prefix == "" {
+		cfg.Prefix = "/_admin"
+	}
+	cfg.Prefix = "/" + strings.Trim(cfg.Prefix, "/")
+	if cfg.Role == "" {
+		cfg.Role = "admin"
+	}
+	s.adminPrefix = cfg.Prefix
+	err := s.AddEndpoints(ctx, makeAdminEndpoints(s, cfg)...)
+	if err != nil {
+		slog.Error("failed adding admin endpoints", "err", err)
+	}
+	return s
+}
+
+// Routes returns the route table for every registered endpoint.
+func (s *Server) Routes() []RouteInfo {
+	routes := make([]RouteInfo, 0, len(s.endpoints))
+	for _, e := range s.endpoints {
+		routes = append(routes, RouteInfo{
+			Name:       e.Name,
+			Path:       e.Path,
+			Methods:    e.Methods,
+			Prefix:     e.Prefix,
+			Internal:   e.Internal,
+			Resource:   endpointResourceName(s.ServiceName, e.Path),
+			Roles:      e.Roles,
+			Scope:      e.Scope,
+			Middleware: append(append([]string{}, s.middlewares...), e.middleware...),
+		})
+	}
+	return routes
+}
+
+// RuntimeInfo returns the current runtime state of the server.
+func (s *Server) RuntimeInfo() RuntimeInfo {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	info := RuntimeInfo{
+		Service:    s.ServiceName,
+		Version:    s.Version,
+		StartedAt:  s.startedAt,
+		Uptime:     time.Since(s.startedAt).Round(time.Second).String(),
+		GoVersion:  runtime.Version(),
+		Goroutines: runtime.NumGoroutine(),
+		HeapAlloc:  mem.HeapAlloc,
+		HeapSys:    mem.HeapSys,
+		NumGC:      mem.NumGC,
+		Cache:      CacheStats{Items: s.goCache.ItemCount()},
+		Build:      map[string]string{},
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info.Build["path"] = bi.Path
+		info.Build["module"] = bi.Main.Path
+		info.Build["module_version"] = bi.Main.Version
+		for _, setting := range bi.Settings {
+			if strings.HasPrefix(setting.Key, "vcs.") {
+				info.Build[setting.Key] = setting.Value
+			}
+		}
+	}
+	return info
+}
+
+// RedactConfig flattens a config struct (as used by BindFlags/LoadConfig) into
+// a map keyed by flag name, replacing credential-like values with "****".
+// Fields can be forced to redact with a `redact:"true"` tag.
+func RedactConfig(prefixPath string, cfg interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+	rv := reflect.ValueOf(cfg)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return out
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return out
+	}
+	rt := rv.Type()
+	prefix := ToKebabCase(prefixPath + rt.Name())
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Tag.Get("flag")
+		if name == "" {
+			name = ToKebabCase(field.Name)
+		}
+		if prefix != "" {
+			name = prefix + "-" + name
+		}
+		fv := rv.Field(i)
+		if field.Tag.Get("redact") == "true" || secretFieldPattern.MatchString(field.Name) || secretFieldPattern.MatchString(name) {
+			if !fv.IsZero() {
+				out[name] = redacted
+			} else {
+				out[name] = ""
+			}
+			continue
+		}
+		out[name] = fv.Interface()
+	}
+	return out
+}
+
+// requireAccess wraps next so it is only served when the session user has access
+// to the resource for path, using the same RBAC check as SetupOServer.
+func (s *Server) requireAccess(path string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.rbac == nil || s.sessionClient == nil {
+			WriteError(w, r, http.StatusForbidden, "admin access is not configured")
+			return
+		}
+		usersession, ctx, err := s.authenticate(w, r)
+		if err != nil || usersession == nil {
+			WriteError(w, r, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		if !s.hasAccess(ctx, endpointResourceName(s.ServiceName, path), usersession.UserID, usersession.AccountID, r.Method) {
+			WriteError(w, r, http.StatusForbidden, "forbidden "+path)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
+
+func makeAdminEndpoints(s *Server, cfg AdminConfig) []*Endpoint {
+	roles := []Role{{Role: cfg.Role}}
+	middleware := []string{"mserve.(*Server).requireAccess"}
+
+	endpoints := []*Endpoint{
+		{
+			Name:        "Admin Routes",
+			Description: "List every registered route with its RBAC resource, roles and middleware",
+			Methods:     []string{http.MethodGet},
+			Path:        cfg.Prefix + "/routes",
+			Internal:    true,
+			Responses: []Response{
+				{Status: http.StatusOK, Body: []RouteInfo{}},
+				{Status: http.StatusForbidden},
+			},
+			Roles: roles,
+		},
+		{
+			Name:        "Admin Config",
+			Description: "Effective configuration with secrets redacted",
+			Methods:     []string{http.MethodGet},
+			Path:        cfg.Prefix + "/config",
+			Internal:    true,
+			Responses: []Response{
+				{Status: http.StatusOK, Body: map[string]interface{}{}},
+				{Status: http.StatusForbidden},
+			},
+			Roles: roles,
+		},
+		{
+			Name:        "Admin Runtime",
+			Description: "Runtime state, cache stats and build info",
+			Methods:     []string{http.MethodGet},
+			Path:        cfg.Prefix + "/runtime",
+			Internal:    true,
+			Responses: []Response{
+				{Status: http.StatusOK, Body: RuntimeInfo{}},
+				{Status: http.StatusForbidden},
+			},
+			Roles: roles,
+		},
+		{
+			Name:        "Admin Flags",
+			Description: "List feature flags, including read_only and maintenance",
+			Methods:     []string{http.MethodGet},
+			Path:        cfg.Prefix + "/flags",
+			Internal:    true,
+			Responses: []Response{
+				{Status: http.StatusOK, Body: []FeatureFlag{}},
+				{Status: http.StatusForbidden},
+			},
+			Roles: roles,
+		},
+		{
+			Name:        "Admin Set Flag",
+			Description: "Enable or disable a feature flag, recording who changed it",
+			Methods:     []string{http.MethodPut},
+			Path:        cfg.Prefix + "/flags/{name}",
+			Internal:    true,
+			Request: Request{
+				Params: map[string]ROption{"name": {Required: true}},
+				Body:   FlagUpdateRequest{},
+			},
+			Responses: []Response{
+				{Status: http.StatusOK, Body: FeatureFlag{}},
+				{Status: http.StatusBadRequest},
+				{Status: http.StatusForbidden},
+			},
+			Roles: roles,
+		},
+	}
+	endpoints[0].Handler = func(w http.ResponseWriter, r *http.Request) {
+		WriteBody(w, r, s.Routes())
+	}
+	endpoints[1].Handler = func(w http.ResponseWriter, r *http.Request) {
+		out := map[string]interface{}{}
+		for name, c := range cfg.Configs {
+			out[name] = RedactConfig("", c)
+		}
+		WriteBody(w, r, out)
+	}
+	endpoints[2].Handler = func(w http.ResponseWriter, r *http.Request) {
+		WriteBody(w, r, s.RuntimeInfo())
+	}
+	endpoints[3].Handler = func(w http.ResponseWriter, r *http.Request) {
+		flags, err := s.ListFlags(r.Context())
+		if err != nil {
+			WriteError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		WriteBody(w, r, flags)
+	}
+	endpoints[4].Handler = func(w http.ResponseWriter, r *http.Request) {
+		name := PathParam(r, "name")
+		req, err := ReadBody[FlagUpdateRequest](r)
+		if err != nil || name == "" {
+			WriteError(w, r, http.StatusBadRequest, "invalid flag update")
+			return
+		}
+		changedBy := "unknown"
+		if u, err := session.GetSession(r.Context()); err == nil {
+			changedBy = u.UserID
+		}
+		if err := s.SetFlag(r.Context(), name, req.Enabled, changedBy); err != nil {
+			WriteError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		flag, err := s.flags.Get(r.Context(), name)
+		if err != nil || flag == nil {
+			WriteError(w, r, http.StatusInternalServerError, "failed reading flag "+name)
+			return
+		}
+		WriteBody(w, r, flag)
+	}
+
+	if !cfg.DisablePprof {
+		pprofMux := http.NewServeMux()
+		pprofMux.HandleFunc("/debug/pprof/", pprof.Index)
+		pprofMux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		pprofMux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		pprofMux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		pprofMux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		endpoints = append(endpoints, &Endpoint{
+			Name:        "Admin Pprof",
+			Description: "net/http/pprof profiles",
+			Methods:     []string{http.MethodGet, http.MethodPost},
+			Path:        cfg.Prefix + "/debug/pprof/",
+			Handler:     http.StripPrefix(cfg.Prefix, pprofMux).ServeHTTP,
+			Internal:    true,
+			Prefix:      true,
+			Roles:       roles,
+		})
+	}
+
+	for _, e := range endpoints {
+		e.Handler = s.requireAccess(e.Path, e.Handler)
+		e.middleware = middleware
+	}
+	return endpoints
+}
@@ -0,0 +1,106 @@
+package mserve
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/DarlingGoose/credentials/session"
+)
+
+// APIKeyHeader is the header API keys are sent in.
+const APIKeyHeader = "X-API-Key"
+
+// ErrInvalidAPIKey is returned for API keys the APIKeyStore does not know.
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// APIKey is the account an API key authenticates as, usually a service account.
+type APIKey struct {
+	Name      string `json:"name" bson:"name"`
+	UserID    string `json:"user_id" bson:"user_id"`
+	AccountID string `json:"account_id,omitempty" bson:"account_id"`
+}
+
+// APIKeyStore finds the account of an API key. Lookup returns nil, nil for
+// unknown keys.
+type APIKeyStore interface {
+	Lookup(ctx context.Context, key string) (*APIKey, error)
+}
+
+var _ APIKeyStore = &MemoryAPIKeyStore{}
+
+// MemoryAPIKeyStore is an in-process APIKeyStore, keeping only the SHA-256 of
+// the keys.
+type MemoryAPIKeyStore struct {
+	mu   sync.RWMutex
+	keys map[[sha256.Size]byte]APIKey
+}
+
+func NewMemoryAPIKeyStore() *MemoryAPIKeyStore {
+	return &MemoryAPIKeyStore{keys: map[[sha256.Size]byte]APIKey{}}
+}
+
+// Add lets key authenticate as k.
+func (m *MemoryAPIKeyStore) Add(key string, k APIKey) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys[sha256.Sum256([]byte(key))] = k
+}
+
+// Remove revokes key.
+func (m *MemoryAPIKeyStore) Remove(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.keys, sha256.Sum256([]byte(key)))
+}
+
+func (m *MemoryAPIKeyStore) Lookup(ctx context.Context, key string) (*APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	k, ok := m.keys[sha256.Sum256([]byte(key))]
+	if !ok {
+		return nil, nil
+	}
+	return &k, nil
+}
+
+// SetupAPIKeys authenticates requests carrying an X-API-Key header with store
+// instead of the session, and declares the apiKey scheme in the OpenAPI
+// document. The RBAC roles of the key's UserID apply as for any user.
+func (s *Server) SetupAPIKeys(store APIKeyStore) *Server {
+	s.apiKeys = store
+	return s
+}
+
+// authenticate returns the session of the API key of r, or of its session
+// cookie or bearer token when it has none.
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) (*session.UserSessionData, context.Context, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if s.apiKeys == nil || key == "" {
+		return s.sessionClient.Authenticate(w, r)
+	}
+	k, err := s.apiKeys.Lookup(r.Context(), key)
+	if err != nil {
+		return nil, r.Context(), err
+	}
+	if k == nil {
+		return nil, r.Context(), ErrInvalidAPIKey
+	}
+	u := &session.UserSessionData{
+		UserID:         k.UserID,
+		AccountID:      k.AccountID,
+		SignedIn:       true,
+		ServiceAccount: true,
+	}
+	if s.rbac != nil {
+		roles, err := s.rbac.ListRolesForUser(r.Context(), k.UserID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed listing roles of api key", "key", k.Name, "err", err)
+		}
+		u.Roles = roles
+	}
+	return u, u.WithContext(r.Context()), nil
+}
@@ -0,0 +1,260 @@
+package mserve
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang/v2"
+)
+
+// ClientIPConfig configures SetupClientIP.
+type ClientIPConfig struct {
+	// TrustedProxies are CIDRs (or single IPs) whose ForwardedHeader is
+	// honoured. Headers from any other peer are ignored.
+	TrustedProxies []string
+	// ForwardedHeader is the one header the trusted proxies append the client
+	// to, X-Forwarded-For when empty, or Forwarded (RFC 7239). Other
+	// forwarding headers are ignored, they may come from the client.
+	ForwardedHeader string
+	// GeoIPDatabase is an optional path to a MaxMind-format (.mmdb) City, Country
+	// or ASN database used to enrich the client info.
+	GeoIPDatabase string
+}
+
+// GeoInfo is the geo/ASN data looked up for a client IP.
+type GeoInfo struct {
+	Country   string  `json:"country,omitempty"`
+	City      string  `json:"city,omitempty"`
+	Latitude  float64 `json:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty"`
+	TimeZone  string  `json:"time_zone,omitempty"`
+	ASN       uint    `json:"asn,omitempty"`
+	ASOrg     string  `json:"as_org,omitempty"`
+}
+
+// ClientInfo is stored in the request context by the client IP middleware.
+type ClientInfo struct {
+	IP  netip.Addr `json:"ip"`
+	Geo *GeoInfo   `json:"geo,omitempty"`
+}
+
+type clientInfoKey struct{}
+
+// ClientInfoFromContext returns the resolved client info, or nil when the
+// client IP middleware did not run.
+func ClientInfoFromContext(ctx context.Context) *ClientInfo {
+	info, _ := ctx.Value(clientInfoKey{}).(*ClientInfo)
+	return info
+}
+
+// ClientIP returns the resolved client IP from ctx, if any.
+func ClientIP(ctx context.Context) (netip.Addr, bool) {
+	info := ClientInfoFromContext(ctx)
+	if info == nil {
+		return netip.Addr{}, false
+	}
+	return info.IP, true
+}
+
+// WithClientInfo attaches info to ctx.
+func WithClientInfo(ctx context.Context, info *ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoKey{}, info)
+}
+
+// geoRecord decodes both City/Country and ASN database layouts.
+type geoRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+		TimeZone  string  `maxminddb:"time_zone"`
+	} `maxminddb:"location"`
+	ASN   uint   `maxminddb:"autonomous_system_number"`
+	ASOrg string `maxminddb:"autonomous_system_organization"`
+}
+
+// ClientIPResolver resolves the originating client of a request.
+type ClientIPResolver struct {
+	trusted []netip.Prefix
+	header  string
+	geo     *maxminddb.Reader
+}
+
+// NewClientIPResolver parses the trusted proxies and opens the geo database, if set.
+func NewClientIPResolver(cfg ClientIPConfig) (*ClientIPResolver, error) {
+	r := &ClientIPResolver{header: http.CanonicalHeaderKey(strings.TrimSpace(cfg.ForwardedHeader))}
+	if r.header == "" {
+		r.header = "X-Forwarded-For"
+	}
+	for _, p := range cfg.TrustedProxies {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !strings.Contains(p, "/") {
+			addr, err := netip.ParseAddr(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", p, err)
+			}
+			r.trusted = append(r.trusted, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", p, err)
+		}
+		r.trusted = append(r.trusted, prefix.Masked())
+	}
+	if cfg.GeoIPDatabase != "" {
+		db, err := maxminddb.Open(cfg.GeoIPDatabase)
+		if err != nil {
+			return nil, fmt.Errorf("open geoip database: %w", err)
+		}
+		r.geo = db
+	}
+	return r, nil
+}
+
+// Close releases the geo database.
+func (c *ClientIPResolver) Close() error {
+	if c.geo == nil {
+		return nil
+	}
+	return c.geo.Close()
+}
+
+func (c *ClientIPResolver) isTrusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range c.trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// FromTrustedProxy reports whether the direct peer of r is a trusted proxy,
+// whose forwarding headers can be believed.
+func (c *ClientIPResolver) FromTrustedProxy(r *http.Request) bool {
+	peer := parseHostAddr(r.RemoteAddr)
+	return peer.IsValid() && c.isTrusted(peer)
+}
+
+// Resolve returns the client IP for r. The forwarding header is only read when
+// the direct peer is a trusted proxy; the chain is then walked right to left and
+// the first hop that is not a trusted proxy is the client. A hop that is not an
+// address, e.g. for=unknown, ends the walk: the client is unknown and the
+// returned Addr is invalid.
+func (c *ClientIPResolver) Resolve(r *http.Request) netip.Addr {
+	peer := parseHostAddr(r.RemoteAddr)
+	if !c.FromTrustedProxy(r) {
+		return peer
+	}
+	chain := forwardedChain(r, c.header)
+	for i := len(chain) - 1; i >= 0; i-- {
+		if !chain[i].IsValid() || !c.isTrusted(chain[i]) {
+			return chain[i]
+		}
+	}
+	if len(chain) > 0 {
+		return chain[0]
+	}
+	return peer
+}
+
+// Lookup returns the geo/ASN data for addr, or nil without a database or match.
+func (c *ClientIPResolver) Lookup(addr netip.Addr) *GeoInfo {
+	if c.geo == nil || !addr.IsValid() {
+		return nil
+	}
+	var rec geoRecord
+	res := c.geo.Lookup(addr.Unmap())
+	if !res.Found() {
+		return nil
+	}
+	if err := res.Decode(&rec); err != nil {
+		slog.Error("failed decoding geoip record", "ip", addr.String(), "err", err)
+		return nil
+	}
+	return &GeoInfo{
+		Country:   rec.Country.ISOCode,
+		City:      rec.City.Names["en"],
+		Latitude:  rec.Location.Latitude,
+		Longitude: rec.Location.Longitude,
+		TimeZone:  rec.Location.TimeZone,
+		ASN:       rec.ASN,
+		ASOrg:     rec.ASOrg,
+	}
+}
+
+// Middleware stores the resolved ClientInfo in the request context.
+func (c *ClientIPResolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr := c.Resolve(r)
+		info := &ClientInfo{IP: addr, Geo: c.Lookup(addr)}
+		next.ServeHTTP(w, r.WithContext(WithClientInfo(r.Context(), info)))
+	})
+}
+
+// SetupClientIP resolves the client IP of every request, honouring forwarding
+// headers only from cfg.TrustedProxies, and optionally enriches it with geo data.
+// Call it before SetupAccessControl so access conditions can see the client.
+func (s *Server) SetupClientIP(cfg ClientIPConfig) *Server {
+	resolver, err := NewClientIPResolver(cfg)
+	if err != nil {
+		slog.Error("failed setting up client ip resolution", "err", err)
+		return s
+	}
+	s.clientIP = resolver
+	s.AddMiddleware(resolver.Middleware)
+	return s
+}
+
+// forwardedChain returns the hops listed in header, Forwarded or a comma
+// separated list like X-Forwarded-For, in the order they were appended. Hops
+// that are not addresses are kept as invalid Addrs.
+func forwardedChain(r *http.Request, header string) []netip.Addr {
+	var chain []netip.Addr
+	for _, v := range r.Header.Values(header) {
+		for _, element := range strings.Split(v, ",") {
+			element = strings.TrimSpace(element)
+			if element == "" {
+				continue
+			}
+			if header != "Forwarded" {
+				chain = append(chain, parseHostAddr(element))
+				continue
+			}
+			for _, pair := range strings.Split(element, ";") {
+				k, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(k, "for") {
+					chain = append(chain, parseHostAddr(strings.Trim(val, `"`)))
+				}
+			}
+		}
+	}
+	return chain
+}
+
+// parseHostAddr parses "ip", "ip:port", "[ipv6]" and "[ipv6]:port".
+func parseHostAddr(s string) netip.Addr {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
@@ -0,0 +1,37 @@
+// Command mserve holds tooling for mserve services, e.g.
+//
+//	mserve openapi diff saved.yaml http://localhost:8080/openapi/v2.yaml?render=yaml
+//	mserve generate server --out ./internal/petstore petstore.yaml
+//	mserve generate client --out ./pkg/petstore_client petstore.yaml
+//	mserve generate nuxt --out ./modules/petstore petstore.yaml
+//	mserve generate python --out ./clients/python petstore.yaml
+package main
+
+import (
+	"os"
+
+	generators "github.com/DarlingGoose/mserve/generator"
+	"github.com/DarlingGoose/mserve/openapidiff"
+	"github.com/spf13/cobra"
+)
+
+func main() {
+	root := &cobra.Command{
+		Use:   "mserve",
+		Short: "Tooling for mserve services",
+	}
+	openapi := &cobra.Command{
+		Use:   "openapi",
+		Short: "Work with OpenAPI documents",
+	}
+	openapi.AddCommand(openapidiff.Command(nil))
+	generate := &cobra.Command{
+		Use:   "generate",
+		Short: "Generate code from OpenAPI documents",
+	}
+	generate.AddCommand(generators.ServerCommand(), generators.ClientCommand(), generators.NuxtCommand(), generators.PythonCommand())
+	root.AddCommand(openapi, generate)
+	if err := root.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
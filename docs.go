@@ -0,0 +1,140 @@
+package mserve
+
+import (
+	"embed"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+//go:embed docsui
+var docsUI embed.FS
+
+const (
+	docsSpecPath   = "/openapi/v2.yaml"
+	docsAssetsPath = "/openapi/assets/"
+)
+
+var (
+	defaultSwaggerTemplate = template.Must(template.ParseFS(docsUI, "docsui/templates/swagger.html.tmpl"))
+	defaultRedocTemplate   = template.Must(template.ParseFS(docsUI, "docsui/templates/redoc.html.tmpl"))
+)
+
+// DocsConfig configures the documentation pages served by GenerateOpenAPIDocs.
+type DocsConfig struct {
+	// Title of the docs pages, defaults to the OpenAPI info title
+	Title string
+	// LogoURL, when set, is shown in a header above the docs
+	LogoURL string
+	// SwaggerTemplate replaces the Swagger UI page, executed with a DocsPage
+	SwaggerTemplate *template.Template
+	// RedocTemplate replaces the ReDoc page (?render=redoc), executed with a DocsPage
+	RedocTemplate *template.Template
+	// Assets replaces the embedded docsui assets served under /openapi/assets/
+	Assets fs.FS
+}
+
+// DocsPage is the data the docs page templates are executed with.
+type DocsPage struct {
+	Title   string
+	LogoURL string
+	// SpecURL is the YAML document the page renders
+	SpecURL string
+	// AssetsURL is the base URL of the UI assets, without a trailing slash
+	AssetsURL string
+	// OpenAPIYAMLURL is SpecURL, kept for templates written against the old page
+	OpenAPIYAMLURL string
+}
+
+// SetupDocs configures the title, branding and templates of the docs pages.
+func (s *Server) SetupDocs(cfg DocsConfig) *Server {
+	s.docs = cfg
+	return s
+}
+
+func (s *Server) docsAssets() fs.FS {
+	if s.docs.Assets != nil {
+		return s.docs.Assets
+	}
+	sub, err := fs.Sub(docsUI, "docsui")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// mountPrefix returns the path the router is reachable under: MountPrefix when
+// set, otherwise the X-Forwarded-Prefix of a path-rewriting proxy. The header
+// is only believed from the trusted proxies of SetupClientIP, any client could
+// send it to point the page at other scripts.
+func (s *Server) mountPrefix(r *http.Request) string {
+	prefix := s.MountPrefix
+	if prefix == "" && s.clientIP != nil && s.clientIP.FromTrustedProxy(r) {
+		prefix = r.Header.Get("X-Forwarded-Prefix")
+		if strings.ContainsAny(prefix, `\?#:`) {
+			return ""
+		}
+	}
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	return "/" + prefix
+}
+
+func (s *Server) docsPage(r *http.Request, title, prefix string) DocsPage {
+	base := s.mountPrefix(r)
+	if s.docs.Title != "" {
+		title = s.docs.Title
+	}
+	spec := base + docsSpecPath + "?render=yaml"
+	if prefix != "" {
+		spec += "&prefix=" + url.QueryEscape(prefix)
+	}
+	return DocsPage{
+		Title:          title,
+		LogoURL:        s.docs.LogoURL,
+		SpecURL:        spec,
+		AssetsURL:      base + strings.TrimSuffix(docsAssetsPath, "/"),
+		OpenAPIYAMLURL: spec,
+	}
+}
+
+// docsAssetsEndpoint serves the embedded Swagger UI/ReDoc assets.
+func (s *Server) docsAssetsEndpoint() *Endpoint {
+	files := http.StripPrefix(docsAssetsPath, http.FileServer(http.FS(s.docsAssets())))
+	return &Endpoint{
+		Name:        "OpenAPI Assets",
+		Description: "Embedded Swagger UI and ReDoc assets",
+		Methods:     []string{http.MethodGet},
+		Path:        docsAssetsPath,
+		Prefix:      true,
+		Internal:    true,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "public, max-age=86400")
+			files.ServeHTTP(w, r)
+		},
+	}
+}
+
+// renderDocsPage writes the Swagger UI page, or ReDoc for render=redoc.
+func (s *Server) renderDocsPage(w http.ResponseWriter, r *http.Request, page DocsPage) {
+	tmpl := s.docs.SwaggerTemplate
+	if tmpl == nil {
+		tmpl = defaultSwaggerTemplate
+	}
+	if r.URL.Query().Get("render") == "redoc" {
+		tmpl = s.docs.RedocTemplate
+		if tmpl == nil {
+			tmpl = defaultRedocTemplate
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.Execute(w, page); err != nil {
+		http.Error(w, "Failed to render docs: "+err.Error(), http.StatusInternalServerError)
+		slog.Error("Error writing docs page", "err", err)
+	}
+}
@@ -0,0 +1,4 @@
+window.addEventListener("load", function () {
+  var el = document.getElementById("redoc");
+  Redoc.init(el.dataset.specUrl, {}, el);
+});
@@ -0,0 +1,16 @@
+window.addEventListener("load", function () {
+  var el = document.getElementById("swagger-ui");
+  window.ui = SwaggerUIBundle({
+    url: el.dataset.specUrl,
+    dom_id: "#swagger-ui",
+    deepLinking: true,
+    presets: [
+      SwaggerUIBundle.presets.apis,
+      SwaggerUIStandalonePreset
+    ],
+    plugins: [
+      SwaggerUIBundle.plugins.DownloadUrl
+    ],
+    layout: "StandaloneLayout"
+  });
+});
@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"fmt"
 	"log"
+	"os"
 	"time"
 
 	"github.com/DarlingGoose/credentials/oauth/oserver"
@@ -62,7 +63,12 @@ func main() {
 		HealthCheck("/healthz", nil).
 		GenerateOpenAPIDocs()
 
-	_ = generators.NewGoClientGenerator(nil).Generate(generators.NewGenData(), s.Endpoints()...)
+	gen := generators.NewGoClientGenerator(nil)
+	fs := gen.Flags()
+	_ = fs.Parse(os.Args[1:])
+	if err := gen.Generate(generators.NewGenData(), s.Endpoints()...); err != nil {
+		log.Fatal(err)
+	}
 
 }
 
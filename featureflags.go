@@ -0,0 +1,210 @@
+package mserve
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// FlagReadOnly rejects every unsafe (non GET/HEAD/OPTIONS) request while enabled.
+	FlagReadOnly = "read_only"
+	// FlagMaintenance rejects every request except health checks and admin routes while enabled.
+	FlagMaintenance = "maintenance"
+
+	defaultRetryAfter = 60 * time.Second
+)
+
+// FeatureFlag is a named runtime switch and who last changed it.
+type FeatureFlag struct {
+	Name      string `json:"name" bson:"name"`
+	Enabled   bool   `json:"enabled" bson:"enabled"`
+	UpdatedBy string `json:"updated_by,omitempty" bson:"updated_by"`
+	UpdatedAt int64  `json:"updated_at,omitempty" bson:"updated_at"`
+}
+
+// FlagStore persists feature flags. Get returns nil, nil for unknown flags.
+type FlagStore interface {
+	Get(ctx context.Context, name string) (*FeatureFlag, error)
+	Set(ctx context.Context, flag FeatureFlag) error
+	List(ctx context.Context) ([]FeatureFlag, error)
+}
+
+var _ FlagStore = &MemoryFlagStore{}
+
+// MemoryFlagStore is the default in-process FlagStore.
+type MemoryFlagStore struct {
+	mu    sync.RWMutex
+	flags map[string]FeatureFlag
+}
+
+func NewMemoryFlagStore() *MemoryFlagStore {
+	return &MemoryFlagStore{flags: map[string]FeatureFlag{}}
+}
+
+func (m *MemoryFlagStore) Get(ctx context.Context, name string) (*FeatureFlag, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	f, ok := m.flags[name]
+	if !ok {
+		return nil, nil
+	}
+	return &f, nil
+}
+
+func (m *MemoryFlagStore) Set(ctx context.Context, flag FeatureFlag) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.flags[flag.Name] = flag
+	return nil
+}
+
+func (m *MemoryFlagStore) List(ctx context.Context) ([]FeatureFlag, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]FeatureFlag, 0, len(m.flags))
+	for _, f := range m.flags {
+		out = append(out, f)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+	return out, nil
+}
+
+// SetFlagStore replaces the in-memory flag store, e.g. with a shared database backed one.
+func (s *Server) SetFlagStore(store FlagStore) *Server {
+	s.flags = store
+	return s
+}
+
+// FlagStore returns the server's flag store.
+func (s *Server) FlagStore() FlagStore {
+	return s.flags
+}
+
+// SetFlag enables or disables a flag, recording who changed it.
+func (s *Server) SetFlag(ctx context.Context, name string, enabled bool, changedBy string) error {
+	err := s.flags.Set(ctx, FeatureFlag{
+		Name:      name,
+		Enabled:   enabled,
+		UpdatedBy: changedBy,
+		UpdatedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("feature flag changed", "flag", name, "enabled", enabled, "by", changedBy)
+	return nil
+}
+
+// DeclareFlag sets the state of a flag until it is set in the store. Flags
+// of endpoints are declared on by AddEndpoints, unless FeatureFlagOff is set.
+func (s *Server) DeclareFlag(name string, enabled bool) {
+	s.muFlags.Lock()
+	defer s.muFlags.Unlock()
+	s.flagDefaults[name] = enabled
+}
+
+func (s *Server) flagDefault(name string) bool {
+	s.muFlags.RLock()
+	defer s.muFlags.RUnlock()
+	return s.flagDefaults[name]
+}
+
+// FlagEnabled reports whether a flag is on. Flags missing from the store and
+// store errors fall back to the declared default, off for undeclared flags.
+func (s *Server) FlagEnabled(ctx context.Context, name string) bool {
+	f, err := s.flags.Get(ctx, name)
+	if err != nil {
+		slog.Error("failed reading feature flag", "flag", name, "err", err)
+		return s.flagDefault(name)
+	}
+	if f == nil {
+		return s.flagDefault(name)
+	}
+	return f.Enabled
+}
+
+// ListFlags returns the flags of the store and the declared flags not set
+// yet, with their default state.
+func (s *Server) ListFlags(ctx context.Context) ([]FeatureFlag, error) {
+	flags, err := s.flags.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[string]bool, len(flags))
+	for _, f := range flags {
+		set[f.Name] = true
+	}
+	s.muFlags.RLock()
+	for name, enabled := range s.flagDefaults {
+		if !set[name] {
+			flags = append(flags, FeatureFlag{Name: name, Enabled: enabled})
+		}
+	}
+	s.muFlags.RUnlock()
+	sort.Slice(flags, func(i, j int) bool {
+		return flags[i].Name < flags[j].Name
+	})
+	return flags, nil
+}
+
+func (s *Server) writeUnavailable(w http.ResponseWriter, r *http.Request, msg string) {
+	retryAfter := s.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = defaultRetryAfter
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+	WriteError(w, r, http.StatusServiceUnavailable, msg)
+}
+
+// maintenanceMiddleware enforces the global FlagMaintenance and FlagReadOnly switches.
+func (s *Server) maintenanceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || s.isMaintenanceExempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if s.FlagEnabled(r.Context(), FlagMaintenance) {
+			s.writeUnavailable(w, r, "service is under maintenance")
+			return
+		}
+		if !isSafeMethod(r.Method) && s.FlagEnabled(r.Context(), FlagReadOnly) {
+			s.writeUnavailable(w, r, "service is in read-only mode")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) isMaintenanceExempt(p string) bool {
+	if s.healthCheckPath != "" && p == s.healthCheckPath {
+		return true
+	}
+	return s.adminPrefix != "" && strings.HasPrefix(p, s.adminPrefix+"/")
+}
+
+// featureFlagHandler serves next only while flag is enabled.
+func (s *Server) featureFlagHandler(flag string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.FlagEnabled(r.Context(), flag) {
+			s.writeUnavailable(w, r, "feature "+flag+" is disabled")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
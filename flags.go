@@ -8,6 +8,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -84,6 +85,10 @@ func BindFlags(cfg interface{}, prefixPath string) (*pflag.FlagSet, error) {
 			ptr := fv.Addr().Interface().(*int32)
 			fs.Int32Var(ptr, name, int32(fv.Int()), usage)
 		case reflect.Int64:
+			if ptr, ok := fv.Addr().Interface().(*time.Duration); ok {
+				fs.DurationVar(ptr, name, *ptr, usage)
+				break
+			}
 			ptr := fv.Addr().Interface().(*int64)
 			fs.Int64Var(ptr, name, fv.Int(), usage)
 
@@ -131,6 +136,8 @@ func BindFlags(cfg interface{}, prefixPath string) (*pflag.FlagSet, error) {
 	return fs, nil
 }
 
+var durationType = reflect.TypeOf(time.Duration(0))
+
 // LoadConfig reads all flags from cmd.Flags() (and any bound ENV vars)
 // into a new zero‐value T (which must be a struct type), and returns it.
 
@@ -200,6 +207,12 @@ func LoadConfig[T any](cmd *cobra.Command, prefixPath string) (T, error) {
 				assign(b)
 
 			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				if fv.Type() == durationType {
+					var d time.Duration
+					d, parseErr = time.ParseDuration(ev)
+					assign(d)
+					break
+				}
 				var si int64
 				si, parseErr = strconv.ParseInt(ev, 10, fv.Type().Bits())
 				assign(si)
@@ -256,6 +269,12 @@ func LoadConfig[T any](cmd *cobra.Command, prefixPath string) (T, error) {
 				v32, parseErr = cmd.Flags().GetInt32(name)
 				assign(v32)
 			case reflect.Int64:
+				if fv.Type() == durationType {
+					var d time.Duration
+					d, parseErr = cmd.Flags().GetDuration(name)
+					assign(d)
+					break
+				}
 				var v64 int64
 				v64, parseErr = cmd.Flags().GetInt64(name)
 				assign(v64)
@@ -0,0 +1,462 @@
+package mserve
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DarlingGoose/mserve/nuxt3FromOpenApi"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gorilla/mux"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultGatewayTTL = time.Minute
+
+// GatewayUpstream is a service whose OpenAPI document is merged into the
+// document of the gateway Server.
+type GatewayUpstream struct {
+	// Name namespaces the upstream component names, operation IDs and tags,
+	// defaults to the title of its document
+	Name string
+	// Prefix the upstream paths are served under, e.g. /billing
+	Prefix string
+	// DocsURL of the upstream document, render=yaml is added when missing
+	DocsURL string
+	// Target is the base URL requests are proxied to, defaults to the scheme
+	// and host of DocsURL
+	Target string
+}
+
+// GatewayConfig configures the aggregation of upstream OpenAPI documents.
+type GatewayConfig struct {
+	Upstreams []GatewayUpstream
+	// Proxy reverse-proxies Prefix/... to the upstream Target with the prefix
+	// stripped and X-Forwarded-Prefix set, honoured by upstreams that trust the
+	// gateway in their SetupClientIP
+	Proxy bool
+	// TTL the fetched documents are reused for, defaults to a minute
+	TTL    time.Duration
+	Client *http.Client
+}
+
+type gateway struct {
+	cfg GatewayConfig
+	// routes are the reverse proxy routes, which skip the access middleware
+	routes []*mux.Route
+	// refresh makes concurrent requests share one round of upstream fetches
+	refresh singleflight.Group
+
+	mu      sync.Mutex
+	docs    []map[string]interface{}
+	fetched time.Time
+}
+
+// SetupGateway turns the Server into a gateway for cfg.Upstreams: the OpenAPI
+// document, docs pages and Nuxt plugin served by GenerateOpenAPIDocs combine
+// the Server's own endpoints with every upstream document, each under its
+// Prefix and with its component names namespaced.
+//
+// Requests routed to the reverse proxies skip the access control middleware,
+// the upstreams authorize their own requests. Local endpoints under an upstream
+// prefix keep theirs.
+func (s *Server) SetupGateway(cfg GatewayConfig) *Server {
+	if cfg.TTL <= 0 {
+		cfg.TTL = defaultGatewayTTL
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	for i, up := range cfg.Upstreams {
+		up.Prefix = "/" + strings.Trim(up.Prefix, "/")
+		if up.Prefix == "/" {
+			slog.Error("gateway upstream needs a prefix", "docs_url", up.DocsURL)
+			return s
+		}
+		docsURL, err := url.Parse(up.DocsURL)
+		if err != nil || docsURL.Host == "" {
+			slog.Error("invalid gateway upstream docs url", "prefix", up.Prefix, "docs_url", up.DocsURL, "err", err)
+			return s
+		}
+		if docsURL.Query().Get("render") == "" {
+			q := docsURL.Query()
+			q.Set("render", "yaml")
+			docsURL.RawQuery = q.Encode()
+		}
+		up.DocsURL = docsURL.String()
+		if up.Target == "" {
+			up.Target = docsURL.Scheme + "://" + docsURL.Host
+		}
+		cfg.Upstreams[i] = up
+	}
+	var routes []*mux.Route
+	if cfg.Proxy {
+		for _, up := range cfg.Upstreams {
+			ep, err := gatewayProxyEndpoint(up)
+			if err == nil {
+				err = s.AddEndpoints(context.Background(), ep)
+			}
+			if err != nil {
+				slog.Error("failed adding gateway proxy", "prefix", up.Prefix, "err", err)
+				return s
+			}
+			routes = append(routes, s.router.Get(ep.Name))
+		}
+	}
+	s.gateway = &gateway{cfg: cfg, routes: routes, docs: make([]map[string]interface{}, len(cfg.Upstreams))}
+	return s
+}
+
+// gatewayProxyEndpoint forwards Prefix/... to the upstream Target.
+func gatewayProxyEndpoint(up GatewayUpstream) (*Endpoint, error) {
+	target, err := url.Parse(up.Target)
+	if err != nil {
+		return nil, err
+	}
+	prefix := up.Prefix
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(pr.Out.URL.Path, prefix), "/")
+			pr.Out.URL.RawPath = ""
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			pr.Out.Header.Set("X-Forwarded-Prefix", prefix)
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			// the gateway answers CORS itself
+			for k := range resp.Header {
+				if strings.HasPrefix(k, "Access-Control-") {
+					resp.Header.Del(k)
+				}
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			WriteError(w, r, http.StatusBadGateway, "upstream "+prefix+": "+err.Error())
+		},
+	}
+	return &Endpoint{
+		Name:        "Gateway " + prefix,
+		Description: "Reverse proxy to " + up.Target,
+		Methods: []string{
+			http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+			http.MethodDelete, http.MethodHead,
+		},
+		Path:     prefix + "/",
+		Prefix:   true,
+		Internal: true,
+		Handler:  proxy.ServeHTTP,
+	}, nil
+}
+
+// proxies reports whether route is one of the reverse proxies to an upstream.
+// Local endpoints under an upstream prefix are not proxied.
+func (g *gateway) proxies(route *mux.Route) bool {
+	if g == nil || route == nil {
+		return false
+	}
+	for _, r := range g.routes {
+		if r == route {
+			return true
+		}
+	}
+	return false
+}
+
+// gatewayDocument returns local merged with the upstream documents, or local
+// when the Server is not a gateway.
+func (s *Server) gatewayDocument(ctx context.Context, local *openapi3.T) *openapi3.T {
+	if s.gateway == nil {
+		return local
+	}
+	docs := s.gateway.upstreamDocs(ctx)
+	merged, err := mergeOpenAPI(local, docs...)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed merging gateway OpenAPI documents", "err", err)
+		return local
+	}
+	return merged
+}
+
+// upstreamDocs returns the namespaced upstream documents, refetching them once
+// the TTL passed. An upstream that fails keeps its last good document. The
+// fetches run without holding g.mu, concurrent requests wait for the same
+// round and a request that is canceled meanwhile gets the previous documents.
+func (g *gateway) upstreamDocs(ctx context.Context) []map[string]interface{} {
+	g.mu.Lock()
+	stale := time.Since(g.fetched) >= g.cfg.TTL
+	g.mu.Unlock()
+	if stale {
+		// the round is shared, it must outlive the request that started it
+		refreshed := g.refresh.DoChan("docs", func() (interface{}, error) {
+			g.fetchAll(context.WithoutCancel(ctx))
+			return nil, nil
+		})
+		select {
+		case <-refreshed:
+		case <-ctx.Done():
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var docs []map[string]interface{}
+	for _, doc := range g.docs {
+		if doc != nil {
+			docs = append(docs, doc)
+		}
+	}
+	return docs
+}
+
+// fetchAll fetches every upstream document concurrently and swaps the ones
+// that were fetched in.
+func (g *gateway) fetchAll(ctx context.Context) {
+	fetched := make([]map[string]interface{}, len(g.cfg.Upstreams))
+	var eg errgroup.Group
+	for i, up := range g.cfg.Upstreams {
+		eg.Go(func() error {
+			doc, err := g.fetch(ctx, up)
+			if err != nil {
+				slog.WarnContext(ctx, "failed fetching upstream OpenAPI document", "prefix", up.Prefix, "docs_url", up.DocsURL, "err", err)
+				return nil
+			}
+			fetched[i] = doc
+			return nil
+		})
+	}
+	_ = eg.Wait()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, doc := range fetched {
+		if doc != nil {
+			g.docs[i] = doc
+		}
+	}
+	g.fetched = time.Now()
+}
+
+func (g *gateway) fetch(ctx context.Context, up GatewayUpstream) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, up.DocsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := g.cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	// YAML is a superset of JSON, so this reads both renderings
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	if _, ok := doc["paths"]; !ok {
+		return nil, fmt.Errorf("not an OpenAPI document")
+	}
+	name := up.Name
+	if name == "" {
+		if info, ok := doc["info"].(map[string]interface{}); ok {
+			name, _ = info["title"].(string)
+		}
+	}
+	if name == "" {
+		name = up.Prefix
+	}
+	namespaceOpenAPI(doc, nuxt3FromOpenApi.ToPascalCase(name), up.Prefix)
+	return doc, nil
+}
+
+// namespaceOpenAPI prefixes the paths of doc with prefix and the component
+// names, operation IDs and tags with ns. Security schemes keep their names,
+// every mserve service declares the same ones.
+func namespaceOpenAPI(doc map[string]interface{}, ns, prefix string) {
+	if components, ok := doc["components"].(map[string]interface{}); ok {
+		for kind, v := range components {
+			named, ok := v.(map[string]interface{})
+			if !ok || kind == "securitySchemes" {
+				continue
+			}
+			renamed := make(map[string]interface{}, len(named))
+			for name, c := range named {
+				renamed[ns+name] = c
+			}
+			components[kind] = renamed
+		}
+	}
+	rewriteRefs(doc, ns)
+
+	if paths, ok := doc["paths"].(map[string]interface{}); ok {
+		prefixed := make(map[string]interface{}, len(paths))
+		for p, item := range paths {
+			prefixed[prefix+p] = item
+			ops, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for _, op := range ops {
+				o, ok := op.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if id, ok := o["operationId"].(string); ok && id != "" {
+					o["operationId"] = ns + " " + id
+				}
+				if tags, ok := o["tags"].([]interface{}); ok {
+					for i, t := range tags {
+						tags[i] = fmt.Sprint(ns, " ", t)
+					}
+				}
+			}
+		}
+		doc["paths"] = prefixed
+	}
+	if tags, ok := doc["tags"].([]interface{}); ok {
+		for _, t := range tags {
+			if tag, ok := t.(map[string]interface{}); ok {
+				tag["name"] = fmt.Sprint(ns, " ", tag["name"])
+			}
+		}
+	}
+	delete(doc, "servers")
+}
+
+// rewriteRefs namespaces every local component $ref below v.
+func rewriteRefs(v interface{}, ns string) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, c := range t {
+			ref, ok := c.(string)
+			if k == "$ref" && ok && strings.HasPrefix(ref, "#/components/") {
+				parts := strings.SplitN(strings.TrimPrefix(ref, "#/components/"), "/", 2)
+				if len(parts) == 2 && parts[0] != "securitySchemes" {
+					t[k] = "#/components/" + parts[0] + "/" + ns + parts[1]
+				}
+				continue
+			}
+			rewriteRefs(c, ns)
+		}
+	case []interface{}:
+		for _, c := range t {
+			rewriteRefs(c, ns)
+		}
+	}
+}
+
+// mergeOpenAPI adds the paths, components and tags of the namespaced upstream
+// documents to a copy of local. Local paths win over upstream ones.
+func mergeOpenAPI(local *openapi3.T, upstreams ...map[string]interface{}) (*openapi3.T, error) {
+	raw, err := local.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	paths := childMap(doc, "paths")
+	components := childMap(doc, "components")
+	tags, _ := doc["tags"].([]interface{})
+	seenTags := map[string]bool{}
+	for _, t := range tags {
+		if tag, ok := t.(map[string]interface{}); ok {
+			seenTags[fmt.Sprint(tag["name"])] = true
+		}
+	}
+	for _, up := range upstreams {
+		if upPaths, ok := up["paths"].(map[string]interface{}); ok {
+			for _, p := range sortedMapKeys(upPaths) {
+				if _, exists := paths[p]; exists {
+					slog.Warn("gateway path clash, keeping the first document's", "path", p)
+					continue
+				}
+				paths[p] = upPaths[p]
+			}
+		}
+		if upComponents, ok := up["components"].(map[string]interface{}); ok {
+			for kind, v := range upComponents {
+				named, ok := v.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				target := childMap(components, kind)
+				for name, c := range named {
+					if _, exists := target[name]; !exists {
+						target[name] = c
+					}
+				}
+			}
+		}
+		if upTags, ok := up["tags"].([]interface{}); ok {
+			for _, t := range upTags {
+				tag, ok := t.(map[string]interface{})
+				if !ok || seenTags[fmt.Sprint(tag["name"])] {
+					continue
+				}
+				seenTags[fmt.Sprint(tag["name"])] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	if len(tags) > 0 {
+		doc["tags"] = tags
+	}
+	raw, err = json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	merged := &openapi3.T{}
+	if err := merged.UnmarshalJSON(raw); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+func childMap(parent map[string]interface{}, key string) map[string]interface{} {
+	child, ok := parent[key].(map[string]interface{})
+	if !ok {
+		child = map[string]interface{}{}
+		parent[key] = child
+	}
+	return child
+}
+
+func sortedMapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// filterOpenAPIPaths returns a copy of doc with only the paths containing p.
+func filterOpenAPIPaths(doc *openapi3.T, p string) *openapi3.T {
+	filtered := *doc
+	filtered.Paths = openapi3.NewPaths()
+	for k, item := range doc.Paths.Map() {
+		if strings.Contains(k, p) {
+			filtered.Paths.Set(k, item)
+		}
+	}
+	return &filtered
+}
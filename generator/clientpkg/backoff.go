@@ -2,6 +2,8 @@ package clientpkg
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 
 	backoff "github.com/cenkalti/backoff/v4"
@@ -25,17 +27,64 @@ func NewBackoff(maxRetry uint64, maxInterval, maxElapsedTime, initialInterval ti
 	}
 }
 
+// RetryAfterError is returned by an operation to wait at least After before
+// it is retried, e.g. for the Retry-After header of a response.
+type RetryAfterError struct {
+	Err   error
+	After time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("%v, retry after %s", e.Err, e.After)
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// Retry runs operation until it succeeds, returns a backoff.Permanent error,
+// ctx is done or the retries of b are used up. A nil b retries 3 times.
 func (b *BackOff) Retry(ctx context.Context, operation backoff.Operation) error {
-	op := backoff.Operation(operation)
+	if b == nil {
+		b = defaultBackOff
+	}
+	bo := &retryAfterBackOff{BackOff: b.getBackoff()}
+	op := func() error {
+		err := operation()
+		var ra *RetryAfterError
+		if errors.As(err, &ra) {
+			bo.after = ra.After
+		}
+		return err
+	}
 	notify := func(err error, backoffDuration time.Duration) {
 		slog.Debug("retrying", "err", err, "duration", backoffDuration)
 	}
-	if err := backoff.RetryNotify(op, b.getBackoff(), notify); err != nil {
+	if err := backoff.RetryNotify(op, backoff.WithContext(bo, ctx), notify); err != nil {
 		return err
 	}
 	return nil
 
 }
+
+var defaultBackOff = NewBackoff(3, 30*time.Second, 2*time.Minute, 500*time.Millisecond)
+
+// retryAfterBackOff waits the jittered interval of BackOff, or longer when the
+// last attempt asked for it with a RetryAfterError.
+type retryAfterBackOff struct {
+	backoff.BackOff
+	after time.Duration
+}
+
+func (b *retryAfterBackOff) NextBackOff() time.Duration {
+	next := b.BackOff.NextBackOff()
+	if next != backoff.Stop && b.after > next {
+		next = b.after
+	}
+	b.after = 0
+	return next
+}
+
 func (b *BackOff) getBackoff() backoff.BackOff {
 	requestExpBackOff := backoff.NewExponentialBackOff()
 	requestExpBackOff.InitialInterval = b.InitialInterval
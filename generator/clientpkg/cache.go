@@ -0,0 +1,315 @@
+package clientpkg
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultCacheSize = 1000
+
+// Cache stores the responses of GET requests by CacheKey.
+type Cache interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, r *CachedResponse)
+	Delete(key string)
+}
+
+// CachedResponse is a response kept by a Cache.
+type CachedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	// Expires is when the response has to be revalidated with the server
+	Expires time.Time
+}
+
+// Fresh reports whether r can be used without asking the server.
+func (r *CachedResponse) Fresh(now time.Time) bool {
+	return now.Before(r.Expires)
+}
+
+func (r *CachedResponse) validators() (etag, lastModified string) {
+	return r.Header.Get("ETag"), r.Header.Get("Last-Modified")
+}
+
+func (r *CachedResponse) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        strconv.Itoa(r.Status) + " " + http.StatusText(r.Status),
+		StatusCode:    r.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        r.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
+
+// CacheStats counts how the cache of a Client answered GET requests.
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+	// Revalidated counts hits confirmed by the server with 304 Not Modified,
+	// they are part of Hits
+	Revalidated uint64
+}
+
+type cacheCounters struct {
+	hits, misses, revalidated atomic.Uint64
+}
+
+// CacheStats returns the hits and misses of the cache of c.
+func (c *Client) CacheStats() CacheStats {
+	return CacheStats{
+		Hits:        c.cacheStats.hits.Load(),
+		Misses:      c.cacheStats.misses.Load(),
+		Revalidated: c.cacheStats.revalidated.Load(),
+	}
+}
+
+// cached answers GET requests from c.Cache while they are fresh, revalidates
+// them with If-None-Match/If-Modified-Since afterwards and stores what the
+// server allows. With skip set the cache is not read, only refreshed. It runs
+// last in the chain, so requests are keyed with the headers they are sent
+// with, see CacheKey.
+func (c *Client) cached(skip bool, do RoundTrip) RoundTrip {
+	return func(req *http.Request) (*http.Response, error) {
+		if req.Method != http.MethodGet {
+			// e.g. the token requests of OAuthClient
+			return do(req)
+		}
+		key := c.CacheKey(req)
+		now := time.Now()
+		entry, found := c.Cache.Get(key)
+		if found && !skip {
+			if entry.Fresh(now) {
+				c.cacheStats.hits.Add(1)
+				return entry.response(req), nil
+			}
+			etag, lastModified := entry.validators()
+			if etag == "" && lastModified == "" {
+				found = false
+			}
+			if etag != "" {
+				req.Header.Set("If-None-Match", etag)
+			}
+			if lastModified != "" {
+				req.Header.Set("If-Modified-Since", lastModified)
+			}
+		}
+
+		resp, err := do(req)
+		if err != nil {
+			return resp, err
+		}
+		if found && !skip && resp.StatusCode == http.StatusNotModified {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+			c.cacheStats.hits.Add(1)
+			c.cacheStats.revalidated.Add(1)
+			updated := *entry
+			updated.Header = entry.Header.Clone()
+			for k, v := range resp.Header {
+				updated.Header[k] = v
+			}
+			entry = &updated
+			if expires, ok := c.cacheExpiry(entry.Header, now); ok {
+				entry.Expires = expires
+				c.Cache.Set(key, entry)
+			} else {
+				c.Cache.Delete(key)
+			}
+			return entry.response(req), nil
+		}
+		if !skip {
+			c.cacheStats.misses.Add(1)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return resp, nil
+		}
+		expires, ok := c.cacheExpiry(resp.Header, now)
+		if !ok {
+			c.Cache.Delete(key)
+			return resp, nil
+		}
+		body, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		c.Cache.Set(key, &CachedResponse{
+			Status:  resp.StatusCode,
+			Header:  resp.Header.Clone(),
+			Body:    body,
+			Expires: expires,
+		})
+		return resp, nil
+	}
+}
+
+// cacheExpiry reads Cache-Control of a response: max-age sets its freshness,
+// no-cache makes it stale right away and no-store, like Vary: *, keeps it out
+// of the cache. private responses are kept, the cache belongs to the Client
+// and is keyed by its credentials. Without max-age c.CacheTTL applies,
+// responses with neither are only kept when they carry an ETag or
+// Last-Modified to revalidate with.
+func (c *Client) cacheExpiry(h http.Header, now time.Time) (time.Time, bool) {
+	if h.Get("Vary") == "*" {
+		return time.Time{}, false
+	}
+	maxAge := time.Duration(-1)
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store":
+			return time.Time{}, false
+		case "no-cache":
+			maxAge = 0
+		case "max-age":
+			if secs, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil && maxAge != 0 {
+				maxAge = time.Duration(secs) * time.Second
+			}
+		}
+	}
+	if maxAge < 0 {
+		maxAge = c.CacheTTL
+	}
+	if maxAge <= 0 && h.Get("ETag") == "" && h.Get("Last-Modified") == "" {
+		return time.Time{}, false
+	}
+	return now.Add(maxAge), true
+}
+
+// LRUCache is an in-memory Cache holding at most size responses, evicting the
+// least recently used one.
+type LRUCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key      string
+	response *CachedResponse
+}
+
+// NewLRUCache returns an LRUCache of size entries, 1000 when size is not
+// positive.
+func NewLRUCache(size int) *LRUCache {
+	if size <= 0 {
+		size = defaultCacheSize
+	}
+	return &LRUCache{size: size, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (l *LRUCache) Get(key string) (*CachedResponse, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	el, ok := l.entries[key]
+	if !ok {
+		return nil, false
+	}
+	l.order.MoveToFront(el)
+	return el.Value.(*lruEntry).response, true
+}
+
+func (l *LRUCache) Set(key string, r *CachedResponse) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if el, ok := l.entries[key]; ok {
+		el.Value.(*lruEntry).response = r
+		l.order.MoveToFront(el)
+		return
+	}
+	l.entries[key] = l.order.PushFront(&lruEntry{key: key, response: r})
+	for l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (l *LRUCache) Delete(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if el, ok := l.entries[key]; ok {
+		l.order.Remove(el)
+		delete(l.entries, key)
+	}
+}
+
+// Len returns the number of cached responses.
+func (l *LRUCache) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.order.Len()
+}
+
+// DiskCache is a Cache keeping one JSON file per response in Dir, so it
+// survives restarts of the process.
+type DiskCache struct {
+	Dir string
+}
+
+// NewDiskCache creates dir when needed and returns a DiskCache storing in it.
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := ensureDir(dir); err != nil {
+		return nil, err
+	}
+	return &DiskCache{Dir: dir}, nil
+}
+
+func (d *DiskCache) file(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.Dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (d *DiskCache) Get(key string) (*CachedResponse, bool) {
+	data, err := os.ReadFile(d.file(key))
+	if err != nil {
+		return nil, false
+	}
+	var r CachedResponse
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, false
+	}
+	return &r, true
+}
+
+func (d *DiskCache) Set(key string, r *CachedResponse) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+	file := d.file(key)
+	tmp, err := os.CreateTemp(d.Dir, "."+filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err = errors.Join(err, tmp.Close()); err != nil {
+		return
+	}
+	_ = os.Rename(tmp.Name(), file)
+}
+
+func (d *DiskCache) Delete(key string) {
+	_ = os.Remove(d.file(key))
+}
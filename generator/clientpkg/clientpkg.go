@@ -3,20 +3,25 @@ package clientpkg
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
-	"fmt"
+	"io"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/DarlingGoose/mserve"
-	"github.com/spf13/pflag"
 )
 
 var _ HttpClient = &Client{}
 var _ HttpClient = &MockClient{}
 
+// UseResponseCache gives clients created by New an in-memory LRUCache.
 var UseResponseCache = false
 
 type HttpClient interface {
@@ -25,6 +30,10 @@ type HttpClient interface {
 	SendRequest(ctx context.Context, data RequestData, p *mserve.Pagination) *ResponseData
 	AddOauthClient(prefix string)
 	SetEndpoint(e string) error
+	// Use appends interceptors to the chain every request goes through
+	Use(interceptors ...Interceptor)
+	// Stream sends data and returns the body of the response unread
+	Stream(ctx context.Context, data RequestData) (io.ReadCloser, http.Header, error)
 }
 
 type MockClient struct {
@@ -42,6 +51,14 @@ func (m MockClient) AddOauthClient(prefix string) {
 
 }
 
+func (m MockClient) Use(interceptors ...Interceptor) {
+
+}
+
+func (m MockClient) Stream(ctx context.Context, data RequestData) (io.ReadCloser, http.Header, error) {
+	return io.NopCloser(bytes.NewReader(nil)), http.Header{}, nil
+}
+
 func NewMockClient() *MockClient {
 	return &MockClient{}
 }
@@ -83,18 +100,39 @@ type Client struct {
 	UseCookieJar bool
 	skipCache    bool
 	OAuthClient  *OAuthClient
+	interceptors []Interceptor
+	// Cache keeps GET responses, see LRUCache and DiskCache
+	Cache Cache
+	// CacheTTL is how long responses without Cache-Control max-age stay fresh
+	CacheTTL   time.Duration
+	cacheStats cacheCounters
+	// RetryPolicy of RequestWithRetry, DefaultRetryPolicy when nil
+	RetryPolicy *RetryPolicy
+	// CircuitBreaker, when set, stops requests to failing hosts
+	CircuitBreaker *CircuitBreaker
 }
 
-func NewWithFlags(prefix string, c *http.Client) (HttpClient, error) {
-	return nil, nil
+// Use appends interceptors to the chain of c. The first interceptor sees the
+// request first and the response last; CircuitBreaker and OAuthClient, when
+// set, run after all of them, then the response Cache, right before the
+// http.Client.
+func (c *Client) Use(interceptors ...Interceptor) {
+	c.interceptors = append(c.interceptors, interceptors...)
 }
 
-func Flags(prefix string) (*pflag.FlagSet, error) {
-	return mserve.BindFlagSet(prefix, BackOff{}, OAuthClient{})
+func (c *Client) roundTrip() RoundTrip {
+	return c.wrap(c.client.Do)
 }
-func (c *Client) AddOauthClient(prefix string) {
-	//TODO implement me
-	panic("implement me")
+
+// wrap puts the interceptors, CircuitBreaker and OAuthClient of c around do.
+func (c *Client) wrap(do RoundTrip) RoundTrip {
+	if c.OAuthClient != nil {
+		do = c.OAuthClient.Intercept(do)
+	}
+	if c.CircuitBreaker != nil {
+		do = c.CircuitBreaker.Intercept(do)
+	}
+	return chain(do, c.interceptors...)
 }
 
 func (c *Client) GetEndpoint() *url.URL {
@@ -109,33 +147,6 @@ func (c *Client) SetEndpoint(e string) error {
 	return nil
 }
 
-//func Flags(prefix string) *pflag.FlagSet {
-//	fs := pflag.NewFlagSet(prefix, pflag.ExitOnError)
-//	fs.String(GetFlagWithPrefix(prefix, "endpoint"), "http://127.0.0.1:8080", fmt.Sprintf("[%s]", strings.ToUpper(ToSnakeCase(GetFlagWithPrefix(prefix, "endpoint")))))
-//	fs.String(GetFlagWithPrefix(prefix, "service-name"), "default", fmt.Sprintf("[%s]", strings.ToUpper(ToSnakeCase(GetFlagWithPrefix(prefix, "service-name")))))
-//	fs.Bool(GetFlagWithPrefix(prefix, "use-cookie-jar"), false, fmt.Sprintf("[%s]", strings.ToUpper(ToSnakeCase(GetFlagWithPrefix(prefix, "use-cookie-jar")))))
-//	fs.Bool(GetFlagWithPrefix(prefix, "skip-cache"), false, fmt.Sprintf("[%s]", strings.ToUpper(ToSnakeCase(GetFlagWithPrefix(prefix, "use-cookie-jar")))))
-//	fs.Uint(GetFlagWithPrefix(prefix, "items-per-page"), 100, fmt.Sprintf("[%s]", strings.ToUpper(ToSnakeCase(GetFlagWithPrefix(prefix, "items-per-page")))))
-//
-//	fs.AddFlagSet(BackOffFlags(prefix))
-//	return fs
-//}
-//
-//func NewWithFlags(prefix string, client *http.Client) (*Client, error) {
-//	return New(
-//		viper.GetString(GetFlagWithPrefix(prefix, "endpoint")),
-//		viper.GetString(GetFlagWithPrefix(prefix, "service-name")),
-//		viper.GetUint(GetFlagWithPrefix(prefix, "items-per-page")),
-//		viper.GetBool(GetFlagWithPrefix(prefix, "use-cookie-jar")),
-//		client,
-//		NewBackoffFromFlags(prefix),
-//	)
-//}
-
-//func (c *Client) AddOauthClient(prefix string) {
-//	c.OAuthClient = NewOAuthClient(prefix)
-//}
-
 func New(endpoint, serviceName string, itemsPerPage uint, useCookieJar bool, client *http.Client, backoff *BackOff) (*Client, error) {
 	u, err := url.Parse(endpoint)
 	if err != nil {
@@ -152,7 +163,7 @@ func New(endpoint, serviceName string, itemsPerPage uint, useCookieJar bool, cli
 		}
 		client.Jar = jar
 	}
-	return &Client{
+	c := &Client{
 		endpoint:     u,
 		client:       client,
 		serviceName:  serviceName,
@@ -160,18 +171,56 @@ func New(endpoint, serviceName string, itemsPerPage uint, useCookieJar bool, cli
 		itemsPerPage: itemsPerPage,
 		CookieJar:    client.Jar,
 		UseCookieJar: useCookieJar,
-	}, nil
+	}
+	if UseResponseCache {
+		c.Cache = NewLRUCache(defaultCacheSize)
+	}
+	return c, nil
 }
 func (c *Client) SkipCache(skip bool) {
 	c.skipCache = skip
 }
-func (c *Client) CacheKey(data RequestData, p *mserve.Pagination) string {
-	var key string
-	key = c.endpoint.String() + data.Path + data.Method + MapToString(data.Params)
-	if p != nil {
-		key = fmt.Sprintf("%s%d%d", key, p.Page, p.Limit)
+
+// CacheKey identifies a request as it is sent, after the interceptors and
+// OAuthClient ran: its method, url, the cookies of the jar and every header
+// but the ones that change per request, e.g. X-Request-ID, so responses are
+// never shared between users, and a hash of its body.
+func (c *Client) CacheKey(req *http.Request) string {
+	var key strings.Builder
+	key.WriteString(req.Method + " " + req.URL.String())
+	names := make([]string, 0, len(req.Header))
+	for k := range req.Header {
+		if !cacheIgnoredHeaders[http.CanonicalHeaderKey(k)] {
+			names = append(names, k)
+		}
 	}
-	return key
+	sort.Strings(names)
+	for _, k := range names {
+		key.WriteString("\n" + http.CanonicalHeaderKey(k) + ": " + strings.Join(req.Header.Values(k), ", "))
+	}
+	if c.client.Jar != nil {
+		for _, cookie := range c.client.Jar.Cookies(req.URL) {
+			key.WriteString("\nCookie: " + cookie.Name + "=" + cookie.Value)
+		}
+	}
+	if req.GetBody != nil && req.ContentLength != 0 {
+		if body, err := req.GetBody(); err == nil {
+			sum := sha256.New()
+			_, _ = io.Copy(sum, body)
+			_ = body.Close()
+			key.WriteString("\n" + hex.EncodeToString(sum.Sum(nil)))
+		}
+	}
+	return key.String()
+}
+
+// cacheIgnoredHeaders are left out of CacheKey.
+var cacheIgnoredHeaders = map[string]bool{
+	"X-Request-Id":      true,
+	"Traceparent":       true,
+	"Tracestate":        true,
+	"If-None-Match":     true,
+	"If-Modified-Since": true,
 }
 
 func (c *Client) Request(ctx context.Context, data RequestData, p *mserve.Pagination, retry bool) (resp *ResponseData) {
@@ -181,68 +230,70 @@ func (c *Client) Request(ctx context.Context, data RequestData, p *mserve.Pagina
 	return c.SendRequest(ctx, data, p)
 }
 
-func (c *Client) RequestWithRetry(ctx context.Context, data RequestData, p *mserve.Pagination) (resp *ResponseData) {
-	_ = c.BackOff.Retry(ctx, func() error {
-		resp = c.SendRequest(ctx, data, p)
-		if resp.Status == http.StatusTooManyRequests {
-			return resp.Err
-		}
-		return nil
-	})
-	return
-}
-
 func (c *Client) SendRequest(ctx context.Context, data RequestData, p *mserve.Pagination) *ResponseData {
-	u, err := url.JoinPath(c.endpoint.String(), data.Path)
-	if err != nil {
-		return &ResponseData{Err: err}
-	}
-
 	if p == nil {
 		p = &mserve.Pagination{Limit: int(c.itemsPerPage)}
 	} else {
 		p.Limit = int(c.itemsPerPage)
 	}
-	if data.Headers == nil {
-		data.Headers = map[string]string{}
+	req, err := c.newRequest(ctx, data, p)
+	if err != nil {
+		return &ResponseData{Err: err, ErrStr: err.Error()}
+	}
+
+	do := RoundTrip(c.client.Do)
+	if c.Cache != nil && data.Method == http.MethodGet {
+		// the cache sees the request as sent, with the headers of the chain
+		do = c.cached(c.skipCache || data.SkipCache, do)
 	}
-	if data.Params == nil {
-		data.Params = map[string]string{}
+	resp := NewResponseData(c.wrap(do)(req))
+	if len(resp.Cookies) > 0 && c.UseCookieJar {
+		c.CookieJar.SetCookies(c.endpoint, resp.Cookies)
+	}
+	return resp
+}
+
+// newRequest builds the request of data, with the query parameters of p
+// unless it is nil.
+func (c *Client) newRequest(ctx context.Context, data RequestData, p *mserve.Pagination) (*http.Request, error) {
+	u, err := url.JoinPath(c.endpoint.String(), data.Path)
+	if err != nil {
+		return nil, err
 	}
 	var rawBody []byte
 	if data.Body != nil {
 		rawBody, err = json.Marshal(data.Body)
 		if err != nil {
-			return &ResponseData{Err: err}
+			return nil, err
 		}
 	}
 
 	req, err := http.NewRequestWithContext(ctx, data.Method, u, bytes.NewReader(rawBody))
 	if err != nil {
-		return &ResponseData{Err: err, ErrStr: err.Error()}
+		return nil, err
+	}
+	if rawBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range data.Headers {
+		req.Header.Set(k, v)
 	}
-
-	//for k, v := range data.Headers {
-	//	req.Header.Set(snakeCaseToHeader(ToSnakeCase(k)), v)
-	//}
 
 	queryParams := url.Values{}
-	data.Params["items_per_page"] = strconv.Itoa(int(p.Limit))
-	data.Params["page"] = strconv.Itoa(int(p.Page))
-
+	for k, v := range data.Query {
+		queryParams[k] = append([]string(nil), v...)
+	}
 	for k, v := range data.Params {
 		queryParams.Add(k, v)
 	}
-	req.URL.RawQuery = queryParams.Encode()
-	if c.OAuthClient != nil {
-		return c.OAuthClient.SendRequest(ctx, req, 0)
-	}
-
-	resp := NewResponseData(c.client.Do(req))
-	if len(resp.Cookies) > 0 && c.UseCookieJar {
-		c.CookieJar.SetCookies(c.endpoint, resp.Cookies)
+	if p != nil {
+		queryParams.Set("items_per_page", strconv.Itoa(int(p.Limit)))
+		if p.Page > 0 || !queryParams.Has("page") {
+			queryParams.Set("page", strconv.Itoa(int(p.Page)))
+		}
 	}
-	return resp
+	req.URL.RawQuery = queryParams.Encode()
+	return req, nil
 }
 
 func MapToString(m map[string]string) string {
@@ -0,0 +1,98 @@
+package clientpkg
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// StatusError is an HTTP status usable with errors.Is against an *APIError,
+// e.g. errors.Is(resp.Err, clientpkg.ErrNotFound).
+type StatusError int
+
+func (s StatusError) Error() string {
+	return fmt.Sprintf("%d %s", int(s), http.StatusText(int(s)))
+}
+
+var (
+	ErrBadRequest          error = StatusError(http.StatusBadRequest)
+	ErrUnauthorized        error = StatusError(http.StatusUnauthorized)
+	ErrForbidden           error = StatusError(http.StatusForbidden)
+	ErrNotFound            error = StatusError(http.StatusNotFound)
+	ErrConflict            error = StatusError(http.StatusConflict)
+	ErrUnprocessableEntity error = StatusError(http.StatusUnprocessableEntity)
+	ErrTooManyRequests     error = StatusError(http.StatusTooManyRequests)
+	// ErrServer matches every 5xx status
+	ErrServer = errors.New("server error")
+)
+
+// APIError is the error of a response with a status outside of 2xx, decoded
+// from bodies like {"message": ..., "details": ...} or the {"error": ...} of
+// mserve.WriteError.
+type APIError struct {
+	Status  int
+	Message string
+	// Details is the "details" of the body, raw JSON unless it is a string
+	Details   string
+	RequestID string
+	// Body is the response body as received
+	Body []byte
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status))
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Details != "" {
+		msg += " (" + e.Details + ")"
+	}
+	if e.RequestID != "" {
+		msg += " [request " + e.RequestID + "]"
+	}
+	return msg
+}
+
+// Is matches the StatusError of e.Status and ErrServer for 5xx statuses.
+func (e *APIError) Is(target error) bool {
+	if s, ok := target.(StatusError); ok {
+		return e.Status == int(s)
+	}
+	return target == ErrServer && e.Status >= http.StatusInternalServerError
+}
+
+const maxTextErrorLen = 512
+
+// newAPIError decodes the error body of resp. The request ID is taken from
+// the body, the X-Request-ID of the response or the one sent.
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	e := &APIError{Status: resp.StatusCode, Body: body}
+	if gjson.ValidBytes(body) {
+		for _, path := range []string{"message", "error", "data.message"} {
+			if v := gjson.GetBytes(body, path); v.Type == gjson.String && v.Str != "" {
+				e.Message = v.Str
+				break
+			}
+		}
+		if v := gjson.GetBytes(body, "details"); v.Exists() && v.Type != gjson.Null {
+			e.Details = v.String()
+			if v.Type != gjson.String {
+				e.Details = v.Raw
+			}
+		}
+		e.RequestID = gjson.GetBytes(body, "request_id").String()
+	} else if len(body) <= maxTextErrorLen {
+		// plain text, e.g. from http.Error
+		e.Message = strings.TrimSpace(string(body))
+	}
+	if e.RequestID == "" {
+		e.RequestID = resp.Header.Get("X-Request-ID")
+	}
+	if e.RequestID == "" && resp.Request != nil {
+		e.RequestID = resp.Request.Header.Get("X-Request-ID")
+	}
+	return e
+}
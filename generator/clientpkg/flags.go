@@ -0,0 +1,171 @@
+package clientpkg
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/DarlingGoose/mserve"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// Config is the flag bound configuration of NewWithFlags, flags are named
+// <prefix>-config-<field>, e.g. users-config-endpoint or USERS_CONFIG_ENDPOINT.
+type Config struct {
+	Endpoint     string `usage:"base url of the service"`
+	ServiceName  string `usage:"name of the service"`
+	ItemsPerPage uint   `usage:"page size of list requests, at most 1000"`
+	UseCookieJar bool   `usage:"keep the cookies set by the service"`
+	SkipCache    bool   `usage:"do not answer requests from the response cache"`
+	CacheSize    int    `usage:"number of GET responses cached in memory, 0 disables the cache"`
+}
+
+// OauthConfig is the flag bound OAuth configuration of NewWithFlags, flags
+// are named <prefix>-oauth-config-<field>. OAuth is enabled when TokenUrl or
+// AccessToken is set.
+type OauthConfig struct {
+	TokenUrl     string   `usage:"token endpoint of the client credentials and refresh grants"`
+	ClientId     string   `usage:"oauth client id"`
+	ClientSecret string   `usage:"oauth client secret"`
+	Scopes       []string `usage:"scopes requested with the client credentials grant"`
+	AccessToken  string   `usage:"initial access token"`
+	RefreshToken string   `usage:"refresh token"`
+	TokenFile    string   `usage:"file keeping the tokens between runs"`
+}
+
+// flagSets holds the flags Flags created per prefix, for NewWithFlags to read.
+var flagSets = struct {
+	sync.Mutex
+	m map[string]*pflag.FlagSet
+}{m: map[string]*pflag.FlagSet{}}
+
+// Flags returns the flags of NewWithFlags for prefix: Config, BackOff and
+// OauthConfig, and a flag per header, named <prefix>-<header>.
+func Flags(prefix string, headers ...string) (*pflag.FlagSet, error) {
+	config := Config{Endpoint: "http://127.0.0.1:8080", ServiceName: prefix, ItemsPerPage: 100}
+	backOff := *defaultBackOff
+	fs, err := mserve.BindFlagSet(prefix, &config, &backOff, &OauthConfig{})
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range headers {
+		name := GetFlagWithPrefix(prefix, h)
+		env := strings.ToUpper(ToSnakeCase(name))
+		fs.String(name, "", "["+env+"] "+h+" header sent with every request")
+		if err := viper.BindPFlag(name, fs.Lookup(name)); err != nil {
+			return nil, err
+		}
+		if err := viper.BindEnv(name, env); err != nil {
+			return nil, err
+		}
+	}
+	flagSets.Lock()
+	flagSets.m[prefix] = fs
+	flagSets.Unlock()
+	return fs, nil
+}
+
+// NewWithFlags returns a Client configured by the flags or environment
+// variables of Flags(prefix). A nil c uses a new http.Client.
+func NewWithFlags(prefix string, c *http.Client) (HttpClient, error) {
+	cmd, err := flagsCommand(prefix)
+	if err != nil {
+		return nil, err
+	}
+	config, err := mserve.LoadConfig[Config](cmd, prefix)
+	if err != nil {
+		return nil, err
+	}
+	backOff, err := mserve.LoadConfig[BackOff](cmd, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		c = &http.Client{}
+	}
+	client, err := New(config.Endpoint, config.ServiceName, config.ItemsPerPage, config.UseCookieJar, c, &backOff)
+	if err != nil {
+		return nil, err
+	}
+	client.SkipCache(config.SkipCache)
+	if config.CacheSize > 0 {
+		client.Cache = NewLRUCache(config.CacheSize)
+	}
+	client.OAuthClient, err = oauthFromFlags(cmd, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// AddOauthClient enables OAuth with the OauthConfig flags of prefix.
+func (c *Client) AddOauthClient(prefix string) {
+	cmd, err := flagsCommand(prefix)
+	if err == nil {
+		var oauth *OAuthClient
+		if oauth, err = oauthFromFlags(cmd, prefix); oauth != nil {
+			c.OAuthClient = oauth
+		}
+	}
+	if err != nil {
+		slog.Error("configuring oauth", "prefix", prefix, "err", err)
+	}
+}
+
+// flagsCommand wraps the flags of prefix for mserve.LoadConfig, creating them
+// when Flags was not called.
+func flagsCommand(prefix string) (*cobra.Command, error) {
+	flagSets.Lock()
+	fs := flagSets.m[prefix]
+	flagSets.Unlock()
+	if fs == nil {
+		var err error
+		if fs, err = Flags(prefix); err != nil {
+			return nil, err
+		}
+	}
+	cmd := &cobra.Command{}
+	cmd.Flags().AddFlagSet(fs)
+	return cmd, nil
+}
+
+func oauthFromFlags(cmd *cobra.Command, prefix string) (*OAuthClient, error) {
+	config, err := mserve.LoadConfig[OauthConfig](cmd, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if config.TokenUrl == "" && config.AccessToken == "" {
+		return nil, nil
+	}
+	oauth := NewOAuthClient(config.AccessToken, config.RefreshToken, config.ClientId, config.ClientSecret, config.TokenUrl)
+	oauth.Scopes = config.Scopes
+	if config.TokenFile != "" {
+		oauth.Store = FileTokenStore(config.TokenFile)
+	}
+	return oauth, nil
+}
+
+// HeaderValues returns the values of the header flags of Flags(prefix).
+func HeaderValues(prefix string, headers ...string) map[string]string {
+	values := map[string]string{}
+	for _, h := range headers {
+		if v := viper.GetString(GetFlagWithPrefix(prefix, h)); v != "" {
+			values[h] = v
+		}
+	}
+	return values
+}
+
+// GetFlagWithPrefix returns the name of flag name of prefix, in kebab case.
+func GetFlagWithPrefix(prefix, name string) string {
+	return mserve.ToKebabCase(prefix) + "-" + mserve.ToKebabCase(name)
+}
+
+// ToSnakeCase converts "PascalCase", "camelCase" or "kebab-case" to
+// "snake_case".
+func ToSnakeCase(s string) string {
+	return strings.ReplaceAll(mserve.ToKebabCase(s), "-", "_")
+}
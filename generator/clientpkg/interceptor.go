@@ -0,0 +1,100 @@
+package clientpkg
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RoundTrip sends req and returns its response, like http.RoundTripper.
+type RoundTrip func(req *http.Request) (*http.Response, error)
+
+// Interceptor wraps the RoundTrip of a Client, e.g. to change the request
+// before calling next or to inspect the response it returns.
+type Interceptor func(next RoundTrip) RoundTrip
+
+// chain wraps do with interceptors, the first one being the outermost.
+func chain(do RoundTrip, interceptors ...Interceptor) RoundTrip {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		do = interceptors[i](do)
+	}
+	return do
+}
+
+// BearerToken sets the Authorization header of every request to token.
+func BearerToken(token string) Interceptor {
+	return func(next RoundTrip) RoundTrip {
+		return func(req *http.Request) (*http.Response, error) {
+			req.Header.Set("Authorization", "Bearer "+token)
+			return next(req)
+		}
+	}
+}
+
+// APIKey sends key in header, X-API-Key when header is empty.
+func APIKey(header, key string) Interceptor {
+	if header == "" {
+		header = "X-API-Key"
+	}
+	return Headers(map[string]string{header: key})
+}
+
+// Headers sets headers on every request, replacing values already set.
+func Headers(headers map[string]string) Interceptor {
+	return func(next RoundTrip) RoundTrip {
+		return func(req *http.Request) (*http.Response, error) {
+			for k, v := range headers {
+				req.Header.Set(k, v)
+			}
+			return next(req)
+		}
+	}
+}
+
+// RequestID sets header, X-Request-ID when empty, to a new uuid unless the
+// request already carries one.
+func RequestID(header string) Interceptor {
+	if header == "" {
+		header = "X-Request-ID"
+	}
+	return func(next RoundTrip) RoundTrip {
+		return func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get(header) == "" {
+				req.Header.Set(header, uuid.New().String())
+			}
+			return next(req)
+		}
+	}
+}
+
+// Logger logs every request with its status and duration, failed ones at
+// error level. slog.Default is used when logger is nil.
+func Logger(logger *slog.Logger) Interceptor {
+	return func(next RoundTrip) RoundTrip {
+		return func(req *http.Request) (*http.Response, error) {
+			l := logger
+			if l == nil {
+				l = slog.Default()
+			}
+			start := time.Now()
+			resp, err := next(req)
+			attrs := []any{"method", req.Method, "url", req.URL.Redacted(), "duration", time.Since(start)}
+			if id := req.Header.Get("X-Request-ID"); id != "" {
+				attrs = append(attrs, "request_id", id)
+			}
+			if err != nil {
+				l.ErrorContext(req.Context(), "request failed", append(attrs, "err", err)...)
+				return resp, err
+			}
+			attrs = append(attrs, "status", resp.StatusCode)
+			if resp.StatusCode >= http.StatusInternalServerError {
+				l.ErrorContext(req.Context(), "request", attrs...)
+			} else {
+				l.DebugContext(req.Context(), "request", attrs...)
+			}
+			return resp, err
+		}
+	}
+}
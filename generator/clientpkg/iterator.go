@@ -3,53 +3,96 @@ package clientpkg
 import (
 	"context"
 	"encoding/json"
+	"iter"
+	"net/url"
 
 	"github.com/DarlingGoose/mserve"
 )
 
+// Iterator walks the items of a list response page by page, or holds the
+// single item of any other response. The first page is requested by
+// NewIterator, the others as Next reaches them. Lists are paginated by page
+// number, or by cursor once a response carries Pagination.NextCursor.
 type Iterator[T any] struct {
 	ctx         context.Context
 	err         error
 	client      HttpClient
 	current     *T
-	currentItem int
-	currentPage uint
+	RequestData RequestData
+	message     string
+	retry       bool
 
-	totalItems   int
-	offset       int
-	currentPages []*T
-	singlePage   bool
-	retry        bool
-	RequestData  RequestData
-	message      string
+	// items of the current page, index of current in them
+	items   []*T
+	index   int
+	started bool
+
+	// info of the current page, page its number
+	info     *mserve.Pagination
+	page     int
+	lastPage int
+	last     bool
+
+	cursorParam string
+	nextCursor  string
+
+	prefetch int
+	pending  map[int]chan iteratorPage[T]
+}
+
+// iteratorPage is a fetched page.
+type iteratorPage[T any] struct {
+	number  int
+	items   []*T
+	single  bool
+	info    *mserve.Pagination
+	limit   int
+	message string
+	err     error
 }
 
 func NewIterator[T any](ctx context.Context, client HttpClient, data RequestData) *Iterator[T] {
 	it := &Iterator[T]{
-		ctx:          ctx,
-		client:       client,
-		currentPages: make([]*T, 0),
-		RequestData:  data,
+		ctx:         ctx,
+		client:      client,
+		RequestData: data,
+		cursorParam: "cursor",
+		pending:     map[int]chan iteratorPage[T]{},
 	}
-	it.getPages()
+	it.apply(it.fetch(1, ""))
 	return it
 }
 
+// WithRetry retries the requests of the following pages, see
+// Client.RequestWithRetry.
 func (i *Iterator[T]) WithRetry() *Iterator[T] {
 	i.retry = true
 	return i
 }
+
+// WithPrefetch requests up to n pages ahead of the current one concurrently,
+// once the number of pages is known. Cursor paginated lists are fetched one
+// page after the other regardless.
+func (i *Iterator[T]) WithPrefetch(n int) *Iterator[T] {
+	i.prefetch = max(n, 0)
+	return i
+}
+
+// WithCursor names the query parameter the cursor of the next page is sent
+// in, "cursor" by default.
+func (i *Iterator[T]) WithCursor(param string) *Iterator[T] {
+	i.cursorParam = param
+	return i
+}
+
+// Current returns the item Next moved to, or the first item before Next was
+// called, e.g. the body of a response that is not a list.
 func (i *Iterator[T]) Current() *T {
-	if i.current == nil {
-		if len(i.currentPages) == 0 {
-			if !i.getPages() {
-				return nil
-			}
-		}
-		if i.currentItem-i.offset >= len(i.currentPages) {
+	if !i.started {
+		if len(i.items) == 0 {
 			return nil
 		}
-		i.current = i.currentPages[i.currentItem-i.offset]
+		return i.items[0]
 	}
 	return i.current
 }
@@ -62,94 +105,178 @@ func (i *Iterator[T]) Err() error {
 	return i.err
 }
 
+// Total returns the number of items the server reported, 0 when unknown.
+func (i *Iterator[T]) Total() int {
+	if i.info == nil {
+		return 0
+	}
+	return i.info.Total
+}
+
+// Page returns the pagination of the current page.
+func (i *Iterator[T]) Page() *mserve.Pagination {
+	return i.info
+}
+
+// FullList returns the items Next has not reached yet, fetching every
+// remaining page.
 func (i *Iterator[T]) FullList() ([]*T, error) {
 	var fullList []*T
-	fullList = append(fullList, i.currentPages...)
-	for i.Next() {
-		current := i.Current()
-		if current != nil {
-			fullList = append(fullList, current)
+	for item, err := range i.All() {
+		if err != nil {
+			return nil, err
 		}
-	}
-	if i.Err() != nil {
-		return nil, i.Err()
+		fullList = append(fullList, item)
 	}
 	return fullList, nil
 }
 
-func (i *Iterator[T]) Next() bool {
-	if i.singlePage {
-		return false
-	}
-	//todo fix
-	if i.totalItems == 0 {
-		if !i.getPages() {
-			return false
-		}
-		if len(i.currentPages) == 0 {
-			return false
-		}
-		i.current = i.currentPages[i.currentItem-i.offset]
-		return true
-	}
-	if i.currentItem < i.totalItems {
-		i.currentItem += 1
-		if i.currentItem-i.offset >= len(i.currentPages) {
-			if !i.getPages() {
-				return false
+// All yields the items Next would, followed by the error that ended the
+// iteration, if any:
+//
+//	for item, err := range it.All() {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+func (i *Iterator[T]) All() iter.Seq2[*T, error] {
+	return func(yield func(*T, error) bool) {
+		for i.Next() {
+			if !yield(i.current, nil) {
+				return
 			}
 		}
-		if i.currentItem-i.offset >= len(i.currentPages) {
+		if i.err != nil {
+			yield(nil, i.err)
+		}
+	}
+}
+
+// Next moves to the next item, requesting the next page when the current one
+// is used up. It returns false after the last item or on an error, see Err.
+func (i *Iterator[T]) Next() bool {
+	if i.started {
+		i.index++
+	}
+	i.started = true
+	for i.index >= len(i.items) {
+		if !i.nextPage() {
+			i.current = nil
 			return false
 		}
-		i.current = i.currentPages[i.currentItem-i.offset]
-		return true
 	}
-	return false
+	i.current = i.items[i.index]
+	return true
 }
 
-// todo support cookies
-func (i *Iterator[T]) getPages() bool {
-	data := i.client.Request(i.ctx, i.RequestData, i.nextPage(), i.retry)
-	if data.Err != nil {
-		i.err = data.Err
-		i.message = data.Message
+func (i *Iterator[T]) nextPage() bool {
+	if i.err != nil || i.last {
 		return false
-	} else {
-		i.message = data.Message
-		if len(data.Data) == 0 {
-			return false
+	}
+	if i.nextCursor != "" {
+		return i.apply(i.fetch(i.page+1, i.nextCursor))
+	}
+	return i.apply(i.pageNumber(i.page + 1))
+}
+
+// pageNumber returns page n, started ahead of time when prefetching, and
+// starts prefetching the pages after it.
+func (i *Iterator[T]) pageNumber(n int) iteratorPage[T] {
+	ch, ok := i.pending[n]
+	if !ok {
+		ch = i.start(n)
+	}
+	delete(i.pending, n)
+	for k := n + 1; k <= n+i.prefetch && k <= i.lastPage; k++ {
+		if _, ok := i.pending[k]; !ok {
+			i.pending[k] = i.start(k)
 		}
-		i.err = json.Unmarshal(data.Data, &i.currentPages)
-		if i.err != nil {
-			var single T
-			//logic to read single response
-			tmpErr := json.Unmarshal(data.Data, &single)
-			if tmpErr != nil {
-				return false
-			}
-			i.err = nil
-			i.singlePage = true
-			i.currentPages = []*T{&single}
-			return true
+	}
+	return <-ch
+}
+
+func (i *Iterator[T]) start(n int) chan iteratorPage[T] {
+	ch := make(chan iteratorPage[T], 1)
+	go func() {
+		ch <- i.fetch(n, "")
+	}()
+	return ch
+}
+
+// fetch requests page n, or the page of cursor when it is set. It does not
+// change i, pages are fetched concurrently when prefetching.
+func (i *Iterator[T]) fetch(n int, cursor string) iteratorPage[T] {
+	data := i.RequestData
+	p := &mserve.Pagination{Page: n}
+	if cursor != "" {
+		data.Query = url.Values{}
+		for k, v := range i.RequestData.Query {
+			data.Query[k] = v
 		}
-		i.totalItems = int(data.Page.Total)
+		data.Query.Set(i.cursorParam, cursor)
+		p.Page = 0
+	}
+	resp := i.client.Request(i.ctx, data, p, i.retry)
+	page := iteratorPage[T]{number: n, info: resp.Page, limit: p.Limit, message: resp.Message, err: resp.Err}
+	if page.err != nil || len(resp.Data) == 0 {
+		return page
+	}
+	if err := json.Unmarshal(resp.Data, &page.items); err != nil {
+		//logic to read single response
+		var single T
+		if json.Unmarshal(resp.Data, &single) != nil {
+			page.err = err
+			return page
+		}
+		page.items = []*T{&single}
+		page.single = true
+	}
+	return page
+}
 
-		i.offset = int((data.Page.Page - 1) * data.Page.Limit)
+// apply makes page the current one and works out whether it is the last.
+func (i *Iterator[T]) apply(page iteratorPage[T]) bool {
+	i.message = page.message
+	if page.err != nil {
+		i.err = page.err
+		return false
+	}
+	i.items, i.index = page.items, 0
+	i.page = page.number
+	if page.info != nil {
+		i.info = page.info
 	}
-	if i.err != nil {
+	switch {
+	case page.single:
+		i.last = true
+	case len(page.items) == 0:
+		i.last = true
 		return false
+	case page.info != nil && (page.info.NextCursor != "" || i.nextCursor != ""):
+		i.nextCursor = page.info.NextCursor
+		i.last = i.nextCursor == ""
+	default:
+		i.lastPage = lastPage(page.info)
+		if i.lastPage > 0 {
+			i.last = i.page >= i.lastPage
+		} else {
+			// no pagination reported, a short page is the last one
+			i.last = page.limit <= 0 || len(page.items) < page.limit
+		}
 	}
 	return true
 }
 
-func (i *Iterator[T]) nextPage() *mserve.Pagination {
-	if i.currentPage <= 0 {
-		i.currentPage = 1
-	}
-	page := &mserve.Pagination{
-		Page: int(i.currentPage),
+// lastPage returns the number of pages of info, 0 when unknown.
+func lastPage(info *mserve.Pagination) int {
+	switch {
+	case info == nil:
+		return 0
+	case info.TotalPages > 0:
+		return info.TotalPages
+	case info.Total > 0 && info.Limit > 0:
+		return (info.Total + info.Limit - 1) / info.Limit
 	}
-	i.currentPage += 1
-	return page
+	return 0
 }
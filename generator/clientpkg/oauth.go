@@ -1,24 +1,64 @@
 package clientpkg
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
 )
 
+// tokenExpiryLeeway is how long before it expires a token is renewed.
+const tokenExpiryLeeway = 30 * time.Second
+
+// Token is an OAuth access token with what is needed to renew it.
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at,omitempty"`
+}
+
+// TokenStore persists tokens between runs. Load returns nil without error
+// when nothing is stored yet.
+type TokenStore interface {
+	Load(ctx context.Context) (*Token, error)
+	Save(ctx context.Context, t *Token) error
+}
+
+// OAuthClient authenticates requests with a Bearer token, obtained with the
+// client credentials grant or renewed with the refresh token grant at
+// OAuthEndpoint. Tokens are renewed shortly before ExpiresAt and after a 401.
+// Its fields are read when the first token is needed and must not be changed
+// afterwards; it is safe for concurrent use.
 type OAuthClient struct {
 	AccessToken   string
 	RefreshToken  string
 	ClientId      string
 	ClientSecret  string
 	OAuthEndpoint string
+	// Scopes requested with the client credentials grant
+	Scopes []string
+	// ExpiresAt of AccessToken, zero when unknown
+	ExpiresAt time.Time
+	// Store, when set, provides the first token and keeps renewed ones
+	Store TokenStore
+
+	mu     sync.Mutex
+	loaded bool
 }
 
-func NewOAuthClient(token, refreshToken, clientId, clientSecret, endpoint string) OAuthClient {
-	return OAuthClient{
+func NewOAuthClient(token, refreshToken, clientId, clientSecret, endpoint string) *OAuthClient {
+	return &OAuthClient{
 		AccessToken:   token,
 		RefreshToken:  refreshToken,
 		ClientId:      clientId,
@@ -27,87 +67,231 @@ func NewOAuthClient(token, refreshToken, clientId, clientSecret, endpoint string
 	}
 }
 
-// sendRequest sends an HTTP request with the current Bearer token
-func (client *OAuthClient) SendRequest(ctx context.Context, req *http.Request, depth int) *ResponseData {
-	req = req.WithContext(ctx)
-	// Set the Authorization header with Bearer token
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", client.AccessToken))
-
-	// Send the request
-	httpClient := &http.Client{}
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return NewResponseData(nil, err)
-	}
-
-	// Check if we got a 401 with an invalid access token message
-	if resp.StatusCode == http.StatusUnauthorized && depth == 0 {
-		defer resp.Body.Close()
-		bodyBytes, _ := io.ReadAll(req.Body)
-		var respBody map[string]interface{}
-		err = json.Unmarshal(bodyBytes, &respBody)
+// Intercept sends requests with the current Bearer token, renewing it first
+// when it is about to expire and once more when the server answers 401. The
+// token requests go through next too, so they use the transport of the
+// Client.
+func (client *OAuthClient) Intercept(next RoundTrip) RoundTrip {
+	return func(req *http.Request) (*http.Response, error) {
+		token, err := client.token(req.Context(), next, "")
 		if err != nil {
-			return NewResponseData(nil, err)
+			return nil, err
+		}
+		// Set the Authorization header with Bearer token
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		resp, err := next(req)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized || !client.canRenew() {
+			return resp, err
 		}
-		if msg, ok := respBody["message"].(string); ok && msg == "invalid access_token" {
-			// Token is invalid, we need to refresh
-			//fmt.Println("Invalid access token, attempting to refresh token...")
-			if err := client.refreshAccessToken(); err != nil {
-				return NewResponseData(nil, err)
+
+		// Token is invalid, we need to renew it
+		renewed, err := client.token(req.Context(), next, token)
+		if err != nil || renewed == token {
+			return resp, nil
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		// Retry the request with the new token
+		retry := req.Clone(req.Context())
+		if req.GetBody != nil {
+			if retry.Body, err = req.GetBody(); err != nil {
+				return nil, err
 			}
-			// Retry the request with the new token
-			return client.SendRequest(ctx, req, depth+1)
 		}
+		retry.Header.Set("Authorization", fmt.Sprintf("Bearer %s", renewed))
+		return next(retry)
 	}
+}
 
-	return NewResponseData(resp, nil)
+// Token returns the current access token, renewed when it is about to expire.
+func (client *OAuthClient) Token(ctx context.Context, httpClient *http.Client) (string, error) {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return client.token(ctx, httpClient.Do, "")
 }
 
-// refreshAccessToken sends a request to the OAuth server to refresh the token
-func (client *OAuthClient) refreshAccessToken() error {
-	// Prepare refresh token payload
-	refreshPayload := map[string]string{
-		"grant_type":    "refresh_token",
-		"refresh_token": client.RefreshToken,
-		"client_id":     client.ClientId,
-		"client_secret": client.ClientSecret,
+// token returns a valid access token. A non-empty stale token, rejected by
+// the server, is renewed unless another request already replaced it.
+func (client *OAuthClient) token(ctx context.Context, do RoundTrip, stale string) (string, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if !client.loaded {
+		client.loaded = true
+		if err := client.load(ctx); err != nil {
+			return "", err
+		}
 	}
 
-	payloadBytes, err := json.Marshal(refreshPayload)
+	now := time.Now()
+	valid := client.AccessToken != "" && (client.ExpiresAt.IsZero() || now.Before(client.ExpiresAt))
+	if stale != "" && client.AccessToken != stale {
+		return client.AccessToken, nil
+	}
+	expiring := !client.ExpiresAt.IsZero() && now.Add(tokenExpiryLeeway).After(client.ExpiresAt)
+	if stale == "" && client.AccessToken != "" && !expiring {
+		return client.AccessToken, nil
+	}
+	if !client.canRenewLocked() {
+		if valid {
+			return client.AccessToken, nil
+		}
+		return "", errors.New("oauth: no valid access token and no refresh token or client credentials to get one")
+	}
+
+	if err := client.renew(ctx, do); err != nil {
+		if valid && stale == "" {
+			// proactive renewal failed, the token still works for now
+			slog.Warn("renewing access token", "err", err)
+			return client.AccessToken, nil
+		}
+		return "", err
+	}
+	return client.AccessToken, nil
+}
+
+func (client *OAuthClient) load(ctx context.Context) error {
+	if client.Store == nil {
+		return nil
+	}
+	t, err := client.Store.Load(ctx)
 	if err != nil {
+		return fmt.Errorf("oauth: loading token: %w", err)
+	}
+	if t == nil || t.AccessToken == "" {
+		return nil
+	}
+	client.AccessToken, client.ExpiresAt = t.AccessToken, t.ExpiresAt
+	if t.RefreshToken != "" {
+		client.RefreshToken = t.RefreshToken
+	}
+	return nil
+}
+
+func (client *OAuthClient) canRenew() bool {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return client.canRenewLocked()
+}
+
+func (client *OAuthClient) canRenewLocked() bool {
+	return client.OAuthEndpoint != "" && (client.RefreshToken != "" || client.ClientId != "" && client.ClientSecret != "")
+}
+
+// renew gets a new token with the refresh token, falling back to the client
+// credentials, and saves it in Store.
+func (client *OAuthClient) renew(ctx context.Context, do RoundTrip) error {
+	var err error
+	if client.RefreshToken != "" {
+		err = client.grant(ctx, do, url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {client.RefreshToken},
+		})
+		if err == nil || client.ClientId == "" || client.ClientSecret == "" {
+			return client.saved(ctx, err)
+		}
+		slog.Debug("refresh token rejected, using client credentials", "err", err)
+	}
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(client.Scopes) > 0 {
+		form.Set("scope", strings.Join(client.Scopes, " "))
+	}
+	return client.saved(ctx, client.grant(ctx, do, form))
+}
+
+func (client *OAuthClient) saved(ctx context.Context, err error) error {
+	if err != nil || client.Store == nil {
 		return err
 	}
+	if err := client.Store.Save(ctx, &Token{AccessToken: client.AccessToken, RefreshToken: client.RefreshToken, ExpiresAt: client.ExpiresAt}); err != nil {
+		slog.Warn("saving access token", "err", err)
+	}
+	return nil
+}
 
-	req, err := http.NewRequest("POST", client.OAuthEndpoint, bytes.NewBuffer(payloadBytes))
+// grant sends a token request and keeps the token of the response.
+func (client *OAuthClient) grant(ctx context.Context, do RoundTrip, form url.Values) error {
+	if client.ClientId != "" {
+		form.Set("client_id", client.ClientId)
+	}
+	if client.ClientSecret != "" {
+		form.Set("client_secret", client.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, client.OAuthEndpoint, strings.NewReader(form.Encode()))
 	if err != nil {
 		return err
 	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
 
-	req.Header.Set("Content-Type", "application/json")
-
-	httpClient := &http.Client{}
-	resp, err := httpClient.Do(req)
+	resp, err := do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
-
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	if err != nil {
+		return err
+	}
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to refresh token, status: %d", resp.StatusCode)
+		return fmt.Errorf("oauth %s grant: %w", form.Get("grant_type"), newAPIError(resp, body))
 	}
 
-	var respBody map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
-		return err
+	// tokens may come in the data of an mserve envelope
+	result := gjson.ParseBytes(body)
+	if data := result.Get("data"); data.IsObject() {
+		result = data
+	}
+	accessToken := result.Get("access_token").String()
+	if accessToken == "" {
+		return fmt.Errorf("access token not found in %s response", form.Get("grant_type"))
+	}
+	client.AccessToken = accessToken
+	if refreshToken := result.Get("refresh_token").String(); refreshToken != "" {
+		client.RefreshToken = refreshToken
+	}
+	client.ExpiresAt = time.Time{}
+	if expiresIn := result.Get("expires_in").Int(); expiresIn > 0 {
+		client.ExpiresAt = time.Now().Add(time.Duration(expiresIn) * time.Second)
 	}
+	slog.Debug("access token renewed", "grant_type", form.Get("grant_type"), "expires_at", client.ExpiresAt)
+	return nil
+}
+
+// FileTokenStore keeps the token as JSON in a file only the user can read.
+type FileTokenStore string
 
-	// Update the access token
-	if newAccessToken, ok := respBody["access_token"].(string); ok {
-		client.AccessToken = newAccessToken
-		fmt.Println("Access token refreshed successfully")
-	} else {
-		return fmt.Errorf("access token not found in refresh response")
+func (f FileTokenStore) Load(ctx context.Context) (*Token, error) {
+	data, err := os.ReadFile(string(f))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
 	}
+	var t Token
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("%s: %w", f, err)
+	}
+	return &t, nil
+}
 
-	return nil
+func (f FileTokenStore) Save(ctx context.Context, t *Token) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	if err := ensureDir(filepath.Dir(string(f))); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(string(f)), "."+filepath.Base(string(f))+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err = errors.Join(err, tmp.Close()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), string(f))
 }
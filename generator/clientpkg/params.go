@@ -0,0 +1,71 @@
+package clientpkg
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+)
+
+// AddQuery adds value to q under key. nil pointers, empty strings and empty
+// slices are left out, slices add one value per element.
+func AddQuery(q url.Values, key string, value any) {
+	for _, v := range paramValues(value) {
+		q.Add(key, v)
+	}
+}
+
+// AddHeader sets value as header key, left out like in AddQuery. Slices are
+// joined with commas.
+func AddHeader(h map[string]string, key string, value any) {
+	values := paramValues(value)
+	if len(values) == 0 {
+		return
+	}
+	out := values[0]
+	for _, v := range values[1:] {
+		out += "," + v
+	}
+	h[key] = out
+}
+
+// paramValues formats a query or header value.
+func paramValues(value any) []string {
+	if value == nil {
+		return nil
+	}
+	if s, ok := value.(fmt.Stringer); ok {
+		if rv := reflect.ValueOf(value); rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return nil
+		}
+		return []string{s.String()}
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+		return paramValues(rv.Elem().Interface())
+	case reflect.Slice, reflect.Array:
+		var out []string
+		for i := 0; i < rv.Len(); i++ {
+			out = append(out, paramValues(rv.Index(i).Interface())...)
+		}
+		return out
+	case reflect.String:
+		if rv.Len() == 0 {
+			return nil
+		}
+		return []string{rv.String()}
+	case reflect.Bool:
+		return []string{strconv.FormatBool(rv.Bool())}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return []string{strconv.FormatInt(rv.Int(), 10)}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return []string{strconv.FormatUint(rv.Uint(), 10)}
+	case reflect.Float32, reflect.Float64:
+		return []string{strconv.FormatFloat(rv.Float(), 'f', -1, 64)}
+	}
+	return []string{fmt.Sprint(value)}
+}
@@ -2,22 +2,22 @@ package clientpkg
 
 import (
 	"encoding/json"
-	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
-	"path"
 
 	"github.com/DarlingGoose/mserve"
-	"github.com/google/uuid"
 	"github.com/tidwall/gjson"
 )
 
 type RequestData struct {
-	Path      string
-	Method    string
-	Body      interface{}
-	Params    map[string]string
+	Path   string
+	Method string
+	Body   interface{}
+	Params map[string]string
+	// Query holds typed query parameters of generated clients, sent along with Params
+	Query     url.Values
 	Headers   map[string]string
 	SkipCache bool
 }
@@ -34,25 +34,22 @@ func NewRequestData(path, method string, body interface{}, params, headers map[s
 }
 
 type ResponseData struct {
-	Status   int
-	Page     *mserve.Pagination
-	Message  string
-	Err      error `json:"-"`
-	ErrStr   string
-	Data     []byte
-	Cookies  []*http.Cookie `json:"-"`
-	FilePath string
+	Status  int
+	Page    *mserve.Pagination
+	Message string
+	Err     error `json:"-"`
+	ErrStr  string
+	Data    []byte
+	Cookies []*http.Cookie `json:"-"`
+	// Header holds the headers of the response, e.g. Retry-After
+	Header http.Header `json:"-"`
 }
 
-func (d *ResponseData) Close() {
-	if d.FilePath != "" {
-		if _, err := os.Stat(d.FilePath); os.IsNotExist(err) {
-			return
-		}
-		_ = os.Remove(d.FilePath)
-	}
-
-}
+// Close is kept for callers of the time responses could be written to disk.
+//
+// Deprecated: bodies are no longer written to files, use Client.Stream or
+// Download for files.
+func (d *ResponseData) Close() {}
 
 // Helper: Ensure directory exists or create it
 func ensureDir(dir string) error {
@@ -61,27 +58,10 @@ func ensureDir(dir string) error {
 	}
 	return nil
 }
-func IsImageFile(resp *http.Response) (bool, string) {
-	switch resp.Header.Get("Content-Type") {
-	case "image/jpeg":
-		return true, ".jpg"
-	case "image/png":
-		return true, ".png"
-	case "image/gif":
-		return true, ".gif"
-	case "image/webp":
-		return true, ".webp"
-	case "image/bmp":
-		return true, ".bmp"
-	case "image/tiff":
-		return true, ".tiff"
-	case "image/x-icon":
-		return true, ".ico"
-	case "image/svg+xml":
-		return true, ".svg"
-	default:
-		return false, ""
-	}
+
+// IsSuccess reports whether status is a 2xx status or 302 Found.
+func IsSuccess(status int) bool {
+	return status >= http.StatusOK && status < http.StatusMultipleChoices || status == http.StatusFound
 }
 
 func NewResponseData(resp *http.Response, err error) *ResponseData {
@@ -93,25 +73,13 @@ func NewResponseData(resp *http.Response, err error) *ResponseData {
 	}()
 	rd := &ResponseData{
 		Status: resp.StatusCode,
+		Header: resp.Header,
 		Page:   nil,
 		Err:    nil,
 		Data:   nil,
 	}
 	var responseData []byte
 	if resp.Body != nil {
-		isImage, ext := IsImageFile(resp)
-		if isImage {
-			name := uuid.New().String() + ext
-			dir := "/" + path.Join("tmp", "img")
-			_ = ensureDir(dir)
-			p := path.Join(dir, name)
-			err = DownloadImageFromResponse(resp, p)
-			if err != nil {
-				rd.Err = err
-				return rd
-			}
-			rd.FilePath = p
-		}
 		responseData, err = io.ReadAll(resp.Body)
 		if err != nil {
 			rd.Err = err
@@ -119,45 +87,38 @@ func NewResponseData(resp *http.Response, err error) *ResponseData {
 		}
 		rd.Message = gjson.GetBytes(responseData, "message").Raw
 	}
-	if !(resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusFound) {
-		rd.Err = fmt.Errorf("invalid Status code: %d", resp.StatusCode)
+	if !IsSuccess(resp.StatusCode) {
+		rd.Err = newAPIError(resp, responseData)
 		rd.ErrStr = rd.Err.Error()
 		return rd
 	}
 
 	rd.Page = &mserve.Pagination{}
-	if data := gjson.GetBytes(responseData, "page").Raw; len(data) > 0 {
-		err = json.Unmarshal([]byte(data), &rd.Page)
-		if err != nil {
-			rd.Err = err
-			rd.ErrStr = rd.Err.Error()
-			return rd
-		}
+	body := gjson.ParseBytes(responseData)
+	data := body.Get("data")
+	if page := body.Get("page"); page.IsObject() {
+		err = json.Unmarshal([]byte(page.Raw), &rd.Page)
+	} else if isPage(body) {
+		// an mserve.Page written as is
+		data = body.Get("items")
+		err = json.Unmarshal(responseData, &rd.Page)
+	} else if isPage(data) {
+		data = data.Get("items")
+		err = json.Unmarshal([]byte(body.Get("data").Raw), &rd.Page)
+	}
+	if err != nil {
+		rd.Err = err
+		rd.ErrStr = rd.Err.Error()
+		return rd
 	}
 	resp.Cookies()
 	rd.Cookies = resp.Cookies()
-	rd.Data = []byte(gjson.GetBytes(responseData, "data").Raw)
+	rd.Data = []byte(data.Raw)
 	return rd
 }
 
-func DownloadImageFromResponse(resp *http.Response, filePath string) error {
-	// Ensure the HTTP response status is OK (status code 200)
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download image, status code: %d", resp.StatusCode)
-	}
-
-	// Create the output file
-	file, err := os.Create(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to create file: %v", err)
-	}
-	defer file.Close()
-
-	// Copy the image data from the HTTP response to the file
-	_, err = io.Copy(file, resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to copy image data: %v", err)
-	}
-
-	return nil
+// isPage reports whether v is shaped like mserve.Page: its items next to the
+// number of the page.
+func isPage(v gjson.Result) bool {
+	return v.IsObject() && v.Get("items").IsArray() && v.Get("page").Type == gjson.Number
 }
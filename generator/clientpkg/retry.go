@@ -0,0 +1,206 @@
+package clientpkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DarlingGoose/mserve"
+	backoff "github.com/cenkalti/backoff/v4"
+)
+
+// ErrCircuitOpen is returned for requests to a host whose CircuitBreaker is
+// open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// RetryPolicy decides which failed requests RequestWithRetry sends again.
+type RetryPolicy struct {
+	// Statuses are retried, connection errors always are
+	Statuses []int
+	// IdempotencyHeader marks POST and PATCH requests as safe to retry when
+	// set, other methods are idempotent already
+	IdempotencyHeader string
+	// MaxRetryAfter is the longest Retry-After waited for, a longer one ends
+	// the retries
+	MaxRetryAfter time.Duration
+}
+
+// DefaultRetryPolicy retries 429, 502, 503 and 504, POST and PATCH only with
+// an Idempotency-Key header, and waits up to a minute for Retry-After.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		Statuses:          []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		IdempotencyHeader: "Idempotency-Key",
+		MaxRetryAfter:     time.Minute,
+	}
+}
+
+// Idempotent reports whether data can be sent twice without side effects.
+func (p *RetryPolicy) Idempotent(data RequestData) bool {
+	switch data.Method {
+	case http.MethodPost, http.MethodPatch:
+	default:
+		return true
+	}
+	for k, v := range data.Headers {
+		if strings.EqualFold(k, p.IdempotencyHeader) && v != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Retryable reports whether resp failed in a way worth retrying.
+func (p *RetryPolicy) Retryable(resp *ResponseData) bool {
+	if resp.Status == 0 {
+		return resp.Err != nil && !errors.Is(resp.Err, context.Canceled) &&
+			!errors.Is(resp.Err, context.DeadlineExceeded) && !errors.Is(resp.Err, ErrCircuitOpen)
+	}
+	for _, s := range p.Statuses {
+		if resp.Status == s {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryAfter parses the Retry-After header of resp, in seconds or as a date.
+func RetryAfter(resp *ResponseData, now time.Time) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// RequestWithRetry sends data until it succeeds or c.RetryPolicy gives up,
+// waiting as c.BackOff says or as long as Retry-After asks. It returns the
+// last response.
+func (c *Client) RequestWithRetry(ctx context.Context, data RequestData, p *mserve.Pagination) (resp *ResponseData) {
+	policy := c.RetryPolicy
+	if policy == nil {
+		policy = DefaultRetryPolicy()
+	}
+	if !policy.Idempotent(data) {
+		return c.SendRequest(ctx, data, p)
+	}
+	_ = c.BackOff.Retry(ctx, func() error {
+		resp = c.SendRequest(ctx, data, p)
+		if !policy.Retryable(resp) {
+			return nil
+		}
+		err := resp.Err
+		if err == nil {
+			err = fmt.Errorf("status code: %d", resp.Status)
+		}
+		if after, ok := RetryAfter(resp, time.Now()); ok {
+			if after > policy.MaxRetryAfter {
+				return backoff.Permanent(err)
+			}
+			return &RetryAfterError{Err: err, After: after}
+		}
+		return err
+	})
+	return
+}
+
+// CircuitBreaker stops sending requests to a host after Threshold consecutive
+// connection errors or 5xx responses. After Cooldown one request is let
+// through, its success closes the circuit again.
+type CircuitBreaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*circuit
+}
+
+type circuit struct {
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewCircuitBreaker opens after threshold failures, 5 when not positive, for
+// cooldown, 30s when not positive.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	if threshold <= 0 {
+		threshold = 5
+	}
+	if cooldown <= 0 {
+		cooldown = 30 * time.Second
+	}
+	return &CircuitBreaker{Threshold: threshold, Cooldown: cooldown, hosts: map[string]*circuit{}}
+}
+
+// Allow returns ErrCircuitOpen while the circuit of host is open.
+func (cb *CircuitBreaker) Allow(host string) error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	c := cb.hosts[host]
+	if c == nil || c.failures < cb.Threshold {
+		return nil
+	}
+	if c.probing || time.Since(c.openedAt) < cb.Cooldown {
+		return fmt.Errorf("%w for %s", ErrCircuitOpen, host)
+	}
+	c.probing = true
+	return nil
+}
+
+// Report records the outcome of a request to host.
+func (cb *CircuitBreaker) Report(host string, failed bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.hosts == nil {
+		cb.hosts = map[string]*circuit{}
+	}
+	c := cb.hosts[host]
+	if !failed {
+		delete(cb.hosts, host)
+		return
+	}
+	if c == nil {
+		c = &circuit{}
+		cb.hosts[host] = c
+	}
+	c.failures++
+	c.probing = false
+	if c.failures >= cb.Threshold {
+		c.openedAt = time.Now()
+	}
+}
+
+// Intercept rejects requests to open circuits and reports the outcome of the
+// others.
+func (cb *CircuitBreaker) Intercept(next RoundTrip) RoundTrip {
+	return func(req *http.Request) (*http.Response, error) {
+		host := req.URL.Host
+		if err := cb.Allow(host); err != nil {
+			return nil, err
+		}
+		resp, err := next(req)
+		if err != nil && req.Context().Err() != nil {
+			// the caller gave up, that says nothing about the host
+			cb.mu.Lock()
+			if c := cb.hosts[host]; c != nil {
+				c.probing = false
+			}
+			cb.mu.Unlock()
+			return resp, err
+		}
+		cb.Report(host, err != nil || resp.StatusCode >= http.StatusInternalServerError)
+		return resp, err
+	}
+}
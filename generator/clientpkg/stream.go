@@ -0,0 +1,204 @@
+package clientpkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxErrorBody limits how much of an error response Stream reads.
+const maxErrorBody = 1 << 20
+
+// ErrResumeMismatch is returned by Download when the server rejects the Range
+// of Offset with a size other than Offset: what was downloaded so far is
+// longer than the resource, or the resource changed.
+var ErrResumeMismatch = errors.New("download cannot be resumed")
+
+// Stream sends data and returns the body of a successful response unread,
+// for files and other bodies that should not be held in memory. The caller
+// closes it. Failed responses are returned as *APIError. Stream bypasses the
+// cache and adds no pagination parameters.
+func (c *Client) Stream(ctx context.Context, data RequestData) (io.ReadCloser, http.Header, error) {
+	req, err := c.newRequest(ctx, data, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := c.roundTrip()(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.UseCookieJar {
+		if cookies := resp.Cookies(); len(cookies) > 0 {
+			c.CookieJar.SetCookies(c.endpoint, cookies)
+		}
+	}
+	if !IsSuccess(resp.StatusCode) {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return nil, resp.Header, newAPIError(resp, body)
+	}
+	return resp.Body, resp.Header, nil
+}
+
+// DownloadOptions configure Download and DownloadFile.
+type DownloadOptions struct {
+	// Offset is the number of bytes already downloaded, requested again from
+	// there with a Range header
+	Offset int64
+	// Progress is called after every write with the bytes written so far,
+	// Offset included, and the total size, -1 when unknown
+	Progress func(written, total int64)
+}
+
+// Download streams the body of data into w. With opts.Offset set only the
+// rest is requested; servers ignoring the Range get the first Offset bytes
+// skipped. It returns the number of bytes written to w.
+func Download(ctx context.Context, c HttpClient, data RequestData, w io.Writer, opts *DownloadOptions) (int64, error) {
+	if opts == nil {
+		opts = &DownloadOptions{}
+	}
+	offset := opts.Offset
+	if offset > 0 {
+		data.Headers = MergeMap(map[string]string{"Range": fmt.Sprintf("bytes=%d-", offset)}, data.Headers)
+	}
+	body, header, err := c.Stream(ctx, data)
+	var apiErr *APIError
+	if offset > 0 && errors.As(err, &apiErr) && apiErr.Status == http.StatusRequestedRangeNotSatisfiable {
+		// "bytes */size", nothing is left when size is where we stopped
+		size, ok := unsatisfiedRange(header)
+		if ok && size == offset {
+			return 0, nil
+		}
+		if !ok {
+			return 0, fmt.Errorf("%w: range from byte %d not satisfiable: %w", ErrResumeMismatch, offset, err)
+		}
+		return 0, fmt.Errorf("%w: %d bytes downloaded but the resource has %d", ErrResumeMismatch, offset, size)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	total := contentLength(header)
+	if offset > 0 {
+		if start, size, ok := contentRange(header); ok && start == offset {
+			switch {
+			case size >= 0:
+				total = size
+			case total >= 0:
+				total += offset
+			}
+		} else if _, err := io.CopyN(io.Discard, body, offset); err != nil {
+			// the server ignored the Range and sent everything
+			return 0, err
+		}
+	}
+	if opts.Progress != nil {
+		w = &progressWriter{w: w, written: offset, total: total, progress: opts.Progress}
+	}
+	return io.Copy(w, body)
+}
+
+// DownloadFile downloads the body of data to file.part and renames it to file
+// when complete, replacing file when it exists. A file.part left by an
+// interrupted call is resumed from its size, or downloaded again from the
+// start when Download reports ErrResumeMismatch.
+func DownloadFile(ctx context.Context, c HttpClient, data RequestData, file string, opts *DownloadOptions) (int64, error) {
+	if err := ensureDir(filepath.Dir(file)); err != nil {
+		return 0, err
+	}
+	part := file + ".part"
+	f, err := os.OpenFile(part, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	o := DownloadOptions{Offset: info.Size()}
+	if opts != nil {
+		o.Progress = opts.Progress
+	}
+	if _, err := f.Seek(o.Offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := Download(ctx, c, data, f, &o)
+	if errors.Is(err, ErrResumeMismatch) {
+		if err := f.Truncate(0); err != nil {
+			return 0, err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+		o.Offset = 0
+		n, err = Download(ctx, c, data, f, &o)
+	}
+	if err != nil {
+		return n, err
+	}
+	if err := f.Close(); err != nil {
+		return n, err
+	}
+	return n, os.Rename(part, file)
+}
+
+func contentLength(h http.Header) int64 {
+	if n, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); err == nil {
+		return n
+	}
+	return -1
+}
+
+// contentRange parses "Content-Range: bytes start-end/size", size is -1 for *.
+func contentRange(h http.Header) (start, size int64, ok bool) {
+	v, found := strings.CutPrefix(h.Get("Content-Range"), "bytes ")
+	if !found {
+		return 0, 0, false
+	}
+	rng, total, found := strings.Cut(v, "/")
+	first, _, found2 := strings.Cut(rng, "-")
+	if !found || !found2 {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	size, err = strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		size = -1
+	}
+	return start, size, true
+}
+
+// unsatisfiedRange parses the "Content-Range: bytes */size" of a 416.
+func unsatisfiedRange(h http.Header) (size int64, ok bool) {
+	v, found := strings.CutPrefix(h.Get("Content-Range"), "bytes */")
+	if !found {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(v, 10, 64)
+	return size, err == nil
+}
+
+type progressWriter struct {
+	w        io.Writer
+	written  int64
+	total    int64
+	progress func(written, total int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+	p.progress(p.written, p.total)
+	return n, err
+}
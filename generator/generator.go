@@ -1,18 +1,28 @@
 package generators
 
 import (
+	"os"
+	"path"
+	"path/filepath"
+
 	"github.com/DarlingGoose/mserve"
 )
 
 type Language string
 
 const (
-	LanguageGo = Language("go")
+	LanguageGo         = Language("go")
+	LanguageTypeScript = Language("typescript")
+	LanguagePython     = Language("python")
 )
 
 type GeneratorData struct {
 	ProjectName string
-	RootDir     string
+	// RootDir is the module path, e.g. github.com/DarlingGoose/mserve. Without
+	// ModuleDir it is looked up below $HOME/go/src.
+	RootDir string
+	// ModuleDir is the directory holding go.mod
+	ModuleDir   string
 	Title       string
 	Version     string
 	Description string
@@ -28,11 +38,32 @@ func NewGenData() GeneratorData {
 		Description: "",
 		Host:        "",
 	}
+	if wd, err := os.Getwd(); err == nil {
+		if m, err := FindModule(wd); err == nil {
+			gd.RootDir = m.Path
+			gd.ModuleDir = m.Dir
+			gd.ProjectName = path.Base(m.Path)
+			return gd
+		}
+	}
 	gd.RootDir, _ = GetRootDir()
 	gd.ProjectName, _ = GetProjectName()
 	return gd
 }
 
+// ProjectDir returns the directory of the project: ModuleDir, or RootDir below
+// $HOME/go/src for data that predates modules.
+func (d GeneratorData) ProjectDir() (string, error) {
+	if d.ModuleDir != "" {
+		return d.ModuleDir, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, "go", "src", d.RootDir), nil
+}
+
 type Generator interface {
 	Generate(data GeneratorData, endpoints ...mserve.Endpoint) error
 }
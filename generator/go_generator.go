@@ -15,11 +15,21 @@ import (
 
 	"github.com/DarlingGoose/mserve"
 	openai "github.com/sashabaranov/go-openai"
+	"github.com/spf13/pflag"
 )
 
 var _ Generator = GoClientGenerator{}
 
 type GoClientGenerator struct {
+	// OutDir is the directory, or import path within the module, the client
+	// package is written to. Defaults to pkg/<project>_client in the module.
+	OutDir string
+	// Package is the package name, defaults to the base name of OutDir
+	Package string
+	// Check compares the generated files with the ones on disk instead of
+	// writing them, Generate returns ErrOutOfDate when they differ
+	Check bool
+
 	client           *openai.Client
 	headers          []string
 	importOverwrides map[string]*Imports
@@ -50,12 +60,31 @@ var SwagApiGeneralTempl string = `
 /*
 Todo update gofunc template to support better godoc comments
 */
-const goFuncTemplate = `
-func (c *Client) {{.Name}}(ctx context.Context{{if .RequestType}}, {{.RequestTypeName}} {{.RequestType}}{{end}}{{range .MuxVars}}, {{.}} string{{end}}{{if .UsesQueryParams }}{{range $k, $v := .QueryParams}}, {{$v}} string{{end}}{{end}}{{if .UsesHeaderParams }}, headers map[string]string{{end}},skipCache bool) {{.Return}} {
-	path := {{.Path}}{{if .UsesQueryParams }}
-	params := map[string]string{}{{end}}{{range $k, $v := .QueryParams}}
-	params["{{$k}}"] = {{$v}}{{end}}
-	requestDataInternal := clientpkg.NewRequestData(path, http.Method{{.MethodType}}, {{if .RequestType}}{{.RequestTypeName}}{{else}}nil{{end}}, {{if .UsesQueryParams }} params{{else}}nil{{end}}, {{if .UsesHeaderParams }} clientpkg.MergeMap[string](headers,c.headers){{else}}clientpkg.MergeMap[string](nil,c.headers){{end}},skipCache){{if .UseIterator}}
+const goFuncTemplate = `{{range $enum := .Enums}}
+// {{$enum.Name}} is an allowed value of a parameter.
+type {{$enum.Name}} string
+
+const ({{range $enum.Values}}
+	{{.Const}} {{$enum.Name}} = {{printf "%q" .Value}}{{end}}
+)
+{{end}}{{if .OptionsType}}
+// {{.OptionsType}} are the optional query and header parameters of {{.Name}}, zero values are not sent.
+type {{.OptionsType}} struct { {{- range .Options}}{{if .Description}}
+	// {{.Field}} {{.Description}}{{end}}
+	{{.Field}} {{.Type}}{{end}}
+}
+{{end}}
+func (c *Client) {{.Name}}(ctx context.Context{{if .RequestType}}, {{.RequestTypeName}} {{.RequestType}}{{end}}{{range .MuxVars}}, {{.}} string{{end}}{{range .RequiredParams}}, {{.Arg}} {{.Type}}{{end}}{{if .OptionsType}}, opts *{{.OptionsType}}{{end}}, skipCache bool) {{.Return}} {
+	path := {{.Path}}{{if .UsesQueryParams}}
+	query := url.Values{}{{end}}{{if .UsesHeaderParams}}
+	headers := map[string]string{}{{end}}{{range .RequiredParams}}
+	clientpkg.{{if .Header}}AddHeader(headers{{else}}AddQuery(query{{end}}, {{printf "%q" .Name}}, {{.Arg}}){{end}}{{if .OptionsType}}
+	if opts != nil { {{- range .Options}}
+		clientpkg.{{if .Header}}AddHeader(headers{{else}}AddQuery(query{{end}}, {{printf "%q" .Name}}, opts.{{.Field}}){{end}}
+	}{{end}}
+	requestDataInternal := clientpkg.NewRequestData(path, http.Method{{.MethodType}}, {{if .RequestType}}{{.RequestTypeName}}{{else}}nil{{end}}, nil, clientpkg.MergeMap[string]({{if .UsesHeaderParams}}headers{{else}}nil{{end}}, c.headers), skipCache){{if .UsesQueryParams}}
+	requestDataInternal.Query = query{{end}}{{if .Stream}}
+	return c.base.Stream(ctx, requestDataInternal){{ else if .UseIterator}}
 	return clientpkg.NewIterator[{{.DataTypeName}}](ctx, c.base, requestDataInternal){{ else }}
 	return c.base.Request(ctx,requestDataInternal,nil,true){{ end }}
 }
@@ -77,16 +106,27 @@ func (g *GoClientGenerator) AddImportOverride(key string, im *Imports) {
 	g.importOverwrides[key] = im
 }
 
+// Flags returns the --client-out, --client-package and --check flags bound to g.
+func (g *GoClientGenerator) Flags() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("generate", pflag.ExitOnError)
+	fs.StringVar(&g.OutDir, "client-out", g.OutDir, "directory or import path the Go client is written to")
+	fs.StringVar(&g.Package, "client-package", g.Package, "package name of the Go client, defaults to the name of --client-out")
+	fs.BoolVar(&g.Check, "check", g.Check, "fail when the generated Go client is out of date instead of writing it")
+	return fs
+}
+
 func (g GoClientGenerator) Generate(data GeneratorData, endpoint ...mserve.Endpoint) error {
 	groupedEndpoints := groupEndpointsByGroup(endpoint) // Group by group name
-	publicDir, _, err := GetPublicPrivateDir(data)
+	publicDir, pkg, err := g.target(data)
 	if err != nil {
 		return err
 	}
 
+	files := map[string][]byte{}
 	for group, endpoints := range groupedEndpoints {
-		g.GenerateComments(data, endpoints...)
-		// Create public and private directories
+		if !g.Check {
+			g.GenerateComments(data, endpoints...)
+		}
 
 		var PublicFunctions []string
 		var publicImports []Imports
@@ -104,11 +144,20 @@ func (g GoClientGenerator) Generate(data GeneratorData, endpoint ...mserve.Endpo
 
 		}
 
-		if err := writeToGoFile(publicDir, group, PublicFunctions, true, g.importOverwrides, publicImports...); err != nil {
+		if err := addGoFile(files, publicDir, pkg, group, PublicFunctions, true, g.importOverwrides, publicImports...); err != nil {
 			return err
 		}
 	}
 
+	if err := g.addClientFile(files, publicDir, pkg, data); err != nil {
+		return err
+	}
+
+	return writeGenerated(publicDir, files, g.Check)
+}
+
+// addClientFile renders client.go, the Client type shared by the endpoint files.
+func (g GoClientGenerator) addClientFile(files map[string][]byte, dir, pkg string, data GeneratorData) error {
 	clientImports := []Imports{
 		{
 			Path: "context",
@@ -130,14 +179,6 @@ func (g GoClientGenerator) Generate(data GeneratorData, endpoint ...mserve.Endpo
 			Path: "time",
 		},
 	}
-	if len(g.headers) > 0 {
-		clientImports = append(clientImports, Imports{
-			Path: "strings",
-		})
-		//clientImports = append(clientImports, Imports{
-		//	Path: "github.com/spf13/viper",
-		//})
-	}
 	clientTemplates, err := templ(map[string]interface{}{
 		"Name":    data.ProjectName,
 		"Headers": g.headers,
@@ -145,22 +186,42 @@ func (g GoClientGenerator) Generate(data GeneratorData, endpoint ...mserve.Endpo
 	if err != nil {
 		return err
 	}
-	if err := writeToGoFile(publicDir, "client", []string{clientTemplates}, true, g.importOverwrides, clientImports...); err != nil {
-		return err
-	}
+	return addGoFile(files, dir, pkg, "client", []string{clientTemplates}, true, g.importOverwrides, clientImports...)
+}
 
-	return nil
+// target returns the directory and package name of the client. OutDir may be
+// a directory or an import path below the module path in RootDir.
+func (g GoClientGenerator) target(data GeneratorData) (string, string, error) {
+	projectDir, err := data.ProjectDir()
+	if err != nil {
+		return "", "", err
+	}
+	dir := g.OutDir
+	switch {
+	case dir == "":
+		dir = filepath.Join(projectDir, "pkg", ToSnakeCase(data.ProjectName+"_client"))
+	case data.RootDir != "" && (dir == data.RootDir || strings.HasPrefix(dir, data.RootDir+"/")):
+		dir = filepath.Join(projectDir, filepath.FromSlash(strings.TrimPrefix(dir, data.RootDir)))
+	default:
+		if dir, err = filepath.Abs(dir); err != nil {
+			return "", "", err
+		}
+	}
+	pkg := g.Package
+	if pkg == "" {
+		pkg = ToSnakeCase(filepath.Base(dir))
+	}
+	return dir, pkg, nil
 }
 
 func GetPublicPrivateDir(data GeneratorData) (string, string, error) {
-	homeDir, err := os.UserHomeDir()
+	projectDir, err := data.ProjectDir()
 	if err != nil {
 		return "", "", err
 	}
 
-	homeDir = path.Join(homeDir, "go", "src", "") + "/"
-	publicDir := filepath.Join(homeDir, data.RootDir, "pkg", ToSnakeCase(data.ProjectName+"_client"))
-	privateDir := filepath.Join(homeDir, data.RootDir, "pkg", ToSnakeCase(fmt.Sprintf("%s-client_private", data.ProjectName)))
+	publicDir := filepath.Join(projectDir, "pkg", ToSnakeCase(data.ProjectName+"_client"))
+	privateDir := filepath.Join(projectDir, "pkg", ToSnakeCase(fmt.Sprintf("%s-client_private", data.ProjectName)))
 	// Create directories if they don't exist
 	if err := ensureDir(publicDir); err != nil {
 		return "", "", err
@@ -172,14 +233,11 @@ func GetPublicPrivateDir(data GeneratorData) (string, string, error) {
 }
 
 func (g GoClientGenerator) GenerateComments(data GeneratorData, epts ...mserve.Endpoint) {
-	homeDir, err := os.UserHomeDir()
+	projectDir, err := data.ProjectDir()
 	if err != nil {
 		return
 	}
-	cachedEndpoints := ".cache.json"
-
-	homeDir = path.Join(homeDir, "go", "src", "") + "/"
-	cachedEndpoints = filepath.Join(homeDir, data.RootDir, cachedEndpoints)
+	cachedEndpoints := filepath.Join(projectDir, ".cache.json")
 	foundEndpoints, _ := LoadEndpoints(cachedEndpoints)
 	if foundEndpoints == nil {
 		foundEndpoints = map[string]mserve.Endpoint{}
@@ -192,7 +250,7 @@ func (g GoClientGenerator) GenerateComments(data GeneratorData, epts ...mserve.E
 			//f[v.UniqueID()] = fe
 		}
 	}
-	goFiles := GetGoFiles(filepath.Join(homeDir, data.RootDir))
+	goFiles := GetGoFiles(projectDir)
 
 	api, err := templ(map[string]string{
 		"Title":       data.Title,
@@ -0,0 +1,245 @@
+package generators
+
+import (
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/DarlingGoose/mserve"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// OptionField is a query or header parameter of a generated Go client method,
+// a field of its options struct or, when required, an argument.
+type OptionField struct {
+	// Name of the parameter on the wire
+	Name        string
+	Field       string
+	Type        string
+	Description string
+	Header      bool
+	// Arg is the argument name of a required parameter
+	Arg string
+}
+
+// EnumType is a string type declared for a parameter with allowed values.
+type EnumType struct {
+	Name   string
+	Values []EnumValue
+}
+
+type EnumValue struct {
+	Const string
+	Value string
+}
+
+// optionParam is a query or header parameter, read from an mserve.ROption or
+// an OpenAPI parameter.
+type optionParam struct {
+	name, description string
+	// typ is an OpenAPI type, items the type of array elements
+	typ, items string
+	enum       []string
+	required   bool
+	header     bool
+}
+
+// roptionParams converts Request.Params or Request.Headers, leaving out the
+// path variables of path.
+func roptionParams(path string, params map[string]mserve.ROption, header bool) []optionParam {
+	inPath := map[string]bool{}
+	for _, v := range pathVarNames(path) {
+		inPath[v] = true
+	}
+	var out []optionParam
+	for name, o := range params {
+		if !header && inPath[name] {
+			continue
+		}
+		p := optionParam{name: name, description: o.Description, required: o.Required, header: header, enum: o.Enum}
+		switch strings.ToLower(o.Type) {
+		case "int", "integer":
+			p.typ = openapi3.TypeInteger
+		case "float", "number":
+			p.typ = openapi3.TypeNumber
+		case "bool", "boolean":
+			p.typ = openapi3.TypeBoolean
+		case "array", "[]string":
+			p.typ, p.items = openapi3.TypeArray, openapi3.TypeString
+		case "[]int":
+			p.typ, p.items = openapi3.TypeArray, openapi3.TypeInteger
+		default:
+			p.typ = openapi3.TypeString
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// specOptionParams converts the query and header parameters of an operation.
+func specOptionParams(refs []*openapi3.ParameterRef) []optionParam {
+	var out []optionParam
+	for _, ref := range refs {
+		prm := ref.Value
+		if prm.In != openapi3.ParameterInQuery && prm.In != openapi3.ParameterInHeader {
+			continue
+		}
+		p := optionParam{
+			name:        prm.Name,
+			description: prm.Description,
+			required:    prm.Required,
+			header:      prm.In == openapi3.ParameterInHeader,
+			typ:         openapi3.TypeString,
+		}
+		if s := prm.Schema; s != nil && s.Value != nil {
+			p.typ, p.enum = schemaOptionType(s.Value)
+			if p.typ == openapi3.TypeArray {
+				p.items = openapi3.TypeString
+				if s.Value.Items != nil && s.Value.Items.Value != nil {
+					p.items, _ = schemaOptionType(s.Value.Items.Value)
+				}
+			}
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+func schemaOptionType(s *openapi3.Schema) (string, []string) {
+	for _, t := range []string{openapi3.TypeInteger, openapi3.TypeNumber, openapi3.TypeBoolean, openapi3.TypeArray} {
+		if hasType(s, t) {
+			return t, nil
+		}
+	}
+	var enum []string
+	for _, v := range s.Enum {
+		if v, ok := v.(string); ok {
+			enum = append(enum, v)
+		}
+	}
+	return openapi3.TypeString, enum
+}
+
+// pathVarNames returns the names of the {variables} of a path, without their
+// gorilla/mux patterns.
+func pathVarNames(path string) []string {
+	var names []string
+	for _, m := range specPathVar.FindAllStringSubmatch(path, -1) {
+		names = append(names, strings.SplitN(m[1], ":", 2)[0])
+	}
+	return names
+}
+
+// setOptions declares the options struct of cf, query parameters first.
+// Optional numbers and booleans are pointers so their zero value can be sent.
+// Required parameters are arguments of the method instead, after the path
+// variables.
+func setOptions(cf *ClientFunc, params []optionParam) {
+	sort.SliceStable(params, func(i, j int) bool {
+		if params[i].header != params[j].header {
+			return !params[i].header
+		}
+		return params[i].name < params[j].name
+	})
+	cf.Options = nil
+	cf.RequiredParams = nil
+	cf.Enums = nil
+	cf.UsesQueryParams, cf.UsesHeaderParams = false, false
+	used := map[string]bool{}
+	for _, p := range params {
+		field := goIdent(p.name)
+		for i := 2; used[field]; i++ {
+			field = goIdent(p.name) + strconv.Itoa(i)
+		}
+		used[field] = true
+
+		of := OptionField{Name: p.name, Field: field, Header: p.header}
+		of.Description = strings.Join(strings.Fields(p.description), " ")
+		switch p.typ {
+		case openapi3.TypeInteger:
+			of.Type = "int"
+		case openapi3.TypeNumber:
+			of.Type = "float64"
+		case openapi3.TypeBoolean:
+			of.Type = "bool"
+		case openapi3.TypeArray:
+			of.Type = "[]string"
+			switch p.items {
+			case openapi3.TypeInteger:
+				of.Type = "[]int"
+			case openapi3.TypeNumber:
+				of.Type = "[]float64"
+			}
+		default:
+			of.Type = "string"
+			if len(p.enum) > 0 {
+				enum := EnumType{Name: cf.Name + field}
+				for _, v := range p.enum {
+					enum.Values = append(enum.Values, EnumValue{Const: enum.Name + goIdent(v), Value: v})
+				}
+				cf.Enums = append(cf.Enums, enum)
+				of.Type = enum.Name
+			}
+		}
+		if !p.required && (of.Type == "int" || of.Type == "float64" || of.Type == "bool") {
+			of.Type = "*" + of.Type
+		}
+		if p.header {
+			cf.UsesHeaderParams = true
+		} else {
+			cf.UsesQueryParams = true
+		}
+		if p.required {
+			of.Arg = requiredParamArg(cf, p.name)
+			cf.RequiredParams = append(cf.RequiredParams, of)
+			continue
+		}
+		cf.Options = append(cf.Options, of)
+	}
+	if len(cf.Options) > 0 {
+		cf.OptionsType = cf.Name + "Options"
+	}
+	if cf.UsesQueryParams {
+		cf.Imports = append(cf.Imports, Imports{Path: "net/url"})
+	}
+}
+
+// requiredParamArg names the argument of a required parameter, suffixed with
+// Param when it collides with another argument or a local of the method.
+func requiredParamArg(cf *ClientFunc, name string) string {
+	arg := goLocalIdent(name)
+	taken := methodLocals[arg] || token.IsKeyword(arg) || arg == cf.RequestTypeName
+	for _, m := range cf.MuxVars {
+		taken = taken || m == arg
+	}
+	for _, r := range cf.RequiredParams {
+		taken = taken || r.Arg == arg
+	}
+	if taken {
+		arg += "Param"
+	}
+	return arg
+}
+
+// methodLocals are the names the method template declares itself.
+var methodLocals = map[string]bool{
+	"c": true, "ctx": true, "path": true, "query": true, "headers": true,
+	"opts": true, "skipCache": true, "requestDataInternal": true,
+	"url": true, "fmt": true, "http": true, "clientpkg": true,
+}
+
+// renameBodyArg names the body argument "body" when its type derived name
+// collides with a path variable or a local of the method.
+func renameBodyArg(cf *ClientFunc) {
+	if cf.RequestTypeName == "" {
+		return
+	}
+	clash := methodLocals[cf.RequestTypeName]
+	for _, m := range cf.MuxVars {
+		clash = clash || m == cf.RequestTypeName
+	}
+	if clash {
+		cf.RequestTypeName = "body"
+	}
+}
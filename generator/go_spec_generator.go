@@ -0,0 +1,234 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	"go/format"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/DarlingGoose/mserve"
+	"github.com/DarlingGoose/mserve/openapidiff"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/spf13/cobra"
+)
+
+const (
+	goClientModelsFile    = "models.gen.go"
+	goClientGeneratedHead = "// Code generated by mserve generate client. DO NOT EDIT.\n\n"
+)
+
+// GenerateFromSpec writes the client Generate writes, with its models, from an
+// OpenAPI document instead of Endpoint values, so a service can be consumed
+// without importing its code. components.schemas become the structs of
+// models.gen.go; inline request and response objects are declared there too.
+func (g GoClientGenerator) GenerateFromSpec(data GeneratorData, doc *openapi3.T) error {
+	if doc == nil {
+		return errors.New("openapi document is nil")
+	}
+	if data.ProjectName == "" && doc.Info != nil {
+		data.ProjectName = ToSnakeCase(goIdent(doc.Info.Title))
+	}
+	dir, pkg, err := g.target(data)
+	if err != nil {
+		return err
+	}
+
+	models := newGoModels()
+	if doc.Components != nil {
+		names := sortedSchemaNames(doc.Components.Schemas)
+		// reserve component names so inline objects never take them
+		for _, name := range names {
+			models.decls[goIdent(name)] = ""
+		}
+		for _, name := range names {
+			models.declareComponent(name, doc.Components.Schemas[name])
+		}
+	}
+
+	var schemas openapi3.Schemas
+	if doc.Components != nil {
+		schemas = doc.Components.Schemas
+	}
+	groups := map[string][]*ClientFunc{}
+	if doc.Paths != nil {
+		paths := doc.Paths.Map()
+		keys := make([]string, 0, len(paths))
+		for k := range paths {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, p := range keys {
+			if strings.HasPrefix(p, "/_") {
+				continue
+			}
+			item := paths[p]
+			for _, method := range operationMethods {
+				if op := item.GetOperation(method); op != nil {
+					group := GetBaseDir(p)
+					groups[group] = append(groups[group], specClientFunc(models, schemas, p, method, item, op))
+				}
+			}
+		}
+	}
+
+	files := map[string][]byte{}
+	for _, group := range sortedKeys(groups) {
+		var code []string
+		var imports []Imports
+		for _, cf := range groups[group] {
+			imports = append(imports, cf.Imports...)
+			funcCode, err := generateEndpointFunc(cf)
+			if err != nil {
+				return err
+			}
+			code = append(code, funcCode)
+		}
+		if err := addGoFile(files, dir, pkg, group, code, true, g.importOverwrides, imports...); err != nil {
+			return err
+		}
+	}
+	if err := g.addClientFile(files, dir, pkg, data); err != nil {
+		return err
+	}
+	modelsFile := filepath.Join(dir, goClientModelsFile)
+	src, err := format.Source([]byte(goClientGeneratedHead + models.source(pkg)))
+	if err != nil {
+		return fmt.Errorf("formatting %s: %w", modelsFile, err)
+	}
+	files[modelsFile] = src
+	return writeGenerated(dir, files, g.Check)
+}
+
+var specPathVar = regexp.MustCompile(`{(.*?)}`)
+
+// specClientFunc describes operation op like GoNewClientFunc describes an
+// Endpoint, with types taken from models.
+func specClientFunc(models *goModels, schemas openapi3.Schemas, path, method string, item *openapi3.PathItem, op *openapi3.Operation) *ClientFunc {
+	description := op.Description
+	if description == "" {
+		description = op.Summary
+	}
+	cf := createClientFunc(mserve.Endpoint{Path: path, Description: description}, method, specPathVar)
+	cf.Language = LanguageGo
+
+	populateQueryParams(cf, nil)
+	hint := ClientFuncName(method, path)
+
+	if op.RequestBody != nil && op.RequestBody.Value != nil {
+		if schema := jsonSchema(op.RequestBody.Value.Content); schema != nil {
+			cf.RequestType = models.fieldType(schema, hint+"Body")
+			cf.RequestTypeName = "body"
+			if name := strings.TrimLeft(cf.RequestType, "*[]"); goIdentPattern.MatchString(name) && !token.IsKeyword(formatName(name, false)) {
+				cf.RequestTypeName = formatName(name, false)
+			}
+		}
+	}
+
+	cf.Return = "*clientpkg.ResponseData"
+	if op.Responses != nil {
+		for _, code := range []string{"200", "201", "202", "203", "206"} {
+			resp := op.Responses.Value(code)
+			if resp == nil || resp.Value == nil {
+				continue
+			}
+			if len(resp.Value.Content) > 0 && !hasJSONContent(resp.Value.Content) {
+				setStreamResponse(cf)
+			} else if schema := jsonSchema(resp.Value.Content); schema != nil {
+				name := hint + "Response"
+				if items, ok := pageItems(schemas, schema); ok {
+					// the Iterator walks the items of an mserve.Page page by page
+					schema, name = items, hint+"Item"
+				}
+				// the Iterator decodes lists item by item and anything else as a single item
+				cf.DataTypeName = strings.TrimPrefix(models.typeOf(schema, name), "[]")
+				cf.DataTypeName = strings.TrimPrefix(cf.DataTypeName, "*")
+				cf.Return = fmt.Sprintf("*clientpkg.Iterator[%s]", cf.DataTypeName)
+				cf.UseIterator = true
+			}
+			break
+		}
+	}
+
+	formatPath(cf)
+	for i, v := range cf.MuxVars {
+		// groupID rather than groupId
+		cf.MuxVars[i] = goLocalIdent(v)
+		cf.Path = strings.ReplaceAll(cf.Path, "url.PathEscape("+v+")", "url.PathEscape("+cf.MuxVars[i]+")")
+	}
+	renameBodyArg(cf)
+	setMethodName(cf, method)
+	cf.Name = goIdent(cf.Name)
+	setOptions(cf, specOptionParams(mergedParameters(item.Parameters, op.Parameters)))
+	return cf
+}
+
+// pageItems returns the items schema of a schema shaped like mserve.Page, a
+// $ref to the component it is an inlined copy of when there is one.
+func pageItems(schemas openapi3.Schemas, ref *openapi3.SchemaRef) (*openapi3.SchemaRef, bool) {
+	if ref.Value == nil {
+		return nil, false
+	}
+	props := ref.Value.Properties
+	items := props["items"]
+	if items == nil || items.Value == nil || !hasType(items.Value, openapi3.TypeArray) || items.Value.Items == nil {
+		return nil, false
+	}
+	if props["page"] == nil || props["limit"] == nil || props["total"] == nil || props["totalPages"] == nil {
+		return nil, false
+	}
+	item := items.Value.Items
+	if item.Ref != "" || item.Value == nil || len(item.Value.Properties) == 0 {
+		return item, true
+	}
+	want := schemaFingerprint(item.Value)
+	for _, name := range sortedSchemaNames(schemas) {
+		if c := schemas[name]; c != nil && c.Value != nil && schemaFingerprint(c.Value) == want {
+			return openapi3.NewSchemaRef("#/components/schemas/"+name, c.Value), true
+		}
+	}
+	return item, true
+}
+
+func hasJSONContent(content openapi3.Content) bool {
+	for mediaType := range content {
+		if isJSONMediaType(mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+var goIdentPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ClientCommand returns the "client <spec>" subcommand generating the Go client.
+func ClientCommand() *cobra.Command {
+	g := &GoClientGenerator{}
+	var name string
+	cmd := &cobra.Command{
+		Use:   "client <spec>",
+		Short: "Generate a Go client and its models from an OpenAPI document",
+		Long: "Reads an OpenAPI document (file or URL) and writes the clientpkg based Go\n" +
+			"client mserve generates for Endpoints, with models.gen.go holding the\n" +
+			"components. --out takes a directory or an import path of the current module.",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			doc, err := openapidiff.Load(cmd.Context(), args[0])
+			if err != nil {
+				return fmt.Errorf("loading %s: %w", args[0], err)
+			}
+			data := NewGenData()
+			data.ProjectName = name
+			return g.GenerateFromSpec(data, doc)
+		},
+	}
+	cmd.Flags().StringVar(&g.OutDir, "out", "", "directory or import path of the client, defaults to pkg/<name>_client in the module")
+	cmd.Flags().StringVar(&g.Package, "package", "", "package name, defaults to the name of --out")
+	cmd.Flags().StringVar(&name, "name", "", "client name used as flag prefix, defaults to the title of the document")
+	cmd.Flags().BoolVar(&g.Check, "check", false, "fail when the generated files are out of date instead of writing them")
+	return cmd
+}
@@ -0,0 +1,207 @@
+package generators
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// ErrOutOfDate is returned in check mode when generated files differ from
+// the ones on disk.
+var ErrOutOfDate = errors.New("generated code is out of date")
+
+// Module is a Go module on disk.
+type Module struct {
+	// Path is the module path of go.mod, e.g. github.com/DarlingGoose/mserve
+	Path string
+	// Dir is the directory holding go.mod
+	Dir string
+}
+
+// FindModule resolves the module dir belongs to: the nearest go.mod above
+// dir, or what `go list -m` reports when there is none, e.g. in a workspace.
+func FindModule(dir string) (*Module, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for d := abs; ; d = filepath.Dir(d) {
+		data, err := os.ReadFile(filepath.Join(d, "go.mod"))
+		if err == nil {
+			modPath := modfile.ModulePath(data)
+			if modPath == "" {
+				return nil, fmt.Errorf("%s: no module directive", filepath.Join(d, "go.mod"))
+			}
+			return &Module{Path: modPath, Dir: d}, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	return goListModule(abs)
+}
+
+func goListModule(dir string) (*Module, error) {
+	cmd := exec.Command("go", "list", "-m", "-json")
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("no go.mod found for %s: go list -m: %v %s", dir, err, strings.TrimSpace(stderr.String()))
+	}
+	var m Module
+	if err := json.NewDecoder(bytes.NewReader(out)).Decode(&m); err != nil {
+		return nil, fmt.Errorf("go list -m: %w", err)
+	}
+	if m.Path == "" || m.Dir == "" {
+		return nil, fmt.Errorf("no go.mod found for %s", dir)
+	}
+	return &m, nil
+}
+
+// ImportPath returns the import path of dir, which must be inside the module.
+func (m *Module) ImportPath(dir string) (string, error) {
+	rel, err := filepath.Rel(m.Dir, dir)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside of module %s", dir, m.Path)
+	}
+	if rel == "." {
+		return m.Path, nil
+	}
+	return path.Join(m.Path, filepath.ToSlash(rel)), nil
+}
+
+// PackageDir returns the directory of importPath, false when it is not part
+// of the module.
+func (m *Module) PackageDir(importPath string) (string, bool) {
+	if importPath == m.Path {
+		return m.Dir, true
+	}
+	if !strings.HasPrefix(importPath, m.Path+"/") {
+		return "", false
+	}
+	return filepath.Join(m.Dir, filepath.FromSlash(strings.TrimPrefix(importPath, m.Path+"/"))), true
+}
+
+// writeFileAtomic replaces file with data by renaming a temporary file of the
+// same directory over it, so readers never see a partially written file.
+func writeFileAtomic(file string, data []byte) error {
+	dir := filepath.Dir(file)
+	if err := ensureDir(dir); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// writeGenerated writes files, keyed by their path, atomically, and removes
+// the generated Go files of dir that are not part of files any more, e.g.
+// those of a removed endpoint group. With check set nothing is written and
+// ErrOutOfDate lists the files that would change or be removed.
+func writeGenerated(dir string, files map[string][]byte, check bool) error {
+	leftover, err := leftoverGenerated(dir, files)
+	if err != nil {
+		return err
+	}
+	var stale []string
+	for _, file := range sortedKeys(files) {
+		if check {
+			current, err := os.ReadFile(file)
+			if err != nil || !bytes.Equal(current, files[file]) {
+				stale = append(stale, file)
+			}
+			continue
+		}
+		if err := writeFileAtomic(file, files[file]); err != nil {
+			return err
+		}
+	}
+	for _, file := range leftover {
+		if check {
+			stale = append(stale, file+" (no longer generated)")
+			continue
+		}
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if len(stale) > 0 {
+		return fmt.Errorf("%w: %s", ErrOutOfDate, strings.Join(stale, ", "))
+	}
+	return nil
+}
+
+// leftoverGenerated lists the Go files of dir written by the client generator
+// that are not in files.
+func leftoverGenerated(dir string, files map[string][]byte) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	var leftover []string
+	for _, file := range matches {
+		if _, ok := files[file]; ok {
+			continue
+		}
+		generated, err := isGeneratedClientFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if generated {
+			leftover = append(leftover, file)
+		}
+	}
+	return leftover, nil
+}
+
+// isGeneratedClientFile reports whether file starts with the header of the
+// client generator, or the "// AUTO GENERATED" line of its earlier versions.
+func isGeneratedClientFile(file string) (bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	head := make([]byte, 256)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	head = head[:n]
+	if bytes.HasPrefix(head, []byte(goClientGeneratedHead)) {
+		return true, nil
+	}
+	lines := bytes.SplitN(head, []byte("\n"), 3)
+	return len(lines) == 3 && bytes.HasPrefix(lines[0], []byte("package ")) && string(lines[1]) == "// AUTO GENERATED", nil
+}
@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"go/format"
+	"go/token"
 	"log"
 	"net/http"
 	"os"
@@ -31,6 +33,8 @@ type ClientFunc struct {
 	MethodType  string
 	MuxVars     []string
 	UseIterator bool
+	// Stream is set for file and other non-JSON responses, returned unread
+	Stream bool
 
 	UsesQueryParams  bool
 	UsesHeaderParams bool
@@ -39,8 +43,16 @@ type ClientFunc struct {
 	RequestTypeName  string
 	DataTypeName     string
 	QueryParams      map[string]string
-	Description      string
-	Imports          []Imports
+	// Options are the optional query and header parameters, fields of the
+	// OptionsType struct
+	Options     []OptionField
+	OptionsType string
+	// RequiredParams are the required query and header parameters, arguments
+	// of the method
+	RequiredParams []OptionField
+	Enums          []EnumType
+	Description    string
+	Imports        []Imports
 
 	Objects map[string][]string
 	Swagger string
@@ -61,11 +73,16 @@ var (
 	matchAllCap   = regexp.MustCompile("([a-z0-9])([A-Z])")
 )
 
+// GetRootDir returns the module path of the working directory, read from
+// go.mod. Outside of a module it is guessed from the path below $HOME/go/src.
 func GetRootDir() (string, error) {
 	currentPath, err := os.Getwd()
 	if err != nil {
 		return "", err
 	}
+	if m, err := FindModule(currentPath); err == nil {
+		return m.Path, nil
+	}
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
@@ -270,7 +287,8 @@ func UrlToName(url string) string {
 	re := regexp.MustCompile(`\{(.*?)\}`)
 	r := regexp.MustCompile(`[\{\}]`)
 	for _, d := range re.FindAllString(url, -1) {
-		ds := r.ReplaceAllString(d, "")
+		// gorilla/mux patterns are not part of the name, {id:[0-9]+} is WithId
+		ds := strings.SplitN(r.ReplaceAllString(d, ""), ":", 2)[0]
 		url = strings.ReplaceAll(url, "/"+d, "With"+SnakeCaseToCamelCase(ds))
 	}
 	url = strings.TrimPrefix(url, "/")
@@ -347,7 +365,8 @@ func templ(ep interface{}, tmp string) (string, error) {
 }
 
 // writeToGoFile Helper: Write generated function code to a file
-func writeToGoFile(dir string, group string, code []string, isPublic bool, overrides map[string]*Imports, imports ...Imports) error {
+// addGoFile renders the code of group into files, keyed by its path in dir.
+func addGoFile(files map[string][]byte, dir, pkg, group string, code []string, isPublic bool, overrides map[string]*Imports, imports ...Imports) error {
 	if len(code) == 0 {
 		return nil
 	}
@@ -357,21 +376,14 @@ func writeToGoFile(dir string, group string, code []string, isPublic bool, overr
 	filename := fmt.Sprintf("%s.go", ToSnakeCase(group))
 	fp := filepath.Join(dir, filename)
 
-	f, err := os.Create(fp)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
-	_, pkg := path.Split(dir)
-	header := fmt.Sprintf(
+	header := goClientGeneratedHead + fmt.Sprintf(
 		`package %s
-// AUTO GENERATED
+
 import (
 	%s
 )
 
-`, ToSnakeCase(pkg), FormatImports(LanguageGo, overrides, imports...))
+`, pkg, FormatImports(LanguageGo, overrides, imports...))
 	// Add package name and imports at the top of the file
 	if isPublic {
 		header += "// Public Endpoint - Auto Generated\n"
@@ -379,8 +391,12 @@ import (
 		header += "// Private Endpoint - Auto Generated\n"
 	}
 
-	_, err = f.WriteString(header + strings.Join(code, "\n") + "\n")
-	return err
+	src, err := format.Source([]byte(header + strings.Join(code, "\n") + "\n"))
+	if err != nil {
+		return fmt.Errorf("formatting %s: %w", fp, err)
+	}
+	files[fp] = src
+	return nil
 }
 
 func FormatImports(language Language, overrides map[string]*Imports, list ...Imports) string {
@@ -444,13 +460,21 @@ func GoNewClientFunc(endpoint mserve.Endpoint) []*ClientFunc {
 		populateQueryParams(cf, endpoint.Request.Params)
 		if len(endpoint.Responses) > 0 { //todo fix this
 			setRequestType(cf, endpoint.Responses[0].Body, skipPkg)
-			setResponseType(cf, endpoint.Responses[0].Body, skipPkg)
+			if isStreamResponse(endpoint.Responses[0]) {
+				setStreamResponse(cf)
+			} else {
+				setResponseType(cf, endpoint.Responses[0].Body, skipPkg)
+			}
 		} else {
 			cf.Return = "*clientpkg.ResponseData"
 		}
 		formatPath(cf)
+		renameBodyArg(cf)
 		setMethodName(cf, method)
-		additionalChecks(cf, endpoint)
+		setOptions(cf, append(
+			roptionParams(endpoint.Path, endpoint.Request.Params, false),
+			roptionParams(endpoint.Path, endpoint.Request.Headers, true)...,
+		))
 
 		output = append(output, cf)
 	}
@@ -507,6 +531,10 @@ func setRequestType(cf *ClientFunc, requestType interface{}, skipPkg map[string]
 	if requestType == nil {
 		return
 	}
+	if item, ok := pageItem(requestType); ok {
+		// named after the item, Page[T] is no Go identifier
+		requestType = item
+	}
 
 	fullPkg, pkg := getTypePkg(requestType)
 	typeName := getType(requestType)
@@ -532,11 +560,9 @@ func setResponseType(cf *ClientFunc, responseType interface{}, skipPkg map[strin
 		cf.Return = "*clientpkg.ResponseData"
 		return
 	}
-	if strings.Contains(cf.Path, "{") {
-		cf.Imports = append(cf.Imports, Imports{
-			Name: "fmt",
-			Path: "fmt",
-		})
+	if item, ok := pageItem(responseType); ok {
+		// the Iterator walks the items of an mserve.Page page by page
+		responseType = item
 	}
 	fullPkg, pkg := getTypePkg(responseType)
 	cf.DataTypeName = getDataTypeName(responseType, pkg, skipPkg)
@@ -558,18 +584,72 @@ func setResponseType(cf *ClientFunc, responseType interface{}, skipPkg map[strin
 
 }
 
+// pageItem returns a zero item of an mserve.Page body.
+func pageItem(body interface{}) (interface{}, bool) {
+	t := reflect.TypeOf(body)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct || t.PkgPath() != reflect.TypeOf(mserve.Pagination{}).PkgPath() || !strings.HasPrefix(t.Name(), "Page[") {
+		return nil, false
+	}
+	items, ok := t.FieldByName("Items")
+	if !ok || items.Type.Kind() != reflect.Slice {
+		return nil, false
+	}
+	return reflect.Zero(items.Type.Elem()).Interface(), true
+}
+
+// isStreamResponse reports whether resp is a file or another non-JSON body:
+// a []byte Body or a Content-Type header defaulting to something else than
+// JSON.
+func isStreamResponse(resp mserve.Response) bool {
+	if _, ok := resp.Body.([]byte); ok {
+		return true
+	}
+	for name, h := range resp.Headers {
+		if strings.EqualFold(name, "Content-Type") && h.Default != "" {
+			return !isJSONMediaType(h.Default)
+		}
+	}
+	return false
+}
+
+func isJSONMediaType(mediaType string) bool {
+	mediaType = strings.TrimSpace(strings.SplitN(mediaType, ";", 2)[0])
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// setStreamResponse makes cf return the response body unread, see
+// clientpkg.Client.Stream.
+func setStreamResponse(cf *ClientFunc) {
+	cf.Stream = true
+	cf.UseIterator = false
+	cf.DataTypeName = ""
+	cf.Return = "(io.ReadCloser, http.Header, error)"
+	cf.Imports = append(cf.Imports, Imports{Path: "io"})
+}
+
 func formatPath(cf *ClientFunc) {
 	cf.RawPath = cf.Path
+	args := make([]string, len(cf.MuxVars))
 	for i, original := range cf.MuxVars {
-		n := SnakeCaseToCamelCase(regexp.MustCompile(`[{}]`).ReplaceAllString(original, ""))
+		// drop gorilla/mux patterns, {id:[0-9]+} is the variable id
+		name := strings.SplitN(regexp.MustCompile(`[{}]`).ReplaceAllString(original, ""), ":", 2)[0]
+		n := SnakeCaseToCamelCase(regexp.MustCompile(`[\-\.]`).ReplaceAllString(name, "_"))
 		cf.MuxVars[i] = strings.ToLower(n[:1]) + n[1:]
+		if methodLocals[cf.MuxVars[i]] || token.IsKeyword(cf.MuxVars[i]) {
+			cf.MuxVars[i] += "Param"
+		}
+		args[i] = "url.PathEscape(" + cf.MuxVars[i] + ")"
 		cf.Path = strings.ReplaceAll(cf.Path, original, "%s")
 	}
 
 	if len(cf.MuxVars) == 0 {
 		cf.Path = fmt.Sprintf(`"%s"`, cf.Path)
 	} else {
-		cf.Path = fmt.Sprintf(`fmt.Sprintf("%s", %s)`, cf.Path, strings.Join(cf.MuxVars, ", "))
+		cf.Path = fmt.Sprintf(`fmt.Sprintf("%s", %s)`, cf.Path, strings.Join(args, ", "))
+		cf.Imports = append(cf.Imports, Imports{Path: "fmt"}, Imports{Path: "net/url"})
 	}
 	for _, m := range cf.MuxVars {
 		delete(cf.QueryParams, m)
@@ -577,6 +657,15 @@ func formatPath(cf *ClientFunc) {
 
 }
 
+// ClientFuncName returns the name the Go client gives the method operation on
+// path, e.g. GET /users/{id} -> GetUsersWithId. Other client generators use
+// it so operations are named the same in every language.
+func ClientFuncName(method, path string) string {
+	cf := &ClientFunc{Name: UrlToName(path)}
+	setMethodName(cf, method)
+	return cf.Name
+}
+
 func setMethodName(cf *ClientFunc, method string) {
 	switch method {
 	case http.MethodGet:
@@ -590,15 +679,6 @@ func setMethodName(cf *ClientFunc, method string) {
 	}
 }
 
-func additionalChecks(cf *ClientFunc, endpoint mserve.Endpoint) {
-	if len(endpoint.Request.Headers) > 0 {
-		cf.UsesHeaderParams = true
-	}
-	if len(endpoint.Request.Params) > 0 {
-		cf.UsesQueryParams = true
-	}
-}
-
 func GetGoFiles(path string) []string {
 	libRegEx, e := regexp.Compile(`^.+\.(go)$`)
 	if e != nil {
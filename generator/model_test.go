@@ -0,0 +1,39 @@
+package generators
+
+import (
+	"go/format"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/DarlingGoose/mserve"
+)
+
+type pet struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestGoNewClientFuncPage(t *testing.T) {
+	cfs := GoNewClientFunc(mserve.Endpoint{
+		Name:    "list pets",
+		Methods: []string{http.MethodGet},
+		Path:    "/pets",
+		Responses: []mserve.Response{
+			{Status: http.StatusOK, Body: mserve.Page[pet]{}},
+		},
+	})
+	if len(cfs) != 1 {
+		t.Fatalf("got %d client funcs, want 1", len(cfs))
+	}
+	src, err := generateEndpointFunc(cfs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := format.Source([]byte("package client\n\n" + src)); err != nil {
+		t.Fatalf("generated code does not parse: %v\n%s", err, src)
+	}
+	if strings.Contains(src, "Page[") {
+		t.Errorf("got\n%s\nwant the page items, not the Page", src)
+	}
+}
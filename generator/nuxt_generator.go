@@ -0,0 +1,79 @@
+package generators
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/DarlingGoose/mserve"
+	"github.com/DarlingGoose/mserve/nuxt3FromOpenApi"
+	"github.com/DarlingGoose/mserve/openapidiff"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/spf13/cobra"
+)
+
+var _ Generator = NuxtModuleGenerator{}
+
+// NuxtModuleGenerator writes the Nuxt 3 module of nuxt3FromOpenApi: the typed
+// client, useXxx composables and the session-aware plugin.
+type NuxtModuleGenerator struct {
+	// OutDir the module is written to, defaults to clients/nuxt in the project
+	OutDir string
+}
+
+func NewNuxtModuleGenerator(outDir string) *NuxtModuleGenerator {
+	return &NuxtModuleGenerator{OutDir: outDir}
+}
+
+func (g NuxtModuleGenerator) Generate(data GeneratorData, endpoints ...mserve.Endpoint) error {
+	server := &mserve.Server{ServiceName: data.ProjectName, Version: data.Version, Description: data.Description}
+	doc, err := mserve.GenerateOpenAPI(server, endpoints)
+	if err != nil {
+		return err
+	}
+	if data.Title != "" {
+		doc.Info.Title = data.Title
+	}
+	if data.Host != "" {
+		doc.Servers = openapi3.Servers{{URL: data.Host}}
+	}
+	if g.OutDir == "" {
+		projectDir, err := data.ProjectDir()
+		if err != nil {
+			return err
+		}
+		g.OutDir = filepath.Join(projectDir, "clients", "nuxt")
+	}
+	return g.GenerateFromSpec(doc)
+}
+
+// GenerateFromSpec writes the module for doc to OutDir.
+func (g NuxtModuleGenerator) GenerateFromSpec(doc *openapi3.T) error {
+	if g.OutDir == "" {
+		return fmt.Errorf("nuxt module: output directory is required")
+	}
+	module, err := nuxt3FromOpenApi.GenerateNuxt3ModuleFromSpec(doc)
+	if err != nil {
+		return err
+	}
+	return module.Write(g.OutDir)
+}
+
+// NuxtCommand returns the "nuxt <spec>" subcommand generating the Nuxt module.
+func NuxtCommand() *cobra.Command {
+	var out string
+	cmd := &cobra.Command{
+		Use:          "nuxt <spec>",
+		Short:        "Generate a typed Nuxt 3 module from an OpenAPI document",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			doc, err := openapidiff.Load(cmd.Context(), args[0])
+			if err != nil {
+				return fmt.Errorf("loading %s: %w", args[0], err)
+			}
+			return NewNuxtModuleGenerator(out).GenerateFromSpec(doc)
+		},
+	}
+	cmd.Flags().StringVar(&out, "out", "clients/nuxt", "directory the module is written to")
+	return cmd
+}
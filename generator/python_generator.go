@@ -0,0 +1,1114 @@
+package generators
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/DarlingGoose/mserve"
+	"github.com/DarlingGoose/mserve/openapidiff"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/spf13/cobra"
+)
+
+const pyHeader = "# Code generated by mserve. DO NOT EDIT.\n"
+
+var _ Generator = PythonClientGenerator{}
+
+// PythonClientGenerator writes a typed Python package: models.py holds a
+// dataclass per components.schemas object, client.py a requests.Session based
+// client with one method per operation, retries with the clientpkg.BackOff
+// schedule and a PageIterator for mserve.Page responses.
+//
+// Methods are named like the Go client, snake_cased: GET /users/{id} is
+// GetUsersWithId in Go and get_users_with_id in Python.
+type PythonClientGenerator struct {
+	// OutDir the package directory and pyproject.toml are written to, defaults
+	// to clients/python in the project
+	OutDir string
+	// Package is the Python package name, defaults to <title>_client
+	Package string
+}
+
+func NewPythonClientGenerator(outDir, pkg string) *PythonClientGenerator {
+	return &PythonClientGenerator{OutDir: outDir, Package: pkg}
+}
+
+func (g PythonClientGenerator) Generate(data GeneratorData, endpoints ...mserve.Endpoint) error {
+	server := &mserve.Server{ServiceName: data.ProjectName, Version: data.Version, Description: data.Description}
+	doc, err := mserve.GenerateOpenAPI(server, endpoints)
+	if err != nil {
+		return err
+	}
+	if data.Title != "" {
+		doc.Info.Title = data.Title
+	}
+	if data.Host != "" {
+		doc.Servers = openapi3.Servers{{URL: data.Host}}
+	}
+	if g.OutDir == "" {
+		projectDir, err := data.ProjectDir()
+		if err != nil {
+			return err
+		}
+		g.OutDir = filepath.Join(projectDir, "clients", "python")
+	}
+	return g.GenerateFromSpec(doc)
+}
+
+// GenerateFromSpec writes the package for doc to OutDir.
+func (g PythonClientGenerator) GenerateFromSpec(doc *openapi3.T) error {
+	if g.OutDir == "" {
+		return fmt.Errorf("python client: output directory is required")
+	}
+	files := PythonClient(doc, g.Package)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := filepath.Join(g.OutDir, filepath.FromSlash(name))
+		if err := ensureDir(filepath.Dir(p)); err != nil {
+			return err
+		}
+		if err := os.WriteFile(p, []byte(files[name]), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PythonClient returns the files of the Python package for doc keyed by their
+// path relative to the output directory. pkg defaults to <title>_client.
+func PythonClient(doc *openapi3.T, pkg string) map[string]string {
+	title := "Api"
+	if doc.Info != nil && doc.Info.Title != "" {
+		title = goIdent(doc.Info.Title)
+	}
+	if pkg == "" {
+		pkg = ToSnakeCase(title) + "_client"
+	}
+	py := newPyModels()
+	if doc.Components != nil {
+		py.detectPages(doc.Components.Schemas)
+		for _, name := range sortedSchemaNames(doc.Components.Schemas) {
+			py.declareComponent(name, doc.Components.Schemas[name])
+		}
+	}
+	className := strings.TrimSuffix(title, "Client") + "Client"
+	client := py.client(doc, className)
+	version := "0.0.0"
+	if doc.Info != nil && doc.Info.Version != "" {
+		version = doc.Info.Version
+	}
+	return map[string]string{
+		pkg + "/__init__.py":  pyInit(className),
+		pkg + "/models.py":    py.source(),
+		pkg + "/client.py":    client,
+		pkg + "/py.typed":     "",
+		"pyproject.toml":      fmt.Sprintf(pyProject, strings.ReplaceAll(pkg, "_", "-"), version, pkg),
+		pkg + "/_runtime.py":  pyRuntime,
+		pkg + "/_backoff.py":  pyBackOff,
+		pkg + "/_iterator.py": pyIterator,
+	}
+}
+
+// PythonCommand returns the "python <spec>" subcommand generating the Python client.
+func PythonCommand() *cobra.Command {
+	var out, pkg string
+	cmd := &cobra.Command{
+		Use:          "python <spec>",
+		Short:        "Generate a typed Python client package from an OpenAPI document",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			doc, err := openapidiff.Load(cmd.Context(), args[0])
+			if err != nil {
+				return fmt.Errorf("loading %s: %w", args[0], err)
+			}
+			return NewPythonClientGenerator(out, pkg).GenerateFromSpec(doc)
+		},
+	}
+	cmd.Flags().StringVar(&out, "out", "clients/python", "directory the package and pyproject.toml are written to")
+	cmd.Flags().StringVar(&pkg, "package", "", "package name, defaults to <title>_client")
+	return cmd
+}
+
+// pyReserved are the names models.py and client.py define or import themselves.
+var pyReserved = map[string]bool{
+	"Any": true, "Dict": true, "List": true, "Literal": true, "Optional": true, "Union": true,
+	"Page": true, "PageIterator": true, "BackOff": true, "ApiError": true, "BaseClient": true,
+	"T": true, "Generic": true, "TypeVar": true, "dataclass": true, "field": true,
+}
+
+var pyKeywords = map[string]bool{
+	"False": true, "None": true, "True": true, "and": true, "as": true, "assert": true,
+	"async": true, "await": true, "break": true, "class": true, "continue": true, "def": true,
+	"del": true, "elif": true, "else": true, "except": true, "finally": true, "for": true,
+	"from": true, "global": true, "if": true, "import": true, "in": true, "is": true,
+	"lambda": true, "nonlocal": true, "not": true, "or": true, "pass": true, "raise": true,
+	"return": true, "try": true, "while": true, "with": true, "yield": true,
+	"self": true, "body": true, "options": true,
+}
+
+var pyNonIdent = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// pyName turns an OpenAPI property or parameter name into a snake_case identifier.
+func pyName(s string) string {
+	n := strings.Trim(pyNonIdent.ReplaceAllString(ToSnakeCase(s), "_"), "_")
+	if n == "" {
+		n = "value"
+	}
+	if n[0] >= '0' && n[0] <= '9' {
+		n = "f_" + n
+	}
+	if pyKeywords[n] {
+		n += "_"
+	}
+	return n
+}
+
+func pyString(s string) string {
+	return strconv.Quote(s)
+}
+
+// pyDoc writes a docstring at indent, or nothing for empty text.
+func pyDoc(b *strings.Builder, indent, text string) {
+	text = strings.TrimSpace(strings.ReplaceAll(strings.ReplaceAll(text, `\`, `\\`), `"""`, `\"\"\"`))
+	if text == "" {
+		return
+	}
+	lines := strings.Split(text, "\n")
+	if len(lines) == 1 {
+		fmt.Fprintf(b, "%s\"\"\"%s\"\"\"\n", indent, lines[0])
+		return
+	}
+	fmt.Fprintf(b, "%s\"\"\"%s\n", indent, strings.TrimSpace(lines[0]))
+	for _, line := range lines[1:] {
+		line = strings.TrimRight(line, " \t")
+		if line == "" {
+			b.WriteString("\n")
+			continue
+		}
+		fmt.Fprintf(b, "%s%s\n", indent, strings.TrimSpace(line))
+	}
+	fmt.Fprintf(b, "%s\"\"\"\n", indent)
+}
+
+// pyModels collects the Python declarations of an OpenAPI document.
+type pyModels struct {
+	// classes and aliases are keyed by their Python name
+	classes map[string]string
+	aliases map[string]string
+	// names maps component names to their Python name
+	names map[string]string
+	// pages maps mserve.Page components to the Python type of their items,
+	// pageItems to the schema of their items
+	pages     map[string]string
+	pageItems map[string]*openapi3.SchemaRef
+	// schemas are the components, for finding the component of inlined items
+	schemas                openapi3.Schemas
+	usesLiteral, usesUnion bool
+}
+
+func newPyModels() *pyModels {
+	return &pyModels{
+		classes:   map[string]string{},
+		aliases:   map[string]string{},
+		names:     map[string]string{},
+		pages:     map[string]string{},
+		pageItems: map[string]*openapi3.SchemaRef{},
+	}
+}
+
+// ident returns the Python class name of component name.
+func (m *pyModels) ident(name string) string {
+	if n, ok := m.names[name]; ok {
+		return n
+	}
+	n := goIdent(name)
+	if pyReserved[n] {
+		n += "Model"
+	}
+	m.names[name] = n
+	return n
+}
+
+// unique returns name, suffixed with a number when it is already declared.
+func (m *pyModels) unique(name string) string {
+	n := name
+	for i := 2; ; i++ {
+		_, class := m.classes[n]
+		_, alias := m.aliases[n]
+		if !class && !alias && !pyReserved[n] {
+			return n
+		}
+		n = name + strconv.Itoa(i)
+	}
+}
+
+// detectPages finds the components shaped like mserve.Page.
+func (m *pyModels) detectPages(schemas openapi3.Schemas) {
+	m.schemas = schemas
+	for _, name := range sortedSchemaNames(schemas) {
+		ref := schemas[name]
+		if ref == nil || ref.Value == nil {
+			continue
+		}
+		props := ref.Value.Properties
+		items := props["items"]
+		if items == nil || items.Value == nil || !hasType(items.Value, openapi3.TypeArray) {
+			continue
+		}
+		if props["page"] == nil || props["limit"] == nil || props["total"] == nil || props["totalPages"] == nil {
+			continue
+		}
+		pyName := m.ident(name)
+		m.pageItems[pyName] = m.componentRef(items.Value.Items)
+		m.pages[pyName] = m.typeOf(m.pageItems[pyName], pyName+"Item", false)
+	}
+}
+
+// componentRef returns a $ref to the component ref is an inlined copy of, or
+// ref itself. Page items are inlined by the schema generator.
+func (m *pyModels) componentRef(ref *openapi3.SchemaRef) *openapi3.SchemaRef {
+	if ref == nil || ref.Ref != "" || ref.Value == nil || len(ref.Value.Properties) == 0 {
+		return ref
+	}
+	want := schemaFingerprint(ref.Value)
+	for _, name := range sortedSchemaNames(m.schemas) {
+		c := m.schemas[name]
+		if c != nil && c.Value != nil && schemaFingerprint(c.Value) == want {
+			return openapi3.NewSchemaRef("#/components/schemas/"+name, c.Value)
+		}
+	}
+	return ref
+}
+
+func schemaFingerprint(s *openapi3.Schema) string {
+	c := *s
+	c.Title = ""
+	raw, _ := c.MarshalJSON()
+	return string(raw)
+}
+
+func (m *pyModels) declareComponent(name string, ref *openapi3.SchemaRef) {
+	pyName := m.ident(name)
+	if _, ok := m.pages[pyName]; ok {
+		m.aliases[pyName] = fmt.Sprintf("%s = Page[%s]\n", pyName, m.typeOf(m.pageItems[pyName], pyName+"Item", true))
+		return
+	}
+	if ref == nil || ref.Value == nil {
+		m.aliases[pyName] = pyName + " = Any\n"
+		return
+	}
+	if isStructSchema(ref.Value) {
+		m.declareClass(pyName, ref.Value)
+		return
+	}
+	m.aliases[pyName] = ""
+	m.aliases[pyName] = fmt.Sprintf("%s = %s\n", pyName, m.typeOf(ref, pyName+"Item", true))
+}
+
+// declareClass adds a dataclass for s, required fields first as Python
+// requires fields without defaults to precede the others.
+func (m *pyModels) declareClass(name string, s *openapi3.Schema) {
+	// reserve the name first so self references resolve to it
+	m.classes[name] = ""
+	props := openapi3.Schemas{}
+	required := map[string]bool{}
+	collectProperties(s, props, required)
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if required[keys[i]] != required[keys[j]] {
+			return required[keys[i]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "@dataclass\nclass %s:\n", name)
+	pyDoc(&b, "    ", s.Description)
+	if s.Description != "" && len(keys) > 0 {
+		b.WriteString("\n")
+	}
+	if len(keys) == 0 {
+		if s.Description == "" {
+			b.WriteString("    pass\n")
+		}
+		m.classes[name] = b.String()
+		return
+	}
+	used := map[string]bool{}
+	for _, k := range keys {
+		field := pyName(k)
+		for i := 2; used[field]; i++ {
+			field = pyName(k) + strconv.Itoa(i)
+		}
+		used[field] = true
+		ref := props[k]
+		typ := m.typeOf(ref, name+goIdent(k), false)
+		var opts []string
+		if !required[k] || (ref.Value != nil && ref.Value.Nullable) {
+			typ = "Optional[" + typ + "]"
+		}
+		if !required[k] {
+			opts = append(opts, "default=None")
+		}
+		if field != k {
+			opts = append(opts, fmt.Sprintf("metadata={\"json\": %s}", pyString(k)))
+		}
+		switch {
+		case len(opts) == 0:
+			fmt.Fprintf(&b, "    %s: %s\n", field, typ)
+		case len(opts) == 1 && opts[0] == "default=None":
+			fmt.Fprintf(&b, "    %s: %s = None\n", field, typ)
+		default:
+			fmt.Fprintf(&b, "    %s: %s = field(%s)\n", field, typ, strings.Join(opts, ", "))
+		}
+		if ref.Value != nil && ref.Value.Description != "" {
+			pyDoc(&b, "    ", ref.Value.Description)
+		}
+	}
+	m.classes[name] = b.String()
+}
+
+// collectProperties flattens the properties of s and its allOf schemas.
+func collectProperties(s *openapi3.Schema, props openapi3.Schemas, required map[string]bool) {
+	for _, sub := range s.AllOf {
+		if sub != nil && sub.Value != nil {
+			collectProperties(sub.Value, props, required)
+		}
+	}
+	for k, v := range s.Properties {
+		props[k] = v
+	}
+	for _, r := range s.Required {
+		if _, ok := props[r]; ok {
+			required[r] = true
+		}
+	}
+}
+
+// typeOf returns the Python type of ref. hint names inline objects, which are
+// declared as dataclasses. quoted quotes class names for use outside of
+// annotations, where they may not be defined yet.
+func (m *pyModels) typeOf(ref *openapi3.SchemaRef, hint string, quoted bool) string {
+	if ref == nil {
+		return "Any"
+	}
+	if ref.Ref != "" {
+		const prefix = "#/components/schemas/"
+		if !strings.HasPrefix(ref.Ref, prefix) {
+			return "Any"
+		}
+		name := m.ident(strings.TrimPrefix(ref.Ref, prefix))
+		if quoted {
+			return pyString(name)
+		}
+		return name
+	}
+	s := ref.Value
+	if s == nil {
+		return "Any"
+	}
+	switch {
+	case len(s.Enum) > 0:
+		values := make([]string, 0, len(s.Enum))
+		for _, v := range s.Enum {
+			switch v := v.(type) {
+			case string:
+				values = append(values, pyString(v))
+			case bool:
+				values = append(values, map[bool]string{true: "True", false: "False"}[v])
+			case float64:
+				values = append(values, strconv.FormatFloat(v, 'f', -1, 64))
+			case nil:
+				values = append(values, "None")
+			default:
+				values = append(values, pyString(fmt.Sprint(v)))
+			}
+		}
+		m.usesLiteral = true
+		return "Literal[" + strings.Join(values, ", ") + "]"
+	case len(s.OneOf) > 0 || len(s.AnyOf) > 0:
+		refs := s.OneOf
+		if len(refs) == 0 {
+			refs = s.AnyOf
+		}
+		var types []string
+		for i, r := range refs {
+			types = append(types, m.typeOf(r, hint+strconv.Itoa(i+1), quoted))
+		}
+		if len(types) == 1 {
+			return types[0]
+		}
+		m.usesUnion = true
+		return "Union[" + strings.Join(types, ", ") + "]"
+	case isStructSchema(s):
+		name := m.unique(hint)
+		m.declareClass(name, s)
+		if quoted {
+			return pyString(name)
+		}
+		return name
+	case hasType(s, openapi3.TypeString):
+		return "str"
+	case hasType(s, openapi3.TypeInteger):
+		return "int"
+	case hasType(s, openapi3.TypeNumber):
+		return "float"
+	case hasType(s, openapi3.TypeBoolean):
+		return "bool"
+	case hasType(s, openapi3.TypeArray):
+		return "List[" + m.typeOf(s.Items, hint+"Item", quoted) + "]"
+	case s.AdditionalProperties.Schema != nil:
+		return "Dict[str, " + m.typeOf(s.AdditionalProperties.Schema, hint+"Value", quoted) + "]"
+	case hasType(s, openapi3.TypeObject):
+		return "Dict[str, Any]"
+	}
+	return "Any"
+}
+
+// source renders models.py: the dataclasses, then the aliases, which may
+// refer to classes and are evaluated at import time.
+func (m *pyModels) source() string {
+	var b strings.Builder
+	b.WriteString(pyHeader)
+	b.WriteString("from __future__ import annotations\n\n")
+	b.WriteString("from dataclasses import dataclass, field\n")
+	typing := []string{"Any", "Dict", "Generic", "List"}
+	if m.usesLiteral {
+		typing = append(typing, "Literal")
+	}
+	typing = append(typing, "Optional", "TypeVar")
+	if m.usesUnion {
+		typing = append(typing, "Union")
+	}
+	fmt.Fprintf(&b, "from typing import %s\n\n", strings.Join(typing, ", "))
+	b.WriteString(`T = TypeVar("T")
+
+
+@dataclass
+class Page(Generic[T]):
+    """One page of a paginated list, mserve.Page on the server."""
+
+    items: List[T] = field(default_factory=list)
+    page: int = 0
+    limit: int = 0
+    total: int = 0
+    total_pages: int = field(default=0, metadata={"json": "totalPages"})
+    next_cursor: str = field(default="", metadata={"json": "nextCursor"})
+`)
+	for _, name := range sortedKeys(m.classes) {
+		b.WriteString("\n\n")
+		b.WriteString(m.classes[name])
+	}
+	if len(m.aliases) > 0 {
+		b.WriteString("\n\n")
+		for _, name := range sortedKeys(m.aliases) {
+			b.WriteString(m.aliases[name])
+		}
+	}
+	return b.String()
+}
+
+// pyOperation is one client method.
+type pyOperation struct {
+	Name, Method, Path, Description  string
+	PathParams, QueryParams, Headers []pyParam
+	Body                             string
+	BodyOptional                     bool
+	Return                           string
+	// PageItem is the item type when the operation returns a Page and takes a page parameter
+	PageItem string
+}
+
+type pyParam struct {
+	Name, Field, Type string
+	Required          bool
+}
+
+// operations lists the client methods, named like the Go client.
+func (m *pyModels) operations(doc *openapi3.T) []pyOperation {
+	if doc.Paths == nil {
+		return nil
+	}
+	var ops []pyOperation
+	used := map[string]int{}
+	paths := doc.Paths.Map()
+	keys := make([]string, 0, len(paths))
+	for k := range paths {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, p := range keys {
+		// the Go client skips these as well
+		if strings.HasPrefix(p, "/_") {
+			continue
+		}
+		item := paths[p]
+		for _, method := range operationMethods {
+			op := item.GetOperation(method)
+			if op == nil {
+				continue
+			}
+			name := ToSnakeCase(ClientFuncName(method, p))
+			if n := used[name]; n > 0 {
+				used[name]++
+				name += "_" + strconv.Itoa(n+1)
+			} else {
+				used[name] = 1
+			}
+			hint := ClientFuncName(method, p)
+			o := pyOperation{Name: name, Method: method, Path: p, Description: op.Summary, Return: "None"}
+			if op.Description != "" {
+				o.Description = op.Description
+			}
+			fields := map[string]bool{}
+			for _, ref := range mergedParameters(item.Parameters, op.Parameters) {
+				prm := ref.Value
+				pp := pyParam{Name: prm.Name, Field: pyName(prm.Name), Type: "str", Required: prm.Required}
+				if prm.Schema != nil {
+					pp.Type = m.typeOf(prm.Schema, hint+goIdent(prm.Name), false)
+				}
+				for i := 2; fields[pp.Field]; i++ {
+					pp.Field = pyName(prm.Name) + strconv.Itoa(i)
+				}
+				fields[pp.Field] = true
+				switch prm.In {
+				case openapi3.ParameterInPath:
+					pp.Required = true
+					o.PathParams = append(o.PathParams, pp)
+				case openapi3.ParameterInQuery:
+					o.QueryParams = append(o.QueryParams, pp)
+				case openapi3.ParameterInHeader:
+					o.Headers = append(o.Headers, pp)
+				}
+			}
+			if op.RequestBody != nil && op.RequestBody.Value != nil {
+				if schema := jsonSchema(op.RequestBody.Value.Content); schema != nil {
+					o.Body = m.typeOf(schema, hint+"Body", false)
+					o.BodyOptional = !op.RequestBody.Value.Required
+				}
+			}
+			if op.Responses != nil {
+				for _, code := range []string{"200", "201", "202", "203", "206"} {
+					resp := op.Responses.Value(code)
+					if resp == nil || resp.Value == nil {
+						continue
+					}
+					if schema := jsonSchema(resp.Value.Content); schema != nil {
+						o.Return = m.typeOf(schema, hint+"Response", false)
+					}
+					break
+				}
+			}
+			if item, ok := m.pages[o.Return]; ok && o.hasQuery("page") {
+				o.PageItem = item
+			}
+			ops = append(ops, o)
+		}
+	}
+	return ops
+}
+
+func (o pyOperation) hasQuery(name string) bool {
+	for _, q := range o.QueryParams {
+		if q.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// signature returns the parameters of the method: path parameters and the
+// body positionally, query and header parameters as keywords. skip leaves out
+// query parameters, e.g. "page" for the iterator method.
+func (o pyOperation) signature(skip ...string) string {
+	args := []string{"self"}
+	for _, p := range o.PathParams {
+		args = append(args, p.Field+": "+p.Type)
+	}
+	if o.Body != "" {
+		if o.BodyOptional {
+			args = append(args, "body: Optional["+o.Body+"] = None")
+		} else {
+			args = append(args, "body: "+o.Body)
+		}
+	}
+	var kw []string
+	for _, list := range [][]pyParam{o.QueryParams, o.Headers} {
+		for _, p := range list {
+			if contains(skip, p.Name) {
+				continue
+			}
+			if p.Required {
+				kw = append(kw, p.Field+": "+p.Type)
+			} else {
+				kw = append(kw, p.Field+": Optional["+p.Type+"] = None")
+			}
+		}
+	}
+	if len(kw) > 0 {
+		args = append(args, "*")
+		args = append(args, kw...)
+	}
+	return strings.Join(args, ", ")
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+var pyPathParam = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// requestCall returns the self.request(...) expression of o.
+func (o pyOperation) requestCall(page string) string {
+	fields := map[string]string{}
+	for _, p := range o.PathParams {
+		fields[p.Name] = p.Field
+	}
+	path := pyPathParam.ReplaceAllStringFunc(o.Path, func(m string) string {
+		name := strings.Trim(m, "{}")
+		if f, ok := fields[name]; ok {
+			return "{quote_path(" + f + ")}"
+		}
+		return m
+	})
+	path = strings.ReplaceAll(path, `"`, `\"`)
+	if len(o.PathParams) > 0 {
+		path = `f"` + path + `"`
+	} else {
+		path = `"` + path + `"`
+	}
+	args := []string{pyString(o.Method), path}
+	if len(o.QueryParams) > 0 {
+		var params []string
+		for _, q := range o.QueryParams {
+			v := q.Field
+			if q.Name == "page" && page != "" {
+				v = page
+			}
+			params = append(params, pyString(q.Name)+": "+v)
+		}
+		args = append(args, "params={"+strings.Join(params, ", ")+"}")
+	}
+	if o.Body != "" {
+		args = append(args, "body=body")
+	}
+	if len(o.Headers) > 0 {
+		var headers []string
+		for _, h := range o.Headers {
+			headers = append(headers, pyString(h.Name)+": "+h.Field)
+		}
+		args = append(args, "headers={"+strings.Join(headers, ", ")+"}")
+	}
+	return "self.request(" + strings.Join(args, ", ") + ")"
+}
+
+func (m *pyModels) client(doc *openapi3.T, className string) string {
+	ops := m.operations(doc)
+	var body strings.Builder
+	fmt.Fprintf(&body, "\n\nclass %s(BaseClient):\n", className)
+	desc := ""
+	if doc.Info != nil {
+		desc = doc.Info.Description
+	}
+	if desc == "" {
+		desc = "Client of the " + className + " API."
+	}
+	pyDoc(&body, "    ", desc)
+	for _, op := range ops {
+		body.WriteString("\n")
+		fmt.Fprintf(&body, "    def %s(%s) -> %s:\n", op.Name, op.signature(), op.Return)
+		doc := op.Description
+		if doc != "" {
+			doc += "\n\n"
+		}
+		pyDoc(&body, "        ", doc+op.Method+" "+op.Path)
+		if op.Return == "None" {
+			fmt.Fprintf(&body, "        %s\n", op.requestCall(""))
+		} else {
+			fmt.Fprintf(&body, "        return from_json(%s, %s)\n", op.Return, op.requestCall(""))
+		}
+		if op.PageItem == "" {
+			continue
+		}
+		body.WriteString("\n")
+		fmt.Fprintf(&body, "    def %s_iter(%s) -> PageIterator[%s]:\n", op.Name, op.signature("page"), op.PageItem)
+		pyDoc(&body, "        ", "Iterates the items of every page of "+op.Name+", fetching pages as they are needed.")
+		fmt.Fprintf(&body, "        return PageIterator(lambda page: from_json(%s, %s))\n", op.Return, op.requestCall("page"))
+	}
+
+	src := body.String()
+	var models []string
+	for _, name := range append(sortedKeys(m.classes), sortedKeys(m.aliases)...) {
+		if regexp.MustCompile(`\b` + regexp.QuoteMeta(name) + `\b`).MatchString(src) {
+			models = append(models, name)
+		}
+	}
+	sort.Strings(models)
+	var typing []string
+	for _, t := range []string{"Any", "Dict", "List", "Literal", "Optional", "Union"} {
+		if regexp.MustCompile(`\b` + t + `\[`).MatchString(src) {
+			typing = append(typing, t)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(pyHeader)
+	b.WriteString("from __future__ import annotations\n\n")
+	if len(typing) > 0 {
+		fmt.Fprintf(&b, "from typing import %s\n\n", strings.Join(typing, ", "))
+	}
+	b.WriteString("from ._backoff import BackOff\n")
+	b.WriteString("from ._iterator import PageIterator\n")
+	b.WriteString("from ._runtime import ApiError, BaseClient, from_json, quote_path\n")
+	if len(models) > 0 {
+		fmt.Fprintf(&b, "from .models import %s\n", strings.Join(models, ", "))
+	}
+	b.WriteString("\n__all__ = [\"ApiError\", \"BackOff\", \"PageIterator\", " + pyString(className) + "]\n")
+	b.WriteString(src)
+	return b.String()
+}
+
+func pyInit(className string) string {
+	return pyHeader + fmt.Sprintf(`from . import models
+from ._backoff import BackOff
+from ._iterator import PageIterator
+from ._runtime import ApiError, from_json, to_json
+from .client import %[1]s
+from .models import Page
+
+__all__ = [
+    "ApiError",
+    "BackOff",
+    %[2]s,
+    "Page",
+    "PageIterator",
+    "from_json",
+    "models",
+    "to_json",
+]
+`, className, pyString(className))
+}
+
+const pyProject = `[build-system]
+requires = ["setuptools>=61"]
+build-backend = "setuptools.build_meta"
+
+[project]
+name = %q
+version = %q
+requires-python = ">=3.8"
+dependencies = ["requests>=2.25"]
+
+[tool.setuptools]
+packages = [%q]
+
+[tool.setuptools.package-data]
+"*" = ["py.typed"]
+`
+
+const pyBackOff = pyHeader + `import random
+import time
+from dataclasses import dataclass
+from typing import Iterator
+
+
+@dataclass
+class BackOff:
+    """Exponential backoff with the schedule of clientpkg.BackOff.
+
+    Waits start at initial_interval and grow by multiplier up to
+    max_interval, each randomized by +/- randomization_factor. Retrying stops
+    after max_retry retries or once max_elapsed_time has passed, 0 disables
+    the limit. Durations are in seconds.
+    """
+
+    max_retry: int = 3
+    max_interval: float = 60.0
+    max_elapsed_time: float = 900.0
+    initial_interval: float = 0.5
+    randomization_factor: float = 0.5
+    multiplier: float = 1.5
+
+    def intervals(self) -> Iterator[float]:
+        """Yields the waits before each retry."""
+        start = time.monotonic()
+        interval = self.initial_interval
+        for _ in range(self.max_retry):
+            delta = self.randomization_factor * interval
+            wait = random.uniform(interval - delta, interval + delta)
+            if self.max_elapsed_time and time.monotonic() - start + wait > self.max_elapsed_time:
+                return
+            yield wait
+            interval = min(interval * self.multiplier, self.max_interval)
+`
+
+const pyIterator = pyHeader + `from typing import Callable, Generic, Iterator, List, Optional, TypeVar
+
+from .models import Page
+
+T = TypeVar("T")
+
+
+class PageIterator(Generic[T]):
+    """Iterates the items of a paginated operation, like clientpkg.Iterator.
+
+    Pages are fetched as the iteration reaches them and every iteration starts
+    over at the first page::
+
+        for user in client.get_users_iter():
+            ...
+    """
+
+    def __init__(self, fetch: Callable[[int], Page[T]], first_page: int = 1) -> None:
+        self._fetch = fetch
+        self._first_page = first_page
+        self.current: Optional[Page[T]] = None
+        """The page fetched last."""
+
+    @property
+    def total(self) -> Optional[int]:
+        """Total number of items, known once the first page was fetched."""
+        return self.current.total if self.current is not None else None
+
+    def pages(self) -> Iterator[Page[T]]:
+        """Yields the pages until the last one."""
+        number = self._first_page
+        while True:
+            page = self._fetch(number)
+            self.current = page
+            yield page
+            if not page.items or number >= page.total_pages:
+                return
+            number += 1
+
+    def __iter__(self) -> Iterator[T]:
+        for page in self.pages():
+            yield from page.items
+
+    def full_list(self) -> List[T]:
+        """Fetches every page and returns all items."""
+        return list(self)
+`
+
+const pyRuntime = pyHeader + `import dataclasses
+import time
+from typing import (
+    Any,
+    Dict,
+    ForwardRef,
+    Iterable,
+    Literal,
+    Mapping,
+    Optional,
+    TypeVar,
+    Union,
+    get_args,
+    get_origin,
+    get_type_hints,
+)
+from urllib.parse import quote
+
+import requests
+
+from . import models
+from ._backoff import BackOff
+
+
+class ApiError(Exception):
+    """A response with a 4xx or 5xx status."""
+
+    def __init__(self, status: int, message: str, body: Any = None, response: Optional[requests.Response] = None) -> None:
+        super().__init__(f"{status}: {message}")
+        self.status = status
+        self.message = message
+        self.body = body
+        self.response = response
+
+    @classmethod
+    def from_response(cls, response: requests.Response) -> "ApiError":
+        try:
+            body = response.json()
+        except ValueError:
+            body = response.text
+        message = response.reason or "request failed"
+        if isinstance(body, dict):
+            message = body.get("error") or body.get("message") or message
+        elif isinstance(body, str) and body.strip():
+            message = body.strip()
+        return cls(response.status_code, str(message), body, response)
+
+
+def _resolve(tp: Any) -> Any:
+    if isinstance(tp, str):
+        return eval(tp, vars(models))
+    if isinstance(tp, ForwardRef):
+        return eval(tp.__forward_arg__, vars(models))
+    return tp
+
+
+def from_json(tp: Any, value: Any, _params: Optional[Dict[Any, Any]] = None) -> Any:
+    """Converts decoded JSON into tp: dataclasses, lists, dicts and unions are
+    built recursively, other values are returned as they are."""
+    if isinstance(tp, TypeVar):
+        tp = (_params or {}).get(tp, Any)
+    tp = _resolve(tp)
+    if value is None or tp is Any:
+        return value
+    origin = get_origin(tp)
+    args = get_args(tp)
+    if origin is Union:
+        for arg in args:
+            if arg is type(None):
+                continue
+            try:
+                return from_json(arg, value, _params)
+            except (TypeError, ValueError, KeyError, AttributeError):
+                continue
+        return value
+    if origin is Literal:
+        return value
+    if origin is list:
+        if not isinstance(value, list):
+            raise TypeError(f"expected a list, got {type(value).__name__}")
+        return [from_json(args[0] if args else Any, v, _params) for v in value]
+    if origin is dict:
+        if not isinstance(value, dict):
+            raise TypeError(f"expected an object, got {type(value).__name__}")
+        return {k: from_json(args[1] if len(args) > 1 else Any, v, _params) for k, v in value.items()}
+    cls = origin or tp
+    if dataclasses.is_dataclass(cls):
+        if not isinstance(value, dict):
+            raise TypeError(f"expected an object for {cls.__name__}, got {type(value).__name__}")
+        params = dict(zip(getattr(cls, "__parameters__", ()), args))
+        hints = get_type_hints(cls)
+        kwargs = {}
+        for f in dataclasses.fields(cls):
+            key = f.metadata.get("json", f.name)
+            if key in value:
+                kwargs[f.name] = from_json(hints[f.name], value[key], params)
+            elif f.default is dataclasses.MISSING and f.default_factory is dataclasses.MISSING:
+                kwargs[f.name] = None
+        return cls(**kwargs)
+    if tp is float and isinstance(value, int) and not isinstance(value, bool):
+        return float(value)
+    return value
+
+
+def to_json(value: Any) -> Any:
+    """Converts dataclasses into JSON values, leaving out None fields."""
+    if dataclasses.is_dataclass(value) and not isinstance(value, type):
+        out = {}
+        for f in dataclasses.fields(value):
+            v = getattr(value, f.name)
+            if v is not None:
+                out[f.metadata.get("json", f.name)] = to_json(v)
+        return out
+    if isinstance(value, (list, tuple)):
+        return [to_json(v) for v in value]
+    if isinstance(value, dict):
+        return {k: to_json(v) for k, v in value.items()}
+    return value
+
+
+def quote_path(value: Any) -> str:
+    """Escapes a path parameter."""
+    return quote(_query_value(value), safe="")
+
+
+def _query_value(value: Any) -> Any:
+    if isinstance(value, bool):
+        return "true" if value else "false"
+    if isinstance(value, (list, tuple)):
+        return [_query_value(v) for v in value]
+    return str(value)
+
+
+class BaseClient:
+    """Sends the requests of the generated client.
+
+    With a backoff, requests answered with one of retry_statuses are retried
+    on its schedule, like clientpkg.Client.RequestWithRetry.
+    """
+
+    def __init__(
+        self,
+        base_url: str,
+        session: Optional[requests.Session] = None,
+        backoff: Optional[BackOff] = None,
+        headers: Optional[Mapping[str, str]] = None,
+        timeout: Optional[float] = 30.0,
+        retry_statuses: Iterable[int] = (429,),
+    ) -> None:
+        self.base_url = base_url.rstrip("/")
+        self.session = session or requests.Session()
+        self.backoff = backoff
+        self.headers = dict(headers or {})
+        self.timeout = timeout
+        self.retry_statuses = frozenset(retry_statuses)
+
+    def close(self) -> None:
+        self.session.close()
+
+    def __enter__(self) -> "BaseClient":
+        return self
+
+    def __exit__(self, *exc: Any) -> None:
+        self.close()
+
+    def request(
+        self,
+        method: str,
+        path: str,
+        params: Optional[Mapping[str, Any]] = None,
+        body: Any = None,
+        headers: Optional[Mapping[str, Any]] = None,
+    ) -> Any:
+        """Sends the request and returns the decoded JSON body, None when the
+        response has none. Raises ApiError for 4xx and 5xx responses."""
+        query = {k: _query_value(v) for k, v in (params or {}).items() if v is not None}
+        request_headers = dict(self.headers)
+        request_headers.update({k: str(v) for k, v in (headers or {}).items() if v is not None})
+        payload = to_json(body) if body is not None else None
+        waits = self.backoff.intervals() if self.backoff is not None else iter(())
+        while True:
+            response = self.session.request(
+                method,
+                self.base_url + path,
+                params=query,
+                json=payload,
+                headers=request_headers,
+                timeout=self.timeout,
+            )
+            if response.status_code not in self.retry_statuses:
+                break
+            wait = next(waits, None)
+            if wait is None:
+                break
+            time.sleep(wait)
+        if response.status_code >= 400:
+            raise ApiError.from_response(response)
+        if response.status_code == 204 or not response.content:
+            return None
+        try:
+            return response.json()
+        except ValueError:
+            return response.text
+`
@@ -0,0 +1,896 @@
+package generators
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/format"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/DarlingGoose/mserve/nuxt3FromOpenApi"
+	"github.com/DarlingGoose/mserve/openapidiff"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/spf13/cobra"
+)
+
+const (
+	serverModelsFile    = "models.gen.go"
+	serverEndpointsFile = "endpoints.gen.go"
+	serverHandlersFile  = "handlers.go"
+	generatedHeader     = "// Code generated by mserve generate server. DO NOT EDIT.\n\n"
+)
+
+// operationMethods is the order operations of a path are emitted in.
+var operationMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodHead, http.MethodOptions,
+}
+
+// ServerGenerator is the reverse of mserve.GenerateOpenAPI: it turns an OpenAPI
+// document into model structs, a Handlers interface with one method per
+// operation and an Endpoints constructor wiring them into []*mserve.Endpoint.
+//
+// models.gen.go and endpoints.gen.go are rewritten on every run. handlers.go,
+// where the implementation lives, is only written when it does not exist yet;
+// operations added to the spec later are answered with 501 by the embedded
+// UnimplementedHandlers until they are implemented.
+type ServerGenerator struct {
+	// Dir the files are written to
+	Dir string
+	// Package name of the generated files, defaults to the base name of Dir
+	Package string
+}
+
+func NewServerGenerator(dir, pkg string) *ServerGenerator {
+	return &ServerGenerator{Dir: dir, Package: pkg}
+}
+
+// GenerateFromFile loads the OpenAPI document at a file path or URL and generates from it.
+func (g *ServerGenerator) GenerateFromFile(ctx context.Context, location string) error {
+	doc, err := openapidiff.Load(ctx, location)
+	if err != nil {
+		return fmt.Errorf("loading %s: %w", location, err)
+	}
+	return g.GenerateFromSpec(doc)
+}
+
+func (g *ServerGenerator) GenerateFromSpec(doc *openapi3.T) error {
+	if doc == nil {
+		return errors.New("openapi document is nil")
+	}
+	pkg := g.Package
+	if pkg == "" {
+		abs, err := filepath.Abs(g.Dir)
+		if err != nil {
+			return err
+		}
+		pkg = ToSnakeCase(filepath.Base(abs))
+	}
+	if err := ensureDir(g.Dir); err != nil {
+		return err
+	}
+
+	models := newGoModels()
+	if doc.Components != nil {
+		names := sortedSchemaNames(doc.Components.Schemas)
+		// reserve component names so inline objects never take them
+		for _, name := range names {
+			models.decls[goIdent(name)] = ""
+		}
+		for _, name := range names {
+			models.declareComponent(name, doc.Components.Schemas[name])
+		}
+	}
+	ops := serverOperations(doc, models)
+
+	if err := writeGoSource(filepath.Join(g.Dir, serverModelsFile), generatedHeader+models.source(pkg)); err != nil {
+		return err
+	}
+	if err := writeGoSource(filepath.Join(g.Dir, serverEndpointsFile), generatedHeader+endpointsSource(pkg, ops)); err != nil {
+		return err
+	}
+	handlers := filepath.Join(g.Dir, serverHandlersFile)
+	if _, err := os.Stat(handlers); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return writeGoSource(handlers, handlersSource(pkg, ops))
+}
+
+// ServerCommand returns the "server <spec>" subcommand generating Endpoint stubs.
+func ServerCommand() *cobra.Command {
+	var out, pkg string
+	cmd := &cobra.Command{
+		Use:   "server <spec>",
+		Short: "Generate mserve models, a Handlers interface and Endpoints from an OpenAPI document",
+		Long: "Reads an OpenAPI document (file or URL) and writes models.gen.go and\n" +
+			"endpoints.gen.go to --out. handlers.go is only created when missing, so\n" +
+			"regenerating never overwrites the implementation.",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return NewServerGenerator(out, pkg).GenerateFromFile(cmd.Context(), args[0])
+		},
+	}
+	cmd.Flags().StringVar(&out, "out", ".", "directory the Go files are written to")
+	cmd.Flags().StringVar(&pkg, "package", "", "package name, defaults to the name of --out")
+	return cmd
+}
+
+func writeGoSource(file, src string) error {
+	formatted, err := format.Source([]byte(src))
+	if err != nil {
+		return fmt.Errorf("formatting %s: %w", file, err)
+	}
+	return os.WriteFile(file, formatted, 0o644)
+}
+
+// serverOperation is one OpenAPI operation as it is wired into an Endpoint.
+type serverOperation struct {
+	Method      string
+	HTTPMethod  string
+	Path        string
+	Name        string
+	Description string
+	Params      []serverParam
+	Headers     []serverParam
+	RequestBody string
+	Responses   []serverResponse
+}
+
+type serverParam struct {
+	Name string
+	// In is openapi3.ParameterInPath or ParameterInQuery for Params
+	In          string
+	Description string
+	Default     string
+	Required    bool
+	Type        string
+	Enum        []string
+}
+
+type serverResponse struct {
+	Status  int
+	Message string
+	Body    string
+	Headers []serverParam
+}
+
+func serverOperations(doc *openapi3.T, models *goModels) []serverOperation {
+	if doc.Paths == nil {
+		return nil
+	}
+	var ops []serverOperation
+	used := map[string]int{}
+	paths := doc.Paths.Map()
+	keys := make([]string, 0, len(paths))
+	for k := range paths {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, p := range keys {
+		item := paths[p]
+		for _, method := range operationMethods {
+			op := item.GetOperation(method)
+			if op == nil {
+				continue
+			}
+			name := op.OperationID
+			if name == "" {
+				name = strings.ToLower(method) + "_" + UrlToName(p)
+			}
+			goName := goIdent(name)
+			if n := used[goName]; n > 0 {
+				used[goName]++
+				goName += strconv.Itoa(n + 1)
+			} else {
+				used[goName] = 1
+			}
+			so := serverOperation{
+				Method:      goName,
+				HTTPMethod:  method,
+				Path:        p,
+				Name:        op.OperationID,
+				Description: op.Description,
+			}
+			if so.Name == "" {
+				so.Name = op.Summary
+			}
+			if so.Description == "" {
+				so.Description = op.Summary
+			}
+			for _, ref := range mergedParameters(item.Parameters, op.Parameters) {
+				prm := ref.Value
+				switch prm.In {
+				case openapi3.ParameterInPath, openapi3.ParameterInQuery:
+					param := paramOption(prm.Name, prm.Description, prm.Required || prm.In == openapi3.ParameterInPath, prm.Schema)
+					param.In = prm.In
+					so.Params = append(so.Params, param)
+				case openapi3.ParameterInHeader:
+					so.Headers = append(so.Headers, paramOption(prm.Name, prm.Description, prm.Required, prm.Schema))
+				}
+			}
+			if op.RequestBody != nil && op.RequestBody.Value != nil {
+				if schema := jsonSchema(op.RequestBody.Value.Content); schema != nil {
+					so.RequestBody = models.zeroValue(schema, goName+"Request")
+				}
+			}
+			so.Responses = serverResponses(op, goName, models)
+			ops = append(ops, so)
+		}
+	}
+	return ops
+}
+
+// mergedParameters applies operation parameters over the path item ones.
+func mergedParameters(pathParams, opParams openapi3.Parameters) []*openapi3.ParameterRef {
+	var out []*openapi3.ParameterRef
+	index := map[string]int{}
+	for _, list := range []openapi3.Parameters{pathParams, opParams} {
+		for _, ref := range list {
+			if ref == nil || ref.Value == nil {
+				continue
+			}
+			key := ref.Value.In + ":" + ref.Value.Name
+			if i, ok := index[key]; ok {
+				out[i] = ref
+				continue
+			}
+			index[key] = len(out)
+			out = append(out, ref)
+		}
+	}
+	return out
+}
+
+func serverResponses(op *openapi3.Operation, goName string, models *goModels) []serverResponse {
+	if op.Responses == nil {
+		return nil
+	}
+	var out []serverResponse
+	for code, ref := range op.Responses.Map() {
+		status, err := strconv.Atoi(code)
+		if err != nil || ref == nil || ref.Value == nil {
+			continue
+		}
+		resp := serverResponse{Status: status}
+		if ref.Value.Description != nil {
+			resp.Message = *ref.Value.Description
+		}
+		if schema := jsonSchema(ref.Value.Content); schema != nil {
+			resp.Body = models.zeroValue(schema, goName+"Response"+code)
+		}
+		for _, name := range sortedHeaderNames(ref.Value.Headers) {
+			h := ref.Value.Headers[name]
+			if h == nil || h.Value == nil {
+				continue
+			}
+			resp.Headers = append(resp.Headers, paramOption(name, h.Value.Description, h.Value.Required, h.Value.Schema))
+		}
+		out = append(out, resp)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Status < out[j].Status })
+	return out
+}
+
+func paramOption(name, description string, required bool, schema *openapi3.SchemaRef) serverParam {
+	p := serverParam{Name: name, Description: description, Required: required, Type: "string"}
+	if schema == nil || schema.Value == nil {
+		return p
+	}
+	s := schema.Value
+	if s.Type != nil && len(s.Type.Slice()) > 0 {
+		p.Type = s.Type.Slice()[0]
+	}
+	if s.Default != nil {
+		p.Default = fmt.Sprint(s.Default)
+	}
+	for _, e := range s.Enum {
+		p.Enum = append(p.Enum, fmt.Sprint(e))
+	}
+	return p
+}
+
+// jsonSchema returns the schema of the JSON media type of content, if any.
+func jsonSchema(content openapi3.Content) *openapi3.SchemaRef {
+	if mt := content.Get("application/json"); mt != nil && mt.Schema != nil {
+		return mt.Schema
+	}
+	for name, mt := range content {
+		if strings.HasSuffix(name, "+json") && mt.Schema != nil {
+			return mt.Schema
+		}
+	}
+	return nil
+}
+
+func sortedSchemaNames(schemas openapi3.Schemas) []string {
+	names := make([]string, 0, len(schemas))
+	for k := range schemas {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedHeaderNames(headers openapi3.Headers) []string {
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// commonInitialisms are written in upper case in Go identifiers, e.g. UserID
+// rather than UserId.
+var commonInitialisms = map[string]bool{
+	"ACL": true, "API": true, "ASCII": true, "CPU": true, "CSS": true, "DNS": true,
+	"EOF": true, "GUID": true, "HTML": true, "HTTP": true, "HTTPS": true, "ID": true,
+	"IP": true, "JSON": true, "JWT": true, "QPS": true, "RAM": true, "RPC": true,
+	"SLA": true, "SMTP": true, "SQL": true, "SSH": true, "TCP": true, "TLS": true,
+	"TTL": true, "UDP": true, "UI": true, "UID": true, "URI": true, "URL": true,
+	"UTF8": true, "UUID": true, "VM": true, "XML": true, "XMPP": true, "XSRF": true,
+	"XSS": true,
+}
+
+// goIdent turns an OpenAPI name into an exported Go identifier.
+func goIdent(s string) string {
+	id := strings.Join(goWords(s), "")
+	if id == "" {
+		return "X"
+	}
+	if r := []rune(id)[0]; !unicode.IsLetter(r) {
+		id = "X" + id
+	}
+	return id
+}
+
+// goLocalIdent turns an OpenAPI name into an unexported Go identifier, e.g.
+// groupID or urlPath.
+func goLocalIdent(s string) string {
+	words := goWords(s)
+	if len(words) == 0 {
+		return "x"
+	}
+	words[0] = strings.ToLower(words[0])
+	id := strings.Join(words, "")
+	if r := []rune(id)[0]; !unicode.IsLetter(r) {
+		id = "x" + id
+	}
+	return id
+}
+
+// goWords splits s into capitalised words, initialisms in upper case.
+func goWords(s string) []string {
+	var words []string
+	for _, part := range strings.Split(nuxt3FromOpenApi.ToSnakeCase(s), "_") {
+		if part == "" {
+			continue
+		}
+		upper := strings.ToUpper(part)
+		switch {
+		case commonInitialisms[upper]:
+			words = append(words, upper)
+		case len(part) > 2 && strings.HasSuffix(part, "s") && commonInitialisms[upper[:len(upper)-1]]:
+			// plurals such as IDs and URLs
+			words = append(words, upper[:len(upper)-1]+"s")
+		default:
+			words = append(words, nuxt3FromOpenApi.ToPascalCase(part))
+		}
+	}
+	return words
+}
+
+// goModels collects the Go type declarations of an OpenAPI document.
+type goModels struct {
+	decls    map[string]string
+	structs  map[string]bool
+	usesTime bool
+}
+
+func newGoModels() *goModels {
+	return &goModels{decls: map[string]string{}, structs: map[string]bool{}}
+}
+
+func (m *goModels) source(pkg string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+	if m.usesTime {
+		b.WriteString("import \"time\"\n\n")
+	}
+	for _, name := range sortedKeys(m.decls) {
+		b.WriteString(m.decls[name])
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// unique returns name, suffixed with a counter when it is already declared.
+func (m *goModels) unique(name string) string {
+	if _, ok := m.decls[name]; !ok {
+		return name
+	}
+	for i := 2; ; i++ {
+		if _, ok := m.decls[name+strconv.Itoa(i)]; !ok {
+			return name + strconv.Itoa(i)
+		}
+	}
+}
+
+func refName(ref string) (string, bool) {
+	const prefix = "#/components/schemas/"
+	if !strings.HasPrefix(ref, prefix) {
+		return "", false
+	}
+	return goIdent(strings.TrimPrefix(ref, prefix)), true
+}
+
+func isStructSchema(s *openapi3.Schema) bool {
+	if s == nil {
+		return false
+	}
+	if len(s.AllOf) > 0 || len(s.Properties) > 0 {
+		return true
+	}
+	return false
+}
+
+func hasType(s *openapi3.Schema, t string) bool {
+	return s.Type != nil && s.Type.Is(t)
+}
+
+func (m *goModels) declareComponent(name string, ref *openapi3.SchemaRef) {
+	goName := goIdent(name)
+	if ref == nil || ref.Value == nil {
+		m.decls[goName] = fmt.Sprintf("type %s interface{}\n", goName)
+		return
+	}
+	s := ref.Value
+	switch {
+	case isStructSchema(s):
+		// reserve the name first so self references resolve to it
+		m.decls[goName] = ""
+		m.structs[goName] = true
+		m.decls[goName] = m.structDecl(goName, s)
+	case hasType(s, openapi3.TypeString) && len(s.Enum) > 0:
+		m.decls[goName] = enumDecl(goName, s)
+	default:
+		m.decls[goName] = ""
+		m.decls[goName] = docComment(goName, s.Description) + fmt.Sprintf("type %s %s\n", goName, m.typeOf(ref, goName+"Item"))
+	}
+}
+
+func docComment(name, description string) string {
+	if description == "" {
+		return ""
+	}
+	var b strings.Builder
+	for i, line := range strings.Split(strings.TrimSpace(description), "\n") {
+		if i == 0 {
+			line = name + " " + lowerFirst(line)
+		}
+		b.WriteString("// " + strings.TrimSpace(line) + "\n")
+	}
+	return b.String()
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	r := []rune(s)
+	if len(r) > 1 && unicode.IsUpper(r[1]) {
+		return s
+	}
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
+
+func enumDecl(name string, s *openapi3.Schema) string {
+	var b strings.Builder
+	b.WriteString(docComment(name, s.Description))
+	fmt.Fprintf(&b, "type %s string\n\nconst (\n", name)
+	for _, e := range s.Enum {
+		v := fmt.Sprint(e)
+		fmt.Fprintf(&b, "\t%s%s %s = %q\n", name, goIdent(v), name, v)
+	}
+	b.WriteString(")\n")
+	return b.String()
+}
+
+func (m *goModels) structDecl(name string, s *openapi3.Schema) string {
+	var b strings.Builder
+	b.WriteString(docComment(name, s.Description))
+	fmt.Fprintf(&b, "type %s struct {\n", name)
+	props := openapi3.Schemas{}
+	required := map[string]bool{}
+	for _, part := range s.AllOf {
+		if part == nil {
+			continue
+		}
+		if embedded, ok := refName(part.Ref); ok {
+			fmt.Fprintf(&b, "\t%s\n", embedded)
+			continue
+		}
+		if part.Value != nil {
+			for k, v := range part.Value.Properties {
+				props[k] = v
+			}
+			for _, r := range part.Value.Required {
+				required[r] = true
+			}
+		}
+	}
+	for k, v := range s.Properties {
+		props[k] = v
+	}
+	for _, r := range s.Required {
+		required[r] = true
+	}
+	for _, prop := range sortedSchemaNames(props) {
+		ref := props[prop]
+		field := goIdent(prop)
+		typ := m.fieldType(ref, name+field)
+		tag := prop
+		if !required[prop] {
+			tag += ",omitempty"
+		}
+		if ref != nil && ref.Value != nil && ref.Value.Description != "" && ref.Ref == "" {
+			for _, line := range strings.Split(strings.TrimSpace(ref.Value.Description), "\n") {
+				fmt.Fprintf(&b, "\t// %s\n", strings.TrimSpace(line))
+			}
+		}
+		fmt.Fprintf(&b, "\t%s %s `json:%q`\n", field, typ, tag)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// fieldType is typeOf with struct types referenced through a pointer.
+func (m *goModels) fieldType(ref *openapi3.SchemaRef, hint string) string {
+	typ := m.typeOf(ref, hint)
+	if m.structs[typ] {
+		return "*" + typ
+	}
+	return typ
+}
+
+// typeOf returns the Go type of ref, declaring inline objects under the hint name.
+func (m *goModels) typeOf(ref *openapi3.SchemaRef, hint string) string {
+	if ref == nil {
+		return "interface{}"
+	}
+	if name, ok := refName(ref.Ref); ok {
+		if isStructSchema(ref.Value) {
+			m.structs[name] = true
+		}
+		return name
+	}
+	s := ref.Value
+	if s == nil {
+		return "interface{}"
+	}
+	switch {
+	case isStructSchema(s):
+		name := m.unique(hint)
+		m.decls[name] = ""
+		m.structs[name] = true
+		m.decls[name] = m.structDecl(name, s)
+		return name
+	case hasType(s, openapi3.TypeArray):
+		return "[]" + m.fieldType(s.Items, hint+"Item")
+	case hasType(s, openapi3.TypeObject):
+		if s.AdditionalProperties.Schema != nil {
+			return "map[string]" + m.fieldType(s.AdditionalProperties.Schema, hint+"Value")
+		}
+		return "map[string]interface{}"
+	case hasType(s, openapi3.TypeString):
+		switch s.Format {
+		case "date-time":
+			m.usesTime = true
+			return "time.Time"
+		case "byte", "binary":
+			return "[]byte"
+		}
+		return "string"
+	case hasType(s, openapi3.TypeInteger):
+		if s.Format == "int32" {
+			return "int32"
+		}
+		return "int64"
+	case hasType(s, openapi3.TypeNumber):
+		if s.Format == "float" {
+			return "float32"
+		}
+		return "float64"
+	case hasType(s, openapi3.TypeBoolean):
+		return "bool"
+	}
+	return "interface{}"
+}
+
+// zeroValue returns a Go expression of the type of ref, used as an Endpoint Request or Response Body.
+func (m *goModels) zeroValue(ref *openapi3.SchemaRef, hint string) string {
+	typ := m.fieldType(ref, hint)
+	switch {
+	case strings.HasPrefix(typ, "*"):
+		return "&" + typ[1:] + "{}"
+	case strings.HasPrefix(typ, "[]"), strings.HasPrefix(typ, "map["):
+		return typ + "{}"
+	case typ == "interface{}":
+		return "map[string]interface{}{}"
+	}
+	return "new(" + typ + ")"
+}
+
+func endpointsSource(pkg string, ops []serverOperation) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+	// the params code is written first so only the packages it uses are imported
+	var params strings.Builder
+	for _, op := range ops {
+		paramsSource(&params, op)
+	}
+	b.WriteString("import (\n")
+	if strings.Contains(params.String(), "fmt.") {
+		b.WriteString("\t\"fmt\"\n")
+	}
+	b.WriteString("\t\"net/http\"\n")
+	if strings.Contains(params.String(), "strconv.") {
+		b.WriteString("\t\"strconv\"\n")
+	}
+	b.WriteString("\n\t\"github.com/DarlingGoose/mserve\"\n)\n\n")
+
+	b.WriteString("// Handlers has one method per operation of the OpenAPI document.\n")
+	b.WriteString("type Handlers interface {\n")
+	for _, op := range ops {
+		fmt.Fprintf(&b, "\t// %s handles %s %s\n", op.Method, op.HTTPMethod, op.Path)
+		fmt.Fprintf(&b, "\t%s(w http.ResponseWriter, r *http.Request)\n", op.Method)
+	}
+	b.WriteString("}\n\n")
+
+	b.WriteString("// UnimplementedHandlers answers every operation with 501 Not Implemented.\n")
+	b.WriteString("// Embed it so operations added to the spec later keep the build green.\n")
+	b.WriteString("type UnimplementedHandlers struct{}\n\n")
+	for _, op := range ops {
+		fmt.Fprintf(&b, "func (UnimplementedHandlers) %s(w http.ResponseWriter, r *http.Request) {\n", op.Method)
+		fmt.Fprintf(&b, "\tmserve.WriteError(w, r, http.StatusNotImplemented, %q)\n}\n\n", op.Method+" is not implemented")
+	}
+
+	b.WriteString("// Endpoints wires h into the endpoints described by the OpenAPI document.\n")
+	b.WriteString("func Endpoints(h Handlers) []*mserve.Endpoint {\n\treturn []*mserve.Endpoint{\n")
+	for _, op := range ops {
+		b.WriteString("\t\t{\n")
+		if op.Name != "" {
+			fmt.Fprintf(&b, "\t\t\tName: %q,\n", op.Name)
+		}
+		if op.Description != "" {
+			fmt.Fprintf(&b, "\t\t\tDescription: %q,\n", op.Description)
+		}
+		fmt.Fprintf(&b, "\t\t\tMethods: []string{%s},\n", httpMethodConst(op.HTTPMethod))
+		fmt.Fprintf(&b, "\t\t\tPath: %q,\n", op.Path)
+		fmt.Fprintf(&b, "\t\t\tHandler: h.%s,\n", op.Method)
+		if len(op.Params) > 0 || len(op.Headers) > 0 || op.RequestBody != "" {
+			b.WriteString("\t\t\tRequest: mserve.Request{\n")
+			writeOptions(&b, "Params", op.Params, "\t\t\t\t")
+			writeOptions(&b, "Headers", op.Headers, "\t\t\t\t")
+			if op.RequestBody != "" {
+				fmt.Fprintf(&b, "\t\t\t\tBody: %s,\n", op.RequestBody)
+			}
+			b.WriteString("\t\t\t},\n")
+		}
+		if len(op.Responses) > 0 {
+			b.WriteString("\t\t\tResponses: []mserve.Response{\n")
+			for _, resp := range op.Responses {
+				b.WriteString("\t\t\t\t{\n")
+				fmt.Fprintf(&b, "\t\t\t\t\tStatus: %d,\n", resp.Status)
+				if resp.Message != "" {
+					fmt.Fprintf(&b, "\t\t\t\t\tMessage: %q,\n", resp.Message)
+				}
+				if resp.Body != "" {
+					fmt.Fprintf(&b, "\t\t\t\t\tBody: %s,\n", resp.Body)
+				}
+				writeOptions(&b, "Headers", resp.Headers, "\t\t\t\t\t")
+				b.WriteString("\t\t\t\t},\n")
+			}
+			b.WriteString("\t\t\t},\n")
+		}
+		b.WriteString("\t\t},\n")
+	}
+	b.WriteString("\t}\n}\n")
+	b.WriteString(params.String())
+	return b.String()
+}
+
+// paramGoType returns the Go type a path or query parameter is read into.
+func paramGoType(typ string) string {
+	switch typ {
+	case "integer":
+		return "int64"
+	case "number":
+		return "float64"
+	case "boolean":
+		return "bool"
+	}
+	return "string"
+}
+
+// paramsSource writes the XxxParams struct of op with the path and query
+// parameters of the operation, and ReadXxxParams filling it from a request.
+func paramsSource(b *strings.Builder, op serverOperation) {
+	if len(op.Params) == 0 {
+		return
+	}
+	typ := op.Method + "Params"
+	fields := make([]string, len(op.Params))
+	used := map[string]int{}
+	for i, p := range op.Params {
+		fields[i] = goIdent(p.Name)
+		if n := used[fields[i]]; n > 0 {
+			fields[i] += strconv.Itoa(n + 1)
+		}
+		used[fields[i]]++
+	}
+
+	fmt.Fprintf(b, "\n// %s are the path and query parameters of %s.\n", typ, op.Method)
+	fmt.Fprintf(b, "type %s struct {\n", typ)
+	for i, p := range op.Params {
+		if p.Description != "" {
+			fmt.Fprintf(b, "\t// %s\n", strings.ReplaceAll(p.Description, "\n", "\n\t// "))
+		}
+		fmt.Fprintf(b, "\t%s %s\n", fields[i], paramGoType(p.Type))
+	}
+	b.WriteString("}\n\n")
+
+	fmt.Fprintf(b, "// Read%s reads the parameters of %s from r, applying their defaults.\n", typ, op.Method)
+	fmt.Fprintf(b, "func Read%s(r *http.Request) (%s, error) {\n", typ, typ)
+	fmt.Fprintf(b, "\tvar p %s\n", typ)
+	for i, p := range op.Params {
+		if def, ok := paramDefault(p); ok {
+			fmt.Fprintf(b, "\tp.%s = %s\n", fields[i], def)
+		}
+	}
+	for i, p := range op.Params {
+		read := "mserve.QueryParam"
+		if p.In == openapi3.ParameterInPath {
+			read = "mserve.PathParam"
+		}
+		fmt.Fprintf(b, "\tif v := %s(r, %q); v != \"\" {\n", read, p.Name)
+		writeParamParse(b, "p."+fields[i], p, "v")
+		if _, ok := paramDefault(p); !ok && p.Required {
+			fmt.Fprintf(b, "\t} else {\n\t\treturn p, fmt.Errorf(\"missing required parameter %%q\", %q)\n", p.Name)
+		}
+		b.WriteString("\t}\n")
+	}
+	b.WriteString("\treturn p, nil\n}\n")
+}
+
+// paramDefault returns the Go literal of the default of p, if it has one of
+// its type.
+func paramDefault(p serverParam) (string, bool) {
+	if p.Default == "" {
+		return "", false
+	}
+	var err error
+	switch paramGoType(p.Type) {
+	case "int64":
+		_, err = strconv.ParseInt(p.Default, 10, 64)
+	case "float64":
+		_, err = strconv.ParseFloat(p.Default, 64)
+	case "bool":
+		_, err = strconv.ParseBool(p.Default)
+	default:
+		return strconv.Quote(p.Default), true
+	}
+	return p.Default, err == nil
+}
+
+func writeParamParse(b *strings.Builder, field string, p serverParam, value string) {
+	var parse string
+	switch paramGoType(p.Type) {
+	case "int64":
+		parse = "strconv.ParseInt(%s, 10, 64)"
+	case "float64":
+		parse = "strconv.ParseFloat(%s, 64)"
+	case "bool":
+		parse = "strconv.ParseBool(%s)"
+	default:
+		fmt.Fprintf(b, "\t\t%s = %s\n", field, value)
+		return
+	}
+	fmt.Fprintf(b, "\t\tvalue, err := "+parse+"\n", value)
+	fmt.Fprintf(b, "\t\tif err != nil {\n\t\t\treturn p, fmt.Errorf(\"invalid parameter %%q: %%w\", %q, err)\n\t\t}\n", p.Name)
+	fmt.Fprintf(b, "\t\t%s = value\n", field)
+}
+
+func writeOptions(b *strings.Builder, field string, params []serverParam, indent string) {
+	if len(params) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "%s%s: map[string]mserve.ROption{\n", indent, field)
+	for _, p := range params {
+		fmt.Fprintf(b, "%s\t%q: {", indent, p.Name)
+		var fields []string
+		if p.Description != "" {
+			fields = append(fields, fmt.Sprintf("Description: %q", p.Description))
+		}
+		if p.Default != "" {
+			fields = append(fields, fmt.Sprintf("Default: %q", p.Default))
+		}
+		if p.Required {
+			fields = append(fields, "Required: true")
+		}
+		fields = append(fields, fmt.Sprintf("Type: %q", p.Type))
+		if len(p.Enum) > 0 {
+			quoted := make([]string, len(p.Enum))
+			for i, e := range p.Enum {
+				quoted[i] = strconv.Quote(e)
+			}
+			fields = append(fields, fmt.Sprintf("Enum: []string{%s}", strings.Join(quoted, ", ")))
+		}
+		b.WriteString(strings.Join(fields, ", "))
+		b.WriteString("},\n")
+	}
+	fmt.Fprintf(b, "%s},\n", indent)
+}
+
+func httpMethodConst(method string) string {
+	switch method {
+	case http.MethodGet:
+		return "http.MethodGet"
+	case http.MethodPost:
+		return "http.MethodPost"
+	case http.MethodPut:
+		return "http.MethodPut"
+	case http.MethodPatch:
+		return "http.MethodPatch"
+	case http.MethodDelete:
+		return "http.MethodDelete"
+	case http.MethodHead:
+		return "http.MethodHead"
+	case http.MethodOptions:
+		return "http.MethodOptions"
+	}
+	return strconv.Quote(method)
+}
+
+func handlersSource(pkg string, ops []serverOperation) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+	if len(ops) > 0 {
+		b.WriteString("import (\n\t\"net/http\"\n\n\t\"github.com/DarlingGoose/mserve\"\n)\n\n")
+	}
+	b.WriteString("// handlers implements Handlers. This file is not regenerated; operations\n")
+	b.WriteString("// added to the spec later are served by the embedded UnimplementedHandlers.\n")
+	b.WriteString("type handlers struct {\n\tUnimplementedHandlers\n}\n\n")
+	b.WriteString("// NewHandlers returns the implementation passed to Endpoints.\n")
+	b.WriteString("func NewHandlers() Handlers {\n\treturn &handlers{}\n}\n")
+	for _, op := range ops {
+		fmt.Fprintf(&b, "\n// %s handles %s %s\n", op.Method, op.HTTPMethod, op.Path)
+		fmt.Fprintf(&b, "func (h *handlers) %s(w http.ResponseWriter, r *http.Request) {\n", op.Method)
+		if len(op.Params) > 0 {
+			fmt.Fprintf(&b, "\tparams, err := Read%sParams(r)\n", op.Method)
+			b.WriteString("\tif err != nil {\n\t\tmserve.WriteError(w, r, http.StatusBadRequest, err.Error())\n\t\treturn\n\t}\n")
+			b.WriteString("\t_ = params\n")
+		}
+		fmt.Fprintf(&b, "\t// TODO: implement\n\tmserve.WriteError(w, r, http.StatusNotImplemented, %q)\n}\n", op.Method+" is not implemented")
+	}
+	return b.String()
+}
@@ -0,0 +1,65 @@
+package generators
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/DarlingGoose/mserve"
+	"github.com/DarlingGoose/mserve/nuxt3FromOpenApi"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+var _ Generator = TypeScriptClientGenerator{}
+
+// TypeScriptClientGenerator writes a typed TypeScript client: models.ts holds
+// an interface or type per components.schemas entry, client.ts a client class
+// with one typed method per operation, pagination helpers for mserve.Page
+// responses and a pluggable fetch adapter.
+type TypeScriptClientGenerator struct {
+	// OutDir the files are written to, defaults to clients/typescript in the project
+	OutDir string
+}
+
+func NewTypeScriptClientGenerator(outDir string) *TypeScriptClientGenerator {
+	return &TypeScriptClientGenerator{OutDir: outDir}
+}
+
+func (g TypeScriptClientGenerator) Generate(data GeneratorData, endpoints ...mserve.Endpoint) error {
+	server := &mserve.Server{ServiceName: data.ProjectName, Version: data.Version, Description: data.Description}
+	doc, err := mserve.GenerateOpenAPI(server, endpoints)
+	if err != nil {
+		return err
+	}
+	if data.Title != "" {
+		doc.Info.Title = data.Title
+	}
+	if g.OutDir == "" {
+		projectDir, err := data.ProjectDir()
+		if err != nil {
+			return err
+		}
+		g.OutDir = filepath.Join(projectDir, "clients", "typescript")
+	}
+	return g.GenerateFromSpec(doc)
+}
+
+// GenerateFromSpec writes models.ts and client.ts for doc to OutDir.
+func (g TypeScriptClientGenerator) GenerateFromSpec(doc *openapi3.T) error {
+	if g.OutDir == "" {
+		return fmt.Errorf("typescript client: output directory is required")
+	}
+	if err := ensureDir(g.OutDir); err != nil {
+		return err
+	}
+	models, client := TypeScriptClient(doc)
+	if err := os.WriteFile(filepath.Join(g.OutDir, "models.ts"), []byte(models), 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(g.OutDir, "client.ts"), []byte(client), 0o644)
+}
+
+// TypeScriptClient returns the models.ts and client.ts sources for doc.
+func TypeScriptClient(doc *openapi3.T) (models string, client string) {
+	return nuxt3FromOpenApi.TypeScriptClient(doc)
+}
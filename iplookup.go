@@ -1,16 +1,69 @@
 package mserve
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
 )
 
+const (
+	DefaultIPApiBaseURL   = "https://ip-api.com"
+	DefaultIPQueryBaseURL = "https://api.ipquery.io"
+
+	defaultIPLookupTimeout = 5 * time.Second
+	defaultIPCacheTTL      = 10 * time.Minute
+)
+
+var (
+	// ErrNoPublicIP is returned when no provider could determine the public IP.
+	ErrNoPublicIP = errors.New("no public ip found")
+	// ErrNoIPConsensus is returned by IPPolicyMajority when no address is
+	// reported by more than half of the providers, e.g. because they disagree
+	// or too many failed.
+	ErrNoIPConsensus = errors.New("ip providers did not reach a majority")
+	// ErrIPMismatch is returned by a cross-checked resolve when the address does
+	// not match the one found over its own address family.
+	ErrIPMismatch = errors.New("public ip does not match its address family lookup")
+)
+
+// IPLookup is a bare public IP lookup. It satisfies IPProvider so existing
+// lookups can be used in an IPResolver chain.
 type IPLookup func() (string, error)
 
 var _ IPLookup = IpApiLookup
 var _ IPLookup = ApiIPQueryLookup
 
+func (l IPLookup) Name() string {
+	return "lookup"
+}
+
+func (l IPLookup) PublicIP(ctx context.Context) (netip.Addr, error) {
+	ip, err := l()
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return parsePublicIP(ip)
+}
+
+// IPProvider discovers the server's public IP.
+type IPProvider interface {
+	Name() string
+	PublicIP(ctx context.Context) (netip.Addr, error)
+}
+
+// networkProvider is implemented by providers that can be restricted to
+// "tcp4"/"tcp6" (or "ip4"/"ip6" for local interfaces), used by ResolveFamilies.
+type networkProvider interface {
+	WithNetwork(network string) IPProvider
+}
+
 type IPApi struct {
 	Status      string  `json:"status"`
 	Country     string  `json:"country"`
@@ -29,19 +82,40 @@ type IPApi struct {
 }
 
 func IpApiLookup() (string, error) {
-	resp, err := http.Get("https://ip-api.com/json/")
+	ctx, cancel := context.WithTimeout(context.Background(), defaultIPLookupTimeout)
+	defer cancel()
+	ip, err := (&IPApiProvider{}).PublicIP(ctx)
 	if err != nil {
 		return "", err
 	}
-	if resp.StatusCode != 200 {
-		return "", errors.New(resp.Status)
-	}
+	return ip.String(), nil
+}
+
+// IPApiProvider looks up the public IP through ip-api.com.
+type IPApiProvider struct {
+	// BaseURL defaults to DefaultIPApiBaseURL
+	BaseURL string
+	// Client defaults to http.DefaultClient
+	Client *http.Client
+}
+
+func (p *IPApiProvider) Name() string {
+	return "ip-api"
+}
+
+func (p *IPApiProvider) PublicIP(ctx context.Context) (netip.Addr, error) {
 	v := IPApi{}
-	err = json.NewDecoder(resp.Body).Decode(&v)
-	if err != nil {
-		return "", err
+	if err := getJSON(ctx, p.Client, baseURL(p.BaseURL, DefaultIPApiBaseURL)+"/json/", &v); err != nil {
+		return netip.Addr{}, err
 	}
-	return v.Query, nil
+	if v.Status != "" && v.Status != "success" {
+		return netip.Addr{}, fmt.Errorf("ip-api status %s", v.Status)
+	}
+	return parsePublicIP(v.Query)
+}
+
+func (p *IPApiProvider) WithNetwork(network string) IPProvider {
+	return &IPApiProvider{BaseURL: p.BaseURL, Client: networkClient(p.Client, network)}
 }
 
 type ApiIpQuery struct {
@@ -73,17 +147,364 @@ type ApiIpQuery struct {
 }
 
 func ApiIPQueryLookup() (string, error) {
-	resp, err := http.Get("https://api.ipquery.io/?format=json")
+	ctx, cancel := context.WithTimeout(context.Background(), defaultIPLookupTimeout)
+	defer cancel()
+	ip, err := (&IPQueryProvider{}).PublicIP(ctx)
 	if err != nil {
 		return "", err
 	}
-	if resp.StatusCode != 200 {
-		return "", errors.New(resp.Status)
-	}
+	return ip.String(), nil
+}
+
+// IPQueryProvider looks up the public IP through api.ipquery.io.
+type IPQueryProvider struct {
+	// BaseURL defaults to DefaultIPQueryBaseURL
+	BaseURL string
+	// Client defaults to http.DefaultClient
+	Client *http.Client
+}
+
+func (p *IPQueryProvider) Name() string {
+	return "ipquery"
+}
+
+func (p *IPQueryProvider) PublicIP(ctx context.Context) (netip.Addr, error) {
 	v := ApiIpQuery{}
-	err = json.NewDecoder(resp.Body).Decode(&v)
+	if err := getJSON(ctx, p.Client, baseURL(p.BaseURL, DefaultIPQueryBaseURL)+"/?format=json", &v); err != nil {
+		return netip.Addr{}, err
+	}
+	return parsePublicIP(v.Ip)
+}
+
+func (p *IPQueryProvider) WithNetwork(network string) IPProvider {
+	return &IPQueryProvider{BaseURL: p.BaseURL, Client: networkClient(p.Client, network)}
+}
+
+// InterfaceProvider returns the first global unicast address bound to a local
+// interface, for hosts that own their public address (no NAT).
+type InterfaceProvider struct {
+	// Network restricts the family, "ip4" or "ip6"; empty accepts both
+	Network string
+	// AllowPrivate also accepts RFC 1918 / ULA addresses
+	AllowPrivate bool
+}
+
+func (p *InterfaceProvider) Name() string {
+	return "interface"
+}
+
+func (p *InterfaceProvider) PublicIP(ctx context.Context) (netip.Addr, error) {
+	addrs, err := net.InterfaceAddrs()
 	if err != nil {
-		return "", err
+		return netip.Addr{}, err
+	}
+	for _, a := range addrs {
+		prefix, err := netip.ParsePrefix(a.String())
+		if err != nil {
+			continue
+		}
+		ip := prefix.Addr().Unmap()
+		if !ip.IsGlobalUnicast() || (ip.IsPrivate() && !p.AllowPrivate) {
+			continue
+		}
+		if (p.Network == "ip4" && !ip.Is4()) || (p.Network == "ip6" && !ip.Is6()) {
+			continue
+		}
+		return ip, nil
+	}
+	return netip.Addr{}, ErrNoPublicIP
+}
+
+func (p *InterfaceProvider) WithNetwork(network string) IPProvider {
+	return &InterfaceProvider{Network: strings.Replace(network, "tcp", "ip", 1), AllowPrivate: p.AllowPrivate}
+}
+
+// IPPolicy decides how an IPResolver combines its providers.
+type IPPolicy int
+
+const (
+	// IPPolicyFirstSuccess tries providers in order and returns the first answer
+	IPPolicyFirstSuccess IPPolicy = iota
+	// IPPolicyMajority queries every provider concurrently and returns the address
+	// reported by more than half of the providers queried, failed ones included
+	IPPolicyMajority
+)
+
+// IPResolverConfig configures NewIPResolver.
+type IPResolverConfig struct {
+	// Providers defaults to ip-api.com followed by api.ipquery.io
+	Providers []IPProvider
+	Policy    IPPolicy
+	// Timeout bounds each provider call, defaults to 5s
+	Timeout time.Duration
+	// TTL caches the resolved address, defaults to 10m; negative disables caching
+	TTL time.Duration
+	// CrossCheck makes Resolve verify the address against a lookup restricted to
+	// its own address family (IPv4 over tcp4, IPv6 over tcp6)
+	CrossCheck bool
+}
+
+// PublicIPs holds the public address per family; either may be invalid.
+type PublicIPs struct {
+	V4 netip.Addr
+	V6 netip.Addr
+}
+
+type cachedIP struct {
+	addr    netip.Addr
+	expires time.Time
+}
+
+// IPResolver chains IPProviders with a resolution policy and a TTL cache.
+type IPResolver struct {
+	cfg   IPResolverConfig
+	mu    sync.Mutex
+	cache map[string]cachedIP
+	now   func() time.Time
+	// families holds the providers restricted to "tcp4" and "tcp6"
+	families map[string][]IPProvider
+}
+
+// DefaultIPProviders returns the built-in HTTP providers using their default base URLs.
+func DefaultIPProviders() []IPProvider {
+	return []IPProvider{&IPApiProvider{}, &IPQueryProvider{}}
+}
+
+func NewIPResolver(cfg IPResolverConfig) *IPResolver {
+	if len(cfg.Providers) == 0 {
+		cfg.Providers = DefaultIPProviders()
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultIPLookupTimeout
+	}
+	if cfg.TTL == 0 {
+		cfg.TTL = defaultIPCacheTTL
+	}
+	r := &IPResolver{cfg: cfg, cache: map[string]cachedIP{}, now: time.Now, families: map[string][]IPProvider{}}
+	for _, network := range []string{"tcp4", "tcp6"} {
+		for _, p := range cfg.Providers {
+			if np, ok := p.(networkProvider); ok {
+				r.families[network] = append(r.families[network], np.WithNetwork(network))
+			}
+		}
+	}
+	return r
+}
+
+// Resolve returns the public IP, from cache when still fresh.
+func (r *IPResolver) Resolve(ctx context.Context) (netip.Addr, error) {
+	ip, err := r.resolve(ctx, "")
+	if err != nil || !r.cfg.CrossCheck {
+		return ip, err
+	}
+	network := "tcp4"
+	if ip.Is6() {
+		network = "tcp6"
+	}
+	check, err := r.resolve(ctx, network)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("cross-checking %s: %w", ip, err)
+	}
+	if check != ip {
+		return netip.Addr{}, fmt.Errorf("%w: %s != %s over %s", ErrIPMismatch, ip, check, network)
+	}
+	return ip, nil
+}
+
+// ResolveFamilies looks up the public IPv4 and IPv6 addresses separately. Only
+// providers that can be restricted to a network take part. An error is returned
+// only when neither family resolves.
+func (r *IPResolver) ResolveFamilies(ctx context.Context) (PublicIPs, error) {
+	var (
+		out        PublicIPs
+		err4, err6 error
+		wg         sync.WaitGroup
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		out.V4, err4 = r.resolve(ctx, "tcp4")
+	}()
+	go func() {
+		defer wg.Done()
+		out.V6, err6 = r.resolve(ctx, "tcp6")
+	}()
+	wg.Wait()
+	if err4 != nil && err6 != nil {
+		return out, errors.Join(err4, err6)
+	}
+	return out, nil
+}
+
+// Invalidate drops every cached address.
+func (r *IPResolver) Invalidate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cache = map[string]cachedIP{}
+}
+
+func (r *IPResolver) resolve(ctx context.Context, network string) (netip.Addr, error) {
+	r.mu.Lock()
+	if c, ok := r.cache[network]; ok && r.now().Before(c.expires) {
+		r.mu.Unlock()
+		return c.addr, nil
+	}
+	r.mu.Unlock()
+
+	providers := r.providers(network)
+	if len(providers) == 0 {
+		return netip.Addr{}, fmt.Errorf("%w: no providers support %s", ErrNoPublicIP, network)
+	}
+	var (
+		ip  netip.Addr
+		err error
+	)
+	switch r.cfg.Policy {
+	case IPPolicyMajority:
+		ip, err = r.majority(ctx, providers)
+	default:
+		ip, err = r.firstSuccess(ctx, providers)
+	}
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	if (network == "tcp4" && !ip.Is4()) || (network == "tcp6" && !ip.Is6()) {
+		return netip.Addr{}, fmt.Errorf("%w: got %s over %s", ErrIPMismatch, ip, network)
+	}
+	if r.cfg.TTL > 0 {
+		r.mu.Lock()
+		r.cache[network] = cachedIP{addr: ip, expires: r.now().Add(r.cfg.TTL)}
+		r.mu.Unlock()
+	}
+	return ip, nil
+}
+
+func (r *IPResolver) providers(network string) []IPProvider {
+	if network == "" {
+		return r.cfg.Providers
+	}
+	return r.families[network]
+}
+
+func (r *IPResolver) lookup(ctx context.Context, p IPProvider) (netip.Addr, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.Timeout)
+	defer cancel()
+	ip, err := p.PublicIP(ctx)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("%s: %w", p.Name(), err)
+	}
+	return ip, nil
+}
+
+func (r *IPResolver) firstSuccess(ctx context.Context, providers []IPProvider) (netip.Addr, error) {
+	var errs []error
+	for _, p := range providers {
+		ip, err := r.lookup(ctx, p)
+		if err == nil {
+			return ip, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return netip.Addr{}, errors.Join(append([]error{ErrNoPublicIP}, errs...)...)
+}
+
+func (r *IPResolver) majority(ctx context.Context, providers []IPProvider) (netip.Addr, error) {
+	type result struct {
+		ip  netip.Addr
+		err error
+	}
+	results := make([]result, len(providers))
+	var wg sync.WaitGroup
+	for i, p := range providers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ip, err := r.lookup(ctx, p)
+			results[i] = result{ip: ip, err: err}
+		}()
+	}
+	wg.Wait()
+
+	votes := map[netip.Addr]int{}
+	answered := 0
+	var errs []error
+	for _, res := range results {
+		if res.err != nil {
+			errs = append(errs, res.err)
+			continue
+		}
+		answered++
+		votes[res.ip]++
+	}
+	if answered == 0 {
+		return netip.Addr{}, errors.Join(append([]error{ErrNoPublicIP}, errs...)...)
+	}
+	for ip, n := range votes {
+		if n*2 > len(providers) {
+			return ip, nil
+		}
+	}
+	return netip.Addr{}, errors.Join(append([]error{fmt.Errorf("%w: %v of %d providers", ErrNoIPConsensus, votes, len(providers))}, errs...)...)
+}
+
+func baseURL(configured, fallback string) string {
+	if configured == "" {
+		configured = fallback
+	}
+	return strings.TrimSuffix(configured, "/")
+}
+
+func getJSON(ctx context.Context, client *http.Client, u string, v interface{}) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// networkClient returns a copy of client whose connections are dialed over
+// network. Clients with a RoundTripper other than *http.Transport, e.g. test
+// stand-ins, are returned as they are and choose the address family themselves.
+func networkClient(client *http.Client, network string) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	base := http.DefaultTransport.(*http.Transport)
+	if client.Transport != nil {
+		t, ok := client.Transport.(*http.Transport)
+		if !ok {
+			return client
+		}
+		base = t
+	}
+	transport := base.Clone()
+	dialer := &net.Dialer{Timeout: defaultIPLookupTimeout}
+	transport.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, addr)
+	}
+	out := *client
+	out.Transport = transport
+	return &out
+}
+
+func parsePublicIP(s string) (netip.Addr, error) {
+	ip, err := netip.ParseAddr(strings.TrimSpace(s))
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid ip %q: %w", s, err)
 	}
-	return v.Ip, nil
+	return ip.Unmap(), nil
 }
@@ -0,0 +1,306 @@
+package mserve
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/certmagic"
+	"golang.org/x/sync/errgroup"
+)
+
+type TLSMode string
+
+const (
+	// TLSModeNone serves plain http (or h2c when enabled)
+	TLSModeNone = TLSMode("")
+	// TLSModeAuto obtains certificates for the server domains through CertMagic
+	TLSModeAuto = TLSMode("auto")
+	// TLSModeFiles loads the certificate from CertFile/KeyFile
+	TLSModeFiles = TLSMode("files")
+
+	defaultSocketMode      = os.FileMode(0o660)
+	defaultShutdownTimeout = 10 * time.Second
+)
+
+// ListenerSpec describes one address the server router is served on.
+type ListenerSpec struct {
+	// Network is "tcp" (default) or "unix"
+	Network string
+	// Addr is a host:port for tcp (":0" picks a free port) or a socket path for unix
+	Addr string
+	// SocketMode is applied to unix sockets, defaults to 0660
+	SocketMode os.FileMode
+	// H2C enables HTTP/2 over cleartext on non TLS listeners
+	H2C      bool
+	TLS      TLSMode
+	CertFile string
+	KeyFile  string
+}
+
+// ParseListenerSpec parses listener URLs such as "tcp://:8080?h2c=true",
+// "tcp://:8443?tls=files&cert=server.crt&key=server.key" and
+// "unix:///run/app.sock?mode=0600".
+func ParseListenerSpec(raw string) (ListenerSpec, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ListenerSpec{}, err
+	}
+	spec := ListenerSpec{Network: u.Scheme}
+	switch u.Scheme {
+	case "tcp":
+		spec.Addr = u.Host
+	case "unix":
+		spec.Addr = u.Path
+	default:
+		return ListenerSpec{}, fmt.Errorf("unsupported listener scheme %q", u.Scheme)
+	}
+	q := u.Query()
+	if v := q.Get("h2c"); v != "" {
+		if spec.H2C, err = strconv.ParseBool(v); err != nil {
+			return ListenerSpec{}, fmt.Errorf("invalid h2c value %q: %w", v, err)
+		}
+	}
+	if v := q.Get("mode"); v != "" {
+		mode, err := strconv.ParseUint(v, 8, 32)
+		if err != nil {
+			return ListenerSpec{}, fmt.Errorf("invalid socket mode %q: %w", v, err)
+		}
+		spec.SocketMode = os.FileMode(mode)
+	}
+	spec.TLS = TLSMode(q.Get("tls"))
+	spec.CertFile = q.Get("cert")
+	spec.KeyFile = q.Get("key")
+	return spec, spec.validate()
+}
+
+func (l ListenerSpec) validate() error {
+	switch l.Network {
+	case "", "tcp", "unix":
+	default:
+		return fmt.Errorf("unsupported listener network %q", l.Network)
+	}
+	if l.Network == "unix" && l.Addr == "" {
+		return errors.New("unix listener requires a socket path")
+	}
+	switch l.TLS {
+	case TLSModeNone, TLSModeAuto:
+	case TLSModeFiles:
+		if l.CertFile == "" || l.KeyFile == "" {
+			return errors.New("tls=files requires a cert and key file")
+		}
+	default:
+		return fmt.Errorf("unsupported tls mode %q", l.TLS)
+	}
+	if l.TLS != TLSModeNone && l.H2C {
+		return errors.New("h2c can not be combined with tls")
+	}
+	return nil
+}
+
+// AddListener registers additional listeners served by Run. When none are
+// registered Run falls back to SSLConfig.
+func (s *Server) AddListener(specs ...ListenerSpec) error {
+	for _, spec := range specs {
+		if err := spec.validate(); err != nil {
+			return err
+		}
+		s.listeners = append(s.listeners, spec)
+	}
+	return nil
+}
+
+// Addrs returns the bound address of every listener once Ready is closed,
+// including the actual port when ":0" was requested.
+func (s *Server) Addrs() []net.Addr {
+	s.muListeners.Lock()
+	defer s.muListeners.Unlock()
+	return append([]net.Addr{}, s.addrs...)
+}
+
+// Ready is closed once Run has bound all of its listeners, or failed to, see
+// ListenErr.
+func (s *Server) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// ListenErr returns why Run could not bind its listeners once Ready is
+// closed, nil when they were all bound.
+func (s *Server) ListenErr() error {
+	s.muListeners.Lock()
+	defer s.muListeners.Unlock()
+	return s.listenErr
+}
+
+func (s *Server) listen(spec ListenerSpec) (net.Listener, error) {
+	var (
+		l   net.Listener
+		err error
+	)
+	switch spec.Network {
+	case "unix":
+		mode := spec.SocketMode
+		if mode == 0 {
+			mode = defaultSocketMode
+		}
+		l, err = listenUnix(spec.Addr, mode)
+	default:
+		l, err = net.Listen("tcp", spec.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var tlsConfig *tls.Config
+	switch spec.TLS {
+	case TLSModeAuto:
+		tlsConfig, err = certmagic.TLS(s.domains)
+	case TLSModeFiles:
+		var cert tls.Certificate
+		cert, err = tls.LoadX509KeyPair(spec.CertFile, spec.KeyFile)
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	if err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+	if tlsConfig != nil {
+		tlsConfig.NextProtos = append([]string{"h2", "http/1.1"}, tlsConfig.NextProtos...)
+		l = tls.NewListener(l, tlsConfig)
+	}
+	return l, nil
+}
+
+// listenUnix binds a socket at path with mode. The socket is created in a
+// private directory next to path and renamed into place once its mode is set,
+// so it is never reachable with the default permissions. An existing socket
+// at path is replaced, any other file is an error.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".socket-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "s")
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// the socket is removed from path by unixListener.Close
+	l.SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, mode); err != nil {
+		_ = l.Close()
+		return nil, fmt.Errorf("chmod socket %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+	return &unixListener{UnixListener: l, addr: &net.UnixAddr{Name: path, Net: "unix"}}, nil
+}
+
+// unixListener is a socket renamed to addr after binding.
+type unixListener struct {
+	*net.UnixListener
+	addr *net.UnixAddr
+	once sync.Once
+}
+
+func (l *unixListener) Addr() net.Addr {
+	return l.addr
+}
+
+func (l *unixListener) Close() error {
+	err := l.UnixListener.Close()
+	l.once.Do(func() {
+		_ = os.Remove(l.addr.Name)
+	})
+	return err
+}
+
+func (s *Server) newHTTPServer(spec ListenerSpec, handler http.Handler) *http.Server {
+	srv := &http.Server{Handler: handler}
+	if spec.H2C {
+		var protocols http.Protocols
+		protocols.SetHTTP1(true)
+		protocols.SetUnencryptedHTTP2(true)
+		srv.Protocols = &protocols
+	}
+	return srv
+}
+
+// serveListeners binds every spec, then serves handler on all of them until ctx
+// is done or one of them fails.
+func (s *Server) serveListeners(ctx context.Context, handler http.Handler, specs []ListenerSpec) error {
+	var (
+		listeners []net.Listener
+		servers   []*http.Server
+	)
+	for _, spec := range specs {
+		l, err := s.listen(spec)
+		if err != nil {
+			for _, bound := range listeners {
+				_ = bound.Close()
+			}
+			err = fmt.Errorf("listen %s %s: %w", spec.Network, spec.Addr, err)
+			s.muListeners.Lock()
+			s.listenErr = err
+			s.muListeners.Unlock()
+			s.readyOnce.Do(func() { close(s.ready) })
+			return err
+		}
+		listeners = append(listeners, l)
+		servers = append(servers, s.newHTTPServer(spec, handler))
+		slog.Info("listening", "network", l.Addr().Network(), "addr", l.Addr().String(), "h2c", spec.H2C, "tls", spec.TLS)
+	}
+	s.muListeners.Lock()
+	for _, l := range listeners {
+		s.addrs = append(s.addrs, l.Addr())
+	}
+	s.muListeners.Unlock()
+	s.readyOnce.Do(func() { close(s.ready) })
+
+	g, gctx := errgroup.WithContext(ctx)
+	for i := range servers {
+		srv, l := servers[i], listeners[i]
+		g.Go(func() error {
+			if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		})
+	}
+	g.Go(func() error {
+		<-gctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), defaultShutdownTimeout)
+		defer cancel()
+		var wg sync.WaitGroup
+		for _, srv := range servers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_ = srv.Shutdown(shutdownCtx)
+			}()
+		}
+		wg.Wait()
+		return nil
+	})
+	return g.Wait()
+}
@@ -9,9 +9,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/DarlingGoose/mserve/nuxt3FromOpenApi"
 	"github.com/DarlingGoose/rbac"
 	"github.com/getkin/kin-openapi/openapi3"
-	"github.com/getkin/kin-openapi/openapi3gen"
 )
 
 type Endpoint struct {
@@ -26,12 +26,22 @@ type Endpoint struct {
 	Responses   []Response `json:"responses"`
 	Roles       []Role     `json:"roles"`
 	Prefix      bool
+	// FeatureFlag, when set, makes the endpoint return 503 while the flag is off
+	FeatureFlag string `json:"feature_flag,omitempty"`
+	// FeatureFlagOff keeps the endpoint off until FeatureFlag is set, e.g.
+	// through the admin API. Without it the endpoint is on until then.
+	FeatureFlagOff bool `json:"feature_flag_off,omitempty"`
+
+	// middleware lists per-endpoint handler wrappers, reported by the admin route table
+	middleware []string
 }
 
 type Request struct {
 	Params  map[string]ROption `json:"params"`
 	Headers map[string]ROption `json:"headers"`
 	Body    interface{}        `json:"body"`
+	// Example is a sample body shown in the OpenAPI document
+	Example interface{} `json:"example,omitempty"`
 }
 
 type Response struct {
@@ -39,6 +49,8 @@ type Response struct {
 	Message string             `json:"message"`
 	Body    interface{}        `json:"body"`
 	Headers map[string]ROption `json:"headers"`
+	// Example is a sample body shown in the OpenAPI document
+	Example interface{} `json:"example,omitempty"`
 }
 
 type ROption struct {
@@ -112,20 +124,51 @@ func (e *Endpoint) Init(ctx context.Context, service string, manager *rbac.Manag
 	return nil
 }
 
-func GenerateOpenAPI(server *Server, endpoints []Endpoint) (*openapi3.T, error) {
+// OpenAPIOptions configures GenerateOpenAPI and GenerateOpenAPIDocs.
+type OpenAPIOptions struct {
+	// Version31 emits an OpenAPI 3.1.0 document instead of 3.0.3
+	Version31 bool
+	// Strict makes GenerateOpenAPIDocs panic when the document fails validation
+	// instead of logging the diagnostics report
+	Strict bool
+}
+
+type OpenAPIOption func(o *OpenAPIOptions)
+
+// WithOpenAPI31 emits an OpenAPI 3.1.0 document.
+func WithOpenAPI31() OpenAPIOption {
+	return func(o *OpenAPIOptions) {
+		o.Version31 = true
+	}
+}
+
+// WithStrictOpenAPI makes GenerateOpenAPIDocs fail loudly on an invalid document.
+func WithStrictOpenAPI() OpenAPIOption {
+	return func(o *OpenAPIOptions) {
+		o.Strict = true
+	}
+}
+
+func GenerateOpenAPI(server *Server, endpoints []Endpoint, opts ...OpenAPIOption) (*openapi3.T, error) {
+	options := OpenAPIOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	version := server.Version
+	if version == "" {
+		// info.version is required
+		version = "0.0.0"
+	}
 	doc := &openapi3.T{
 		OpenAPI: "3.0.3", // Spec version
 		Info: &openapi3.Info{
 			Title:       server.ServiceName + " API",
-			Version:     server.Version,
+			Version:     version,
 			Description: "Auto-generated from Go structs",
 		},
 		Paths:      openapi3.NewPaths(),
 		Components: &openapi3.Components{Schemas: openapi3.Schemas{}},
 		Servers:    openapi3.Servers{},
-		Security: openapi3.SecurityRequirements{
-			{},
-		},
 	}
 	if len(server.allowedOrigins) == 0 {
 		doc.Servers = append(doc.Servers, &openapi3.Server{
@@ -137,145 +180,67 @@ func GenerateOpenAPI(server *Server, endpoints []Endpoint) (*openapi3.T, error)
 			URL: endpoint,
 		})
 	}
+	doc.Components.SecuritySchemes = securitySchemes(server, doc.Servers[0].URL, endpoints)
+	doc.Tags = endpointTags(endpoints)
 
-	// 1) Register all necessary schemas in components.schemas
-	// It's best to register concrete, named Go structs that represent your
-	// request/response bodies or other common data structures.
-	// `openapi3gen.NewSchemaRefForValue` infers the schema and a title from the type.
-	// We'll skip primitive types here as they often don't need to be named components.
-	schemasToRegister := []interface{}{
-		// Add any specific request/response body structs you use
-		// Example: MyRequestBodyStruct{}, MyResponseBodyStruct{},
-	}
-	for _, endpoint := range endpoints {
-		if endpoint.Internal {
-			continue
-		}
-		if endpoint.Request.Body != nil {
-			schemasToRegister = append(schemasToRegister, endpoint.Request.Body)
-		}
-		for _, r := range endpoint.Responses {
-			if r.Body != nil {
-				schemasToRegister = append(schemasToRegister, r.Body)
-			}
-		}
-	}
-
-	for _, sample := range schemasToRegister {
-
-		ref, err := openapi3gen.NewSchemaRefForValue(sample, nil)
-		if err != nil {
-			return nil, fmt.Errorf("schema generation for %T: %w", sample, err)
-		}
-		// openapi3gen usually infers the Go struct name as the schema title.
-		// If the title is empty (e.g., for basic types like string, int, or anonymous structs),
-		// it might not be suitable for a named component schema.
-		if ref.Value.Title != "" {
-			doc.Components.Schemas[ref.Value.Title] = ref
-		} else {
-			ref.Value.Title = GetStructName(sample)
-			if ref.Value.Title == "" {
-				continue
-			}
-			doc.Components.Schemas[ref.Value.Title] = ref
-		}
-	}
-
-	// For rbac.Action, if it's a string or integer alias, `openapi3gen` will correctly
-	// create a simple schema. If you want it as a named component (e.g., "Action"),
-	// you would explicitly add it and perhaps set a custom title if `ref.Value.Title`
-	// isn't what you desire for a basic type alias.
-	// For now, it's implicitly handled if used in `Role` or other structs.
+	// Request and response bodies are registered in components.schemas by
+	// schemaRegistry and referenced with $ref, so every named (and generic) Go
+	// type gets exactly one deterministic component name.
+	schemas := newSchemaRegistry(doc.Components.Schemas)
+	operationIDs := newOperationIDs(endpoints)
 
-	// 2) Build each path & operation
 	for _, ep := range endpoints {
 		if ep.Internal {
 			continue
 		}
-		pi := &openapi3.PathItem{}
+		p := openAPIPath(ep.Path)
+		pi := doc.Paths.Value(p)
+		if pi == nil {
+			pi = &openapi3.PathItem{}
+			doc.Paths.Set(p, pi)
+		}
 		for _, method := range ep.Methods {
+			operationID := operationIDs.next(ep, method)
 			op := &openapi3.Operation{
 				Summary:     ep.Description,
-				OperationID: ep.Name,
-				Parameters:  openapi3.Parameters{},
-				Responses:   openapi3.NewResponses(),
+				OperationID: operationID,
+				Parameters:  operationParameters(ep, p),
+				Tags:        []string{pathTag(ep.Path)},
+				Security:    operationSecurity(server, ep, doc.Components.SecuritySchemes),
 			}
-
-			// Path parameters
-			for name, o := range ep.Request.Params {
-				op.Parameters = append(op.Parameters, &openapi3.ParameterRef{
-					Value: &openapi3.Parameter{
-						Name:        name,
-						In:          "path",
-						Required:    o.Required,
-						Description: o.Description,
-
-						// FIX: Specify the schema type for path parameters.
-						// Assuming params are strings as per Request.Params map[string]string.
-						Schema: openapi3.NewSchemaRef("", &openapi3.Schema{Type: &openapi3.Types{openapi3.TypeString}}),
-					},
-				})
-			}
-
-			// Header parameters
-			for name, o := range ep.Request.Headers {
-				op.Parameters = append(op.Parameters, &openapi3.ParameterRef{
-					Value: &openapi3.Parameter{
-						Name:        name,
-						In:          "header",
-						Required:    o.Required,
-						Description: o.Description,
-						// FIX: Specify the schema type for header parameters.
-						// Assuming headers are strings as per Request.Headers map[string]string.
-						Schema: openapi3.NewSchemaRef("", &openapi3.Schema{Type: &openapi3.Types{openapi3.TypeString}}),
-					},
-				})
+			if len(ep.Roles) > 0 {
+				op.Extensions = map[string]interface{}{"x-roles": operationRoles(ep, method)}
 			}
 
 			// Request body
 			if ep.Request.Body != nil {
-				// Generate schema for the request body.
-				// If ep.Request.Body is an interface{}, `openapi3gen` will infer
-				// the schema from its concrete runtime type.
-				v, found := doc.Components.Schemas[GetStructName(ep.Request.Body)]
-				if found {
-					op.RequestBody = &openapi3.RequestBodyRef{
-						Value: &openapi3.RequestBody{
-							Required: true,
-							// NewContentWithJSONSchemaRef automatically sets "application/json" content type.
-							Content: openapi3.NewContentWithJSONSchemaRef(v),
-						},
-					}
-				} else {
-					sch, err := openapi3gen.NewSchemaRefForValue(ep.Request.Body, nil)
-					if err != nil {
-						return nil, fmt.Errorf("request body schema gen for endpoint %s: %w", ep.Name, err)
-					}
-					op.RequestBody = &openapi3.RequestBodyRef{
-						Value: &openapi3.RequestBody{
-							Required: true,
-							// NewContentWithJSONSchemaRef automatically sets "application/json" content type.
-							Content: openapi3.NewContentWithJSONSchemaRef(sch),
-						},
-					}
+				sch, err := schemas.ref(ep.Request.Body, nuxt3FromOpenApi.ToPascalCase(operationID)+"Request")
+				if err != nil {
+					return nil, fmt.Errorf("request body schema gen for endpoint %s: %w", ep.Name, err)
+				}
+				op.RequestBody = &openapi3.RequestBodyRef{
+					Value: &openapi3.RequestBody{
+						Required: true,
+						// NewContentWithJSONSchemaRef automatically sets "application/json" content type.
+						Content: withExample(openapi3.NewContentWithJSONSchemaRef(sch), ep.Request.Example),
+					},
 				}
 			}
 
 			// Responses
+			if len(ep.Responses) == 0 {
+				op.Responses = openapi3.NewResponses()
+			} else {
+				op.Responses = openapi3.NewResponsesWithCapacity(len(ep.Responses))
+			}
 			for _, resp := range ep.Responses {
-				var responseContent openapi3.Content
+				responseContent := openapi3.Content{}
 				if resp.Body != nil {
-					// Generate schema for the response body.
-					sch, err := openapi3gen.NewSchemaRefForValue(resp.Body, nil)
+					sch, err := schemas.ref(resp.Body, fmt.Sprintf("%sResponse%d", nuxt3FromOpenApi.ToPascalCase(operationID), resp.Status))
 					if err != nil {
 						return nil, fmt.Errorf("response body schema gen for endpoint %s status %d: %w", ep.Name, resp.Status, err)
 					}
-					// NewContentWithSchema creates a map with "application/json" by default,
-					// or you can explicitly provide supported media types.
-					responseContent = openapi3.NewContentWithSchema(sch.Value, []string{"application/json"})
-				} else {
-					// If no response body, the content can be empty
-					responseContent = openapi3.Content{}
+					responseContent = withExample(openapi3.NewContentWithJSONSchemaRef(sch), resp.Example)
 				}
 
 				// Ensure response description is not empty, as it's required for `openapi3.Response`.
@@ -288,6 +253,7 @@ func GenerateOpenAPI(server *Server, endpoints []Endpoint) (*openapi3.T, error)
 					Value: &openapi3.Response{
 						Description: &responseDescription, // Must be a pointer to a string
 						Content:     responseContent,
+						Headers:     responseHeaders(resp.Headers),
 					},
 				})
 			}
@@ -313,9 +279,11 @@ func GenerateOpenAPI(server *Server, endpoints []Endpoint) (*openapi3.T, error)
 				return nil, fmt.Errorf("unsupported HTTP method: %s for endpoint %s", method, ep.Name)
 			}
 		}
-		doc.Paths.Set(ep.Path, pi)
 	}
 
+	if options.Version31 {
+		ConvertOpenAPI31(doc)
+	}
 	return doc, nil
 }
 
@@ -0,0 +1,328 @@
+// Package mservetest runs an mserve Server in-process for handler tests, with
+// in-memory RBAC and session fakes instead of Mongo.
+package mservetest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DarlingGoose/credentials/session"
+	"github.com/DarlingGoose/mserve"
+	"github.com/DarlingGoose/rbac"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+)
+
+// Harness is an mserve Server wired to in-memory fakes and served by an httptest.Server.
+type Harness struct {
+	T       testing.TB
+	Server  *mserve.Server
+	HTTP    *httptest.Server
+	RBAC    *rbac.Manager
+	Store   *RBACStore
+	Session *session.Client
+	Secret  []byte
+
+	skipAccess bool
+	skipSchema bool
+	router     routers.Router
+	// routed is the number of endpoints router was built from
+	routed int
+}
+
+// Option customises a Harness before its endpoints are registered.
+type Option func(h *Harness)
+
+// WithoutAccessControl skips installing the RBAC access middleware.
+func WithoutAccessControl() Option {
+	return func(h *Harness) {
+		h.skipAccess = true
+	}
+}
+
+// WithoutSchemaValidation disables the OpenAPI response assertion in Call.
+func WithoutSchemaValidation() Option {
+	return func(h *Harness) {
+		h.skipSchema = true
+	}
+}
+
+// New builds a Server named serviceName, registers endpoints on it and starts an
+// httptest.Server. Everything is torn down with t.Cleanup.
+func New(t testing.TB, serviceName string, endpoints []*mserve.Endpoint, opts ...Option) *Harness {
+	t.Helper()
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		t.Fatalf("mservetest: generating session secret: %v", err)
+	}
+	manager, store := NewRBACManager()
+	sessions := session.NewClient(nil, manager, secret, time.Hour)
+	h := &Harness{
+		T:       t,
+		RBAC:    manager,
+		Store:   store,
+		Session: sessions,
+		Secret:  secret,
+		Server:  mserve.NewServer(serviceName, manager, nil, sessions, mserve.SSLConfig{}),
+	}
+	h.Server.Version = "0.0.0-test"
+	for _, opt := range opts {
+		opt(h)
+	}
+	if !h.skipAccess {
+		h.Server.SetupAccessControl()
+	}
+	if err := h.Server.AddEndpoints(context.Background(), endpoints...); err != nil {
+		t.Fatalf("mservetest: adding endpoints: %v", err)
+	}
+	h.HTTP = httptest.NewServer(h.Server.Handler())
+	t.Cleanup(h.HTTP.Close)
+	return h
+}
+
+// Endpoint returns the registered endpoint with the given Name.
+func (h *Harness) Endpoint(name string) (mserve.Endpoint, bool) {
+	for _, e := range h.Server.Endpoints() {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return mserve.Endpoint{}, false
+}
+
+// Anonymous returns a client without a session.
+func (h *Harness) Anonymous() *Client {
+	return &Client{h: h, http: h.HTTP.Client()}
+}
+
+// LoginAs creates userID in the RBAC store, grants it the "default" role plus
+// roles (creating them if needed) and returns a client carrying a signed-in
+// session cookie for that user.
+func (h *Harness) LoginAs(userID string, roles ...string) *Client {
+	h.T.Helper()
+	ctx := context.Background()
+	_ = h.RBAC.CreateUser(ctx, &rbac.User{ID: userID, Username: userID, CreatedAt: time.Now().Unix()})
+
+	var roleIDs []string
+	for _, name := range append([]string{"default"}, roles...) {
+		role, err := h.RBAC.Roles.GetRoleByName(ctx, name)
+		if err != nil || role == nil {
+			role = &rbac.Role{Name: name, CreatedAt: time.Now().Unix()}
+			if err := h.RBAC.CreateRole(ctx, role); err != nil {
+				h.T.Fatalf("mservetest: creating role %s: %v", name, err)
+			}
+		}
+		if err := h.RBAC.AssignRoleToUser(ctx, userID, role.ID); err != nil {
+			h.T.Fatalf("mservetest: assigning role %s: %v", name, err)
+		}
+		roleIDs = append(roleIDs, role.ID)
+	}
+
+	rec := httptest.NewRecorder()
+	err := session.SetSessionCookie(rec, &session.UserSessionData{
+		UserID:    userID,
+		Roles:     roleIDs,
+		SignedIn:  true,
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	}, h.Secret)
+	if err != nil {
+		h.T.Fatalf("mservetest: setting session cookie: %v", err)
+	}
+	return &Client{h: h, http: h.HTTP.Client(), cookies: rec.Result().Cookies()}
+}
+
+// Client sends requests to the harness server, optionally as a logged-in user.
+type Client struct {
+	h       *Harness
+	http    *http.Client
+	cookies []*http.Cookie
+}
+
+// Do sends a raw request. The session cookie is attached explicitly because it is
+// marked Secure and would be dropped by a cookie jar over plain http.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	for _, ck := range c.cookies {
+		req.AddCookie(ck)
+	}
+	return c.http.Do(req)
+}
+
+// Request describes a call to a registered endpoint.
+type Request struct {
+	// Method defaults to the endpoint's first method
+	Method  string
+	Params  map[string]string
+	Headers map[string]string
+	Body    interface{}
+}
+
+// Response is the decoded result of Call.
+type Response[T any] struct {
+	Status int
+	Header http.Header
+	Raw    []byte
+	Body   T
+}
+
+// Call sends req to the endpoint registered under name, filling path variables
+// and query params from req.Params according to the Endpoint metadata. The
+// response is decoded into T and, unless the endpoint is Internal and so not
+// documented, asserted against the generated OpenAPI schema.
+func Call[T any](c *Client, name string, req Request) Response[T] {
+	h := c.h
+	h.T.Helper()
+	e, ok := h.Endpoint(name)
+	if !ok {
+		h.T.Fatalf("mservetest: no endpoint named %q", name)
+	}
+	httpReq := c.newRequest(e, req)
+	resp, err := c.Do(httpReq)
+	if err != nil {
+		h.T.Fatalf("mservetest: %s %s: %v", httpReq.Method, httpReq.URL, err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		h.T.Fatalf("mservetest: reading response: %v", err)
+	}
+
+	out := Response[T]{Status: resp.StatusCode, Header: resp.Header, Raw: raw}
+	if !h.skipSchema && !e.Internal {
+		h.AssertSchema(httpReq, resp, raw)
+	}
+	if len(raw) > 0 && resp.StatusCode < 300 && strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		if err := json.Unmarshal(raw, &out.Body); err != nil {
+			h.T.Errorf("mservetest: decoding %s response into %T: %v", name, out.Body, err)
+		}
+	}
+	return out
+}
+
+func (c *Client) newRequest(e mserve.Endpoint, req Request) *http.Request {
+	h := c.h
+	h.T.Helper()
+	method := req.Method
+	if method == "" {
+		method = e.Methods[0]
+	}
+	p := e.Path
+	query := url.Values{}
+	for name, opt := range e.Request.Params {
+		v, ok := req.Params[name]
+		if !ok || v == "" {
+			v = opt.Default
+		}
+		if v == "" {
+			if opt.Required {
+				h.T.Fatalf("mservetest: %s: missing required param %q", e.Name, name)
+			}
+			continue
+		}
+		if strings.Contains(p, "{"+name+"}") {
+			p = strings.ReplaceAll(p, "{"+name+"}", url.PathEscape(v))
+			continue
+		}
+		query.Set(name, v)
+	}
+	for name := range req.Params {
+		if _, declared := e.Request.Params[name]; !declared {
+			h.T.Fatalf("mservetest: %s: param %q is not declared on the endpoint", e.Name, name)
+		}
+	}
+
+	var body io.Reader
+	if req.Body != nil {
+		raw, err := json.Marshal(req.Body)
+		if err != nil {
+			h.T.Fatalf("mservetest: encoding body: %v", err)
+		}
+		body = bytes.NewReader(raw)
+	}
+	u := h.HTTP.URL + p
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	httpReq, err := http.NewRequest(method, u, body)
+	if err != nil {
+		h.T.Fatalf("mservetest: building request: %v", err)
+	}
+	if req.Body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	for name, opt := range e.Request.Headers {
+		if v, ok := req.Headers[name]; ok {
+			httpReq.Header.Set(name, v)
+		} else if opt.Default != "" {
+			httpReq.Header.Set(name, opt.Default)
+		}
+	}
+	for name, v := range req.Headers {
+		httpReq.Header.Set(name, v)
+	}
+	return httpReq
+}
+
+// OpenAPI returns the document generated from the harness endpoints, with its
+// server URL pointed at the httptest.Server.
+func (h *Harness) OpenAPI() (*openapi3.T, error) {
+	doc, err := mserve.GenerateOpenAPI(h.Server, h.Server.Endpoints())
+	if err != nil {
+		return nil, err
+	}
+	doc.Servers = openapi3.Servers{{URL: h.HTTP.URL}}
+	return doc, nil
+}
+
+// AssertSchema fails the test when resp does not match the response schema the
+// generated OpenAPI document declares for req, or when the document has no
+// operation for req.
+func (h *Harness) AssertSchema(req *http.Request, resp *http.Response, body []byte) {
+	h.T.Helper()
+	if n := len(h.Server.Endpoints()); h.router == nil || h.routed != n {
+		// endpoints added since the last assertion need a new document
+		doc, err := h.OpenAPI()
+		if err != nil {
+			h.T.Fatalf("mservetest: generating OpenAPI: %v", err)
+		}
+		r, err := legacy.NewRouter(doc)
+		if err != nil {
+			h.T.Fatalf("mservetest: building OpenAPI router: %v", err)
+		}
+		h.router, h.routed = r, n
+	}
+	route, pathParams, err := h.router.FindRoute(req)
+	if err != nil {
+		h.T.Errorf("mservetest: %s %s is not in the OpenAPI document: %v", req.Method, req.URL.Path, err)
+		return
+	}
+	err = openapi3filter.ValidateResponse(req.Context(), &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: &openapi3filter.RequestValidationInput{
+			Request:    req,
+			PathParams: pathParams,
+			Route:      route,
+		},
+		Status: resp.StatusCode,
+		Header: resp.Header,
+		Body:   io.NopCloser(bytes.NewReader(body)),
+	})
+	if err != nil {
+		h.T.Errorf("mservetest: %s %s response does not match OpenAPI schema: %v", req.Method, req.URL.Path, err)
+	}
+}
+
+// String implements fmt.Stringer for readable failure messages.
+func (r Response[T]) String() string {
+	return fmt.Sprintf("%d %s", r.Status, r.Raw)
+}
@@ -0,0 +1,105 @@
+package mservetest
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/DarlingGoose/mserve"
+	"github.com/DarlingGoose/rbac"
+)
+
+type pet struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func petEndpoints() []*mserve.Endpoint {
+	return []*mserve.Endpoint{{
+		Name:    "get pet",
+		Methods: []string{http.MethodGet},
+		Path:    "/pets/{id}",
+		Request: mserve.Request{Params: map[string]mserve.ROption{"id": {Required: true}}},
+		Roles:   []mserve.Role{{Role: "keeper", Access: rbac.ActionRead}},
+		Responses: []mserve.Response{
+			{Status: http.StatusOK, Body: pet{}},
+		},
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			mserve.WriteBody(w, r, pet{ID: mserve.PathParam(r, "id"), Name: "rex"})
+		},
+	}}
+}
+
+func TestLoginAs(t *testing.T) {
+	h := New(t, "pets", petEndpoints())
+
+	resp := Call[pet](h.LoginAs("alice", "keeper"), "get pet", Request{Params: map[string]string{"id": "42"}})
+	if resp.Status != http.StatusOK {
+		t.Fatalf("keeper: got %s, want 200", resp)
+	}
+	if resp.Body.ID != "42" || resp.Body.Name != "rex" {
+		t.Errorf("keeper: got body %+v", resp.Body)
+	}
+
+	if resp := Call[pet](h.LoginAs("bob"), "get pet", Request{Params: map[string]string{"id": "42"}}); resp.Status != http.StatusForbidden {
+		t.Errorf("without role: got %s, want 403", resp)
+	}
+}
+
+// recorder keeps the failures of AssertSchema instead of failing the test.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, format)
+}
+
+func TestAssertSchema(t *testing.T) {
+	h := New(t, "pets", petEndpoints())
+	c := h.LoginAs("alice", "keeper")
+	rec := &recorder{TB: t}
+	h.T = rec
+
+	assert := func(path string) {
+		req, err := http.NewRequest(http.MethodGet, h.HTTP.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		h.AssertSchema(req, resp, []byte(`{"id":"1","name":"rex"}`))
+	}
+
+	assert("/pets/1")
+	if len(rec.errors) != 0 {
+		t.Fatalf("documented route: unexpected failures %v", rec.errors)
+	}
+
+	assert("/owners/1")
+	if len(rec.errors) != 1 {
+		t.Fatalf("undocumented route: got %d failures, want 1", len(rec.errors))
+	}
+
+	// endpoints added after the first assertion are documented too
+	if err := h.Server.AddEndpoints(t.Context(), &mserve.Endpoint{
+		Name:      "get owner",
+		Methods:   []string{http.MethodGet},
+		Path:      "/owners/{id}",
+		Request:   mserve.Request{Params: map[string]mserve.ROption{"id": {Required: true}}},
+		Roles:     []mserve.Role{{Role: "keeper", Access: rbac.ActionRead}},
+		Responses: []mserve.Response{{Status: http.StatusOK, Body: pet{}}},
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			mserve.WriteBody(w, r, pet{ID: mserve.PathParam(r, "id")})
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	assert("/owners/1")
+	if len(rec.errors) != 1 {
+		t.Fatalf("added route: unexpected failures %v", rec.errors[1:])
+	}
+}
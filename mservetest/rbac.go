@@ -0,0 +1,330 @@
+package mservetest
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/DarlingGoose/rbac"
+	"github.com/google/uuid"
+)
+
+// ErrNotFound is returned by RBACStore lookups that match nothing.
+var ErrNotFound = errors.New("not found")
+
+// RBACStore is a thread-safe, in-memory implementation of every rbac repository
+// interface. Unlike rbac.MockRepo it assigns IDs to new records, so it can back
+// Endpoint.Init and real permission checks.
+type RBACStore struct {
+	mu         sync.RWMutex
+	perms      map[string]*rbac.Permission
+	roles      map[string]*rbac.Role
+	users      map[string]*rbac.User
+	rolePerms  map[string]map[string]struct{}
+	userRoles  map[string]map[string]struct{}
+	userGroups map[string]map[string]*rbac.UserGroup
+	groupRoles map[string]map[string]struct{}
+}
+
+var (
+	_ rbac.PermissionRepo     = &RBACStore{}
+	_ rbac.RoleRepo           = &RBACStore{}
+	_ rbac.UserRepo           = &RBACStore{}
+	_ rbac.UserGroupRepo      = &RBACStore{}
+	_ rbac.RolePermissionRepo = &RBACStore{}
+	_ rbac.UserRoleRepo       = &RBACStore{}
+	_ rbac.GroupRoleRepo      = &RBACStore{}
+)
+
+func NewRBACStore() *RBACStore {
+	return &RBACStore{
+		perms:      map[string]*rbac.Permission{},
+		roles:      map[string]*rbac.Role{},
+		users:      map[string]*rbac.User{},
+		rolePerms:  map[string]map[string]struct{}{},
+		userRoles:  map[string]map[string]struct{}{},
+		userGroups: map[string]map[string]*rbac.UserGroup{},
+		groupRoles: map[string]map[string]struct{}{},
+	}
+}
+
+// NewRBACManager returns an rbac.Manager backed by a fresh RBACStore with the
+// "default" role already created, as Endpoint.Init expects.
+func NewRBACManager() (*rbac.Manager, *RBACStore) {
+	store := NewRBACStore()
+	_ = store.CreateRole(context.Background(), &rbac.Role{Name: "default"})
+	return &rbac.Manager{
+		Perms:           store,
+		Roles:           store,
+		Users:           store,
+		RP:              store,
+		UR:              store,
+		UG:              store,
+		GR:              store,
+		DefaultRoleName: "default",
+	}, store
+}
+
+func newID(id string) string {
+	if id != "" {
+		return id
+	}
+	return uuid.New().String()
+}
+
+func addToSet(m map[string]map[string]struct{}, key, value string) {
+	if m[key] == nil {
+		m[key] = map[string]struct{}{}
+	}
+	m[key][value] = struct{}{}
+}
+
+func listSet(m map[string]map[string]struct{}, key string) []string {
+	out := make([]string, 0, len(m[key]))
+	for v := range m[key] {
+		out = append(out, v)
+	}
+	return out
+}
+
+// PermissionRepo implementation
+
+func (s *RBACStore) CreatePermission(ctx context.Context, p *rbac.Permission) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.perms {
+		if existing.Resource == p.Resource && existing.Action == p.Action {
+			p.ID = existing.ID
+			return nil
+		}
+	}
+	p.ID = newID(p.ID)
+	s.perms[p.ID] = p
+	return nil
+}
+
+func (s *RBACStore) DeletePermission(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.perms, id)
+	return nil
+}
+
+func (s *RBACStore) GetPermissionByID(ctx context.Context, id string) (*rbac.Permission, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if p, ok := s.perms[id]; ok {
+		return p, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *RBACStore) GetPermissionByResource(ctx context.Context, resource string, action rbac.Action) (*rbac.Permission, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, p := range s.perms {
+		if p.Resource == resource && p.Action == action {
+			return p, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// RoleRepo implementation
+
+func (s *RBACStore) CreateRole(ctx context.Context, r *rbac.Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r.ID = newID(r.ID)
+	s.roles[r.ID] = r
+	return nil
+}
+
+func (s *RBACStore) DeleteRole(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.roles, id)
+	return nil
+}
+
+func (s *RBACStore) GetRoleByID(ctx context.Context, id string) (*rbac.Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if r, ok := s.roles[id]; ok {
+		return r, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *RBACStore) GetRoleByName(ctx context.Context, name string) (*rbac.Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, r := range s.roles {
+		if r.Name == name {
+			return r, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *RBACStore) ListAllRoles(ctx context.Context) ([]*rbac.Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*rbac.Role, 0, len(s.roles))
+	for _, r := range s.roles {
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// UserRepo implementation
+
+func (s *RBACStore) CreateUser(ctx context.Context, u *rbac.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u.ID = newID(u.ID)
+	s.users[u.ID] = u
+	return nil
+}
+
+func (s *RBACStore) DeleteUser(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.users, id)
+	return nil
+}
+
+func (s *RBACStore) GetUserByID(ctx context.Context, id string) (*rbac.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if u, ok := s.users[id]; ok {
+		return u, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *RBACStore) GetUserByMeta(ctx context.Context, meta map[string]interface{}) (*rbac.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, u := range s.users {
+		match := true
+		for k, v := range meta {
+			if u.Meta[k] != v {
+				match = false
+				break
+			}
+		}
+		if match {
+			return u, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// UserGroupRepo implementation
+
+func (s *RBACStore) AddUserToGroup(ctx context.Context, ug *rbac.UserGroup) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ug.ID = newID(ug.ID)
+	if s.userGroups[ug.UserID] == nil {
+		s.userGroups[ug.UserID] = map[string]*rbac.UserGroup{}
+	}
+	s.userGroups[ug.UserID][ug.GroupName] = ug
+	return nil
+}
+
+func (s *RBACStore) RemoveUserFromGroup(ctx context.Context, groupID string, ug *rbac.UserGroup) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.userGroups[ug.UserID], groupID)
+	return nil
+}
+
+func (s *RBACStore) GetGroupsByUserID(ctx context.Context, userID string) ([]*rbac.UserGroup, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*rbac.UserGroup, 0, len(s.userGroups[userID]))
+	for _, ug := range s.userGroups[userID] {
+		out = append(out, ug)
+	}
+	return out, nil
+}
+
+func (s *RBACStore) GetUsersByGroupID(ctx context.Context, groupID string) ([]*rbac.UserGroup, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []*rbac.UserGroup
+	for _, groups := range s.userGroups {
+		if ug, ok := groups[groupID]; ok {
+			out = append(out, ug)
+		}
+	}
+	return out, nil
+}
+
+// RolePermissionRepo implementation
+
+func (s *RBACStore) AddRP(ctx context.Context, roleID, permID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	addToSet(s.rolePerms, roleID, permID)
+	return nil
+}
+
+func (s *RBACStore) Remove(ctx context.Context, roleID, permID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.rolePerms[roleID], permID)
+	return nil
+}
+
+func (s *RBACStore) ListPermissions(ctx context.Context, roleID string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return listSet(s.rolePerms, roleID), nil
+}
+
+// UserRoleRepo implementation
+
+func (s *RBACStore) AddUR(ctx context.Context, userID, roleID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	addToSet(s.userRoles, userID, roleID)
+	return nil
+}
+
+func (s *RBACStore) RemoveUR(ctx context.Context, userID, roleID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.userRoles[userID], roleID)
+	return nil
+}
+
+func (s *RBACStore) ListRoles(ctx context.Context, userID string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return listSet(s.userRoles, userID), nil
+}
+
+// GroupRoleRepo implementation
+
+func (s *RBACStore) AddRoleToGroup(ctx context.Context, groupID, roleID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	addToSet(s.groupRoles, groupID, roleID)
+	return nil
+}
+
+func (s *RBACStore) RemoveRoleFromGroup(ctx context.Context, groupID, roleID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.groupRoles[groupID], roleID)
+	return nil
+}
+
+func (s *RBACStore) ListRolesForGroup(ctx context.Context, groupID string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return listSet(s.groupRoles, groupID), nil
+}
@@ -0,0 +1,309 @@
+package nuxt3FromOpenApi
+
+import (
+	"archive/zip"
+	"embed"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+//go:embed nuxtmodule
+var nuxtModuleFiles embed.FS
+
+var nuxtModuleTemplates = template.Must(template.ParseFS(nuxtModuleFiles, "nuxtmodule/*.tmpl"))
+
+// Nuxt3Module is a generated Nuxt module, file contents keyed by their path
+// relative to the module directory:
+//
+//	module.ts                     registers the plugin and the composables
+//	runtime/models.ts             types of components.schemas
+//	runtime/client.ts             the typed client
+//	runtime/auth.ts               session cookie, WebAuthn header and 401 refresh handling
+//	runtime/plugin.ts             provides the client as $<key>
+//	runtime/composables/<key>.ts  useXxx composables on top of useAsyncData
+type Nuxt3Module map[string]string
+
+type nuxtModuleData struct {
+	Title   string
+	Package string
+	Key     string
+	EnvKey  string
+	Client  string
+	BaseURL string
+}
+
+// GenerateNuxt3Module generates the Nuxt module for an OpenAPI YAML or JSON document.
+func GenerateNuxt3Module(yamlFile []byte) (Nuxt3Module, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(yamlFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading OpenAPI document: %v", err)
+	}
+	return GenerateNuxt3ModuleFromSpec(doc)
+}
+
+// GenerateNuxt3ModuleFromSpec generates the Nuxt module for doc.
+func GenerateNuxt3ModuleFromSpec(doc *openapi3.T) (Nuxt3Module, error) {
+	ts := &tsTypes{pages: map[string]string{}}
+	if doc.Components != nil {
+		ts.detectPages(doc.Components.Schemas)
+	}
+	name := apiName(doc)
+	data := nuxtModuleData{
+		Title:   name,
+		Package: ToKebabCase(name) + "-api",
+		Key:     tsCamel(name) + "Api",
+		EnvKey:  strings.ToUpper(ToSnakeCase(name + "Api")),
+		Client:  name + "Client",
+		BaseURL: "http://localhost:3000",
+	}
+	if len(doc.Servers) > 0 && doc.Servers[0].URL != "" {
+		data.BaseURL = doc.Servers[0].URL
+	}
+
+	m := Nuxt3Module{
+		"runtime/models.ts":                       ts.models(doc),
+		"runtime/client.ts":                       ts.client(doc),
+		"runtime/composables/" + data.Key + ".ts": ts.composables(doc, data),
+	}
+	auth, err := nuxtModuleFiles.ReadFile("nuxtmodule/auth.ts")
+	if err != nil {
+		return nil, err
+	}
+	m["runtime/auth.ts"] = string(auth)
+	for file, tmpl := range map[string]string{"module.ts": "module.ts.tmpl", "runtime/plugin.ts": "plugin.ts.tmpl"} {
+		var b strings.Builder
+		if err := nuxtModuleTemplates.ExecuteTemplate(&b, tmpl, data); err != nil {
+			return nil, err
+		}
+		m[file] = b.String()
+	}
+	return m, nil
+}
+
+// ToKebabCase converts the input string to kebab-case.
+func ToKebabCase(s string) string {
+	return strings.ReplaceAll(ToSnakeCase(s), "_", "-")
+}
+
+// Files returns the module file paths in a stable order.
+func (m Nuxt3Module) Files() []string {
+	files := make([]string, 0, len(m))
+	for f := range m {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// Write writes the module into dir, replacing the generated files.
+func (m Nuxt3Module) Write(dir string) error {
+	for _, f := range m.Files() {
+		p := filepath.Join(dir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(p, []byte(m[f]), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteZip writes the module as a zip archive with its files below root.
+func (m Nuxt3Module) WriteZip(w io.Writer, root string) error {
+	zw := zip.NewWriter(w)
+	for _, f := range m.Files() {
+		fw, err := zw.Create(path.Join(root, f))
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, m[f]); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// composables renders the useXxx composables: GET operations wrap useAsyncData
+// and refetch when their params change, other operations return an execute
+// function with data/error/pending refs, and Page operations get a
+// useXxxPaginated composable driven by page/limit refs.
+func (ts *tsTypes) composables(doc *openapi3.T, data nuxtModuleData) string {
+	ops := ts.operations(doc)
+	var body strings.Builder
+	fmt.Fprintf(&body, "function useApi(): %s {\n  return useNuxtApp().$%s\n}\n", data.Client, data.Key)
+	for _, op := range ops {
+		body.WriteString("\n")
+		if op.Method == "GET" {
+			writeQueryComposable(&body, op, data)
+		} else {
+			writeMutationComposable(&body, op)
+		}
+		if op.PageItem != "" {
+			body.WriteString("\n")
+			writePaginatedComposable(&body, op, data)
+		}
+	}
+
+	src := body.String()
+	var clientTypes []string
+	for _, op := range ops {
+		clientTypes = append(clientTypes, tsIdent(op.Name)+"Params")
+	}
+	clientTypes = append(clientTypes, data.Client, "RequestOptions")
+	var modelTypes []string
+	if doc.Components != nil {
+		for _, name := range sortedSchemaNames(doc.Components.Schemas) {
+			modelTypes = append(modelTypes, tsIdent(name))
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(tsHeader)
+	writeTSImport(&b, src, "vue", []string{"computed", "ref", "toValue"}, []string{"MaybeRefOrGetter", "Ref"})
+	writeTSImport(&b, src, "#app", []string{"useAsyncData", "useNuxtApp"}, []string{"AsyncDataOptions"})
+	writeTSImport(&b, src, "../client", nil, clientTypes)
+	writeTSImport(&b, src, "../models", nil, append(modelTypes, "Page"))
+	b.WriteString("\n")
+	b.WriteString(src)
+	return b.String()
+}
+
+// writeTSImport imports the values and types that are used in src.
+func writeTSImport(b *strings.Builder, src, from string, values, types []string) {
+	used := func(name string) bool {
+		return regexp.MustCompile(`\b` + regexp.QuoteMeta(name) + `\b`).MatchString(src)
+	}
+	var names []string
+	seen := map[string]bool{}
+	for _, v := range values {
+		if used(v) && !seen[v] {
+			seen[v] = true
+			names = append(names, v)
+		}
+	}
+	typeOnly := len(names) == 0
+	for _, t := range types {
+		if !used(t) || seen[t] {
+			continue
+		}
+		seen[t] = true
+		if typeOnly {
+			names = append(names, t)
+		} else {
+			names = append(names, "type "+t)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		return strings.TrimPrefix(names[i], "type ") < strings.TrimPrefix(names[j], "type ")
+	})
+	if typeOnly {
+		fmt.Fprintf(b, "import type { %s } from '%s'\n", strings.Join(names, ", "), from)
+		return
+	}
+	fmt.Fprintf(b, "import { %s } from '%s'\n", strings.Join(names, ", "), from)
+}
+
+func composableDoc(b *strings.Builder, op tsOperation) {
+	b.WriteString("/**\n")
+	if op.Description != "" {
+		for _, line := range strings.Split(strings.TrimSpace(op.Description), "\n") {
+			fmt.Fprintf(b, " * %s\n", strings.ReplaceAll(strings.TrimSpace(line), "*/", "*\\/"))
+		}
+		b.WriteString(" *\n")
+	}
+	fmt.Fprintf(b, " * %s %s\n */\n", op.Method, op.Path)
+}
+
+func writeQueryComposable(b *strings.Builder, op tsOperation, data nuxtModuleData) {
+	paramsType := tsIdent(op.Name) + "Params"
+	composableDoc(b, op)
+	key := data.Key + ":" + op.Name
+	if !op.hasParams() {
+		fmt.Fprintf(b, "export function use%s(options: AsyncDataOptions<%s> = {}) {\n", tsIdent(op.Name), op.Return)
+		b.WriteString("  const api = useApi()\n")
+		fmt.Fprintf(b, "  return useAsyncData('%s', () => api.%s(), options)\n}\n", key, op.Name)
+		return
+	}
+	params := "params: MaybeRefOrGetter<" + paramsType + ">"
+	if !op.paramsRequired() {
+		params += " = {}"
+	}
+	fmt.Fprintf(b, "export function use%s(%s, options: AsyncDataOptions<%s> = {}) {\n", tsIdent(op.Name), params, op.Return)
+	b.WriteString("  const api = useApi()\n")
+	fmt.Fprintf(b, "  return useAsyncData('%s:' + JSON.stringify(toValue(params)), () => api.%s(toValue(params)), {\n", key, op.Name)
+	b.WriteString("    watch: [() => JSON.stringify(toValue(params))],\n    ...options,\n  })\n}\n")
+}
+
+func writeMutationComposable(b *strings.Builder, op tsOperation) {
+	args := methodArgs(op)
+	composableDoc(b, op)
+	fmt.Fprintf(b, "export function use%s() {\n", tsIdent(op.Name))
+	b.WriteString("  const api = useApi()\n")
+	fmt.Fprintf(b, "  const data = ref(null) as Ref<%s | null>\n", op.Return)
+	b.WriteString("  const error = ref<unknown>(null)\n  const pending = ref(false)\n")
+	fmt.Fprintf(b, "  async function execute(%s): Promise<%s> {\n", strings.Join(args, ", "), op.Return)
+	b.WriteString("    pending.value = true\n    error.value = null\n    try {\n")
+	fmt.Fprintf(b, "      data.value = await api.%s(%s)\n", op.Name, strings.Join(argNames(args), ", "))
+	b.WriteString("      return data.value\n    } catch (err) {\n      error.value = err\n      throw err\n    } finally {\n      pending.value = false\n    }\n  }\n")
+	b.WriteString("  return { data, error, pending, execute }\n}\n")
+}
+
+func writePaginatedComposable(b *strings.Builder, op tsOperation, data nuxtModuleData) {
+	paramsType := tsIdent(op.Name) + "Params"
+	paging := "'page'"
+	if op.hasQuery("limit") {
+		paging += " | 'limit'"
+	}
+	composableDoc(b, op)
+	params := "params: MaybeRefOrGetter<Omit<" + paramsType + ", " + paging + ">>"
+	if !op.paramsRequired() {
+		params += " = {}"
+	}
+	fmt.Fprintf(b, "export function use%sPaginated(%s, initial: { page?: number; limit?: number } = {}) {\n", tsIdent(op.Name), params)
+	b.WriteString("  const api = useApi()\n  const page = ref(initial.page ?? 1)\n  const limit = ref(initial.limit ?? 20)\n")
+	query := "{ ...toValue(params), page: page.value"
+	if op.hasQuery("limit") {
+		query += ", limit: limit.value"
+	}
+	query += " } as " + paramsType
+	key := data.Key + ":" + op.Name + ":paginated"
+	fmt.Fprintf(b, "  const result = useAsyncData('%s:' + JSON.stringify(toValue(params)), () => api.%s(%s), {\n", key, op.Name, query)
+	b.WriteString("    watch: [page, limit, () => JSON.stringify(toValue(params))],\n  })\n")
+	fmt.Fprintf(b, "  const items = computed<%s[]>(() => result.data.value?.items ?? [])\n", op.PageItem)
+	b.WriteString(`  const total = computed(() => result.data.value?.total ?? 0)
+  const totalPages = computed(() => result.data.value?.totalPages ?? 0)
+  const hasNext = computed(() => page.value < totalPages.value)
+  const hasPrev = computed(() => page.value > 1)
+  return {
+    ...result,
+    items,
+    page,
+    limit,
+    total,
+    totalPages,
+    hasNext,
+    hasPrev,
+    next: () => {
+      if (hasNext.value) page.value++
+    },
+    prev: () => {
+      if (hasPrev.value) page.value--
+    },
+  }
+}
+`)
+}
@@ -0,0 +1,733 @@
+package nuxt3FromOpenApi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// TypeScriptClient returns the models.ts and client.ts sources for doc.
+func TypeScriptClient(doc *openapi3.T) (models string, client string) {
+	ts := &tsTypes{pages: map[string]string{}}
+	if doc.Components != nil {
+		ts.detectPages(doc.Components.Schemas)
+	}
+	return ts.models(doc), ts.client(doc)
+}
+
+const tsHeader = "// Code generated by mserve. DO NOT EDIT.\n/* eslint-disable */\n\n"
+
+// tsTypes renders OpenAPI schemas as TypeScript types.
+type tsTypes struct {
+	// pages maps mserve.Page components to the TypeScript type of their items
+	pages map[string]string
+}
+
+// detectPages finds the components shaped like mserve.Page.
+func (ts *tsTypes) detectPages(schemas openapi3.Schemas) {
+	for name, ref := range schemas {
+		if ref == nil || ref.Value == nil {
+			continue
+		}
+		props := ref.Value.Properties
+		items := props["items"]
+		if items == nil || items.Value == nil || !hasType(items.Value, openapi3.TypeArray) {
+			continue
+		}
+		if props["page"] == nil || props["limit"] == nil || props["total"] == nil || props["totalPages"] == nil {
+			continue
+		}
+		ts.pages[tsIdent(name)] = ts.typeOf(componentRef(schemas, items.Value.Items))
+	}
+}
+
+// componentRef returns a $ref to the component ref is an inlined copy of, or
+// ref itself. Page items are inlined by the schema generator.
+func componentRef(schemas openapi3.Schemas, ref *openapi3.SchemaRef) *openapi3.SchemaRef {
+	if ref == nil || ref.Ref != "" || ref.Value == nil || len(ref.Value.Properties) == 0 {
+		return ref
+	}
+	want := schemaFingerprint(ref.Value)
+	for _, name := range sortedSchemaNames(schemas) {
+		c := schemas[name]
+		if c != nil && c.Value != nil && schemaFingerprint(c.Value) == want {
+			return openapi3.NewSchemaRef("#/components/schemas/"+name, c.Value)
+		}
+	}
+	return ref
+}
+
+func schemaFingerprint(s *openapi3.Schema) string {
+	c := *s
+	c.Title = ""
+	raw, _ := json.Marshal(c)
+	return string(raw)
+}
+
+// tsIdent turns an OpenAPI name into a PascalCase identifier.
+func tsIdent(s string) string {
+	id := ToPascalCase(s)
+	if id == "" {
+		return "X"
+	}
+	if r := []rune(id)[0]; !unicode.IsLetter(r) {
+		id = "X" + id
+	}
+	return id
+}
+
+func tsCamel(s string) string {
+	id := tsIdent(s)
+	return strings.ToLower(id[:1]) + id[1:]
+}
+
+// tsProp quotes property names that are not valid identifiers.
+func tsProp(name string) string {
+	for i, r := range name {
+		if !(r == '_' || r == '$' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (i > 0 && r >= '0' && r <= '9')) {
+			return strconv.Quote(name)
+		}
+	}
+	if name == "" {
+		return `""`
+	}
+	return name
+}
+
+func tsRefName(ref string) (string, bool) {
+	const prefix = "#/components/schemas/"
+	if !strings.HasPrefix(ref, prefix) {
+		return "", false
+	}
+	return tsIdent(strings.TrimPrefix(ref, prefix)), true
+}
+
+func tsDoc(b *strings.Builder, indent, description string) {
+	description = strings.TrimSpace(description)
+	if description == "" {
+		return
+	}
+	lines := strings.Split(description, "\n")
+	if len(lines) == 1 {
+		fmt.Fprintf(b, "%s/** %s */\n", indent, strings.ReplaceAll(lines[0], "*/", "*\\/"))
+		return
+	}
+	fmt.Fprintf(b, "%s/**\n", indent)
+	for _, line := range lines {
+		fmt.Fprintf(b, "%s * %s\n", indent, strings.ReplaceAll(strings.TrimSpace(line), "*/", "*\\/"))
+	}
+	fmt.Fprintf(b, "%s */\n", indent)
+}
+
+// typeOf returns the TypeScript type of ref, inlining anonymous objects.
+func (ts *tsTypes) typeOf(ref *openapi3.SchemaRef) string {
+	if ref == nil {
+		return "unknown"
+	}
+	if name, ok := tsRefName(ref.Ref); ok {
+		if item, ok := ts.pages[name]; ok {
+			return "Page<" + item + ">"
+		}
+		return name
+	}
+	s := ref.Value
+	if s == nil {
+		return "unknown"
+	}
+	t := ts.baseType(s)
+	if s.Nullable && t != "unknown" {
+		t += " | null"
+	}
+	return t
+}
+
+func (ts *tsTypes) baseType(s *openapi3.Schema) string {
+	switch {
+	case len(s.Enum) > 0:
+		values := make([]string, 0, len(s.Enum))
+		for _, e := range s.Enum {
+			switch v := e.(type) {
+			case string:
+				values = append(values, strconv.Quote(v))
+			default:
+				values = append(values, fmt.Sprint(v))
+			}
+		}
+		return strings.Join(values, " | ")
+	case len(s.AllOf) > 0:
+		parts := make([]string, 0, len(s.AllOf))
+		for _, p := range s.AllOf {
+			parts = append(parts, ts.wrap(ts.typeOf(p)))
+		}
+		if len(s.Properties) > 0 {
+			parts = append(parts, ts.objectLiteral(s, ""))
+		}
+		return strings.Join(parts, " & ")
+	case len(s.OneOf) > 0 || len(s.AnyOf) > 0:
+		refs := append(append(openapi3.SchemaRefs{}, s.OneOf...), s.AnyOf...)
+		parts := make([]string, 0, len(refs))
+		for _, p := range refs {
+			parts = append(parts, ts.wrap(ts.typeOf(p)))
+		}
+		return strings.Join(parts, " | ")
+	case hasType(s, openapi3.TypeArray):
+		return ts.wrap(ts.typeOf(s.Items)) + "[]"
+	case len(s.Properties) > 0:
+		return ts.objectLiteral(s, "")
+	case hasType(s, openapi3.TypeObject):
+		if s.AdditionalProperties.Schema != nil {
+			return "Record<string, " + ts.typeOf(s.AdditionalProperties.Schema) + ">"
+		}
+		return "Record<string, unknown>"
+	case hasType(s, openapi3.TypeString):
+		if s.Format == "binary" {
+			return "Blob"
+		}
+		return "string"
+	case hasType(s, openapi3.TypeInteger), hasType(s, openapi3.TypeNumber):
+		return "number"
+	case hasType(s, openapi3.TypeBoolean):
+		return "boolean"
+	}
+	return "unknown"
+}
+
+// wrap parenthesizes union and intersection types used as array elements or operands.
+func (ts *tsTypes) wrap(t string) string {
+	if strings.ContainsAny(t, "|&") && !strings.HasPrefix(t, "{") {
+		return "(" + t + ")"
+	}
+	return t
+}
+
+// objectLiteral renders the properties of s as an object type.
+func (ts *tsTypes) objectLiteral(s *openapi3.Schema, indent string) string {
+	var b strings.Builder
+	b.WriteString("{\n")
+	ts.writeProperties(&b, s, indent+"  ")
+	b.WriteString(indent + "}")
+	return b.String()
+}
+
+func (ts *tsTypes) writeProperties(b *strings.Builder, s *openapi3.Schema, indent string) {
+	required := map[string]bool{}
+	for _, r := range s.Required {
+		required[r] = true
+	}
+	for _, name := range sortedSchemaNames(s.Properties) {
+		prop := s.Properties[name]
+		if prop != nil && prop.Ref == "" && prop.Value != nil {
+			tsDoc(b, indent, prop.Value.Description)
+		}
+		optional := "?"
+		if required[name] {
+			optional = ""
+		}
+		typ := strings.ReplaceAll(ts.typeOf(prop), "\n", "\n"+indent)
+		fmt.Fprintf(b, "%s%s%s: %s;\n", indent, tsProp(name), optional, typ)
+	}
+	if s.AdditionalProperties.Schema != nil {
+		fmt.Fprintf(b, "%s[key: string]: %s;\n", indent, ts.typeOf(s.AdditionalProperties.Schema))
+	}
+}
+
+func (ts *tsTypes) models(doc *openapi3.T) string {
+	var b strings.Builder
+	b.WriteString(tsHeader)
+	b.WriteString(tsPageTemplate)
+	if doc.Components == nil {
+		return b.String()
+	}
+	for _, name := range sortedSchemaNames(doc.Components.Schemas) {
+		ref := doc.Components.Schemas[name]
+		id := tsIdent(name)
+		if _, isPage := ts.pages[id]; isPage || ref == nil || ref.Value == nil {
+			continue
+		}
+		s := ref.Value
+		b.WriteString("\n")
+		tsDoc(&b, "", s.Description)
+		switch {
+		case len(s.Properties) > 0 && len(s.OneOf) == 0 && len(s.AnyOf) == 0 && !s.Nullable:
+			var extends []string
+			for _, p := range s.AllOf {
+				if parent, ok := tsRefName(p.Ref); ok {
+					extends = append(extends, parent)
+				}
+			}
+			if len(extends) == len(s.AllOf) {
+				fmt.Fprintf(&b, "export interface %s", id)
+				if len(extends) > 0 {
+					fmt.Fprintf(&b, " extends %s", strings.Join(extends, ", "))
+				}
+				b.WriteString(" {\n")
+				ts.writeProperties(&b, s, "  ")
+				b.WriteString("}\n")
+				continue
+			}
+			fmt.Fprintf(&b, "export type %s = %s;\n", id, ts.baseType(s))
+		default:
+			fmt.Fprintf(&b, "export type %s = %s;\n", id, ts.typeOf(ref))
+		}
+	}
+	return b.String()
+}
+
+const tsPageTemplate = `/** A page of results, mirrors mserve.Page. */
+export interface Page<T> {
+  items: T[];
+  page: number;
+  limit: number;
+  total: number;
+  totalPages: number;
+  /** Set by cursor paginated lists, absent on their last page */
+  nextCursor?: string;
+}
+`
+
+// tsOperation is one operation rendered as a client method.
+type tsOperation struct {
+	Name         string
+	Method       string
+	Path         string
+	Description  string
+	PathParams   []tsParam
+	QueryParams  []tsParam
+	Headers      []tsParam
+	Body         string
+	BodyOptional bool
+	Return       string
+	// PageItem is the item type when the operation returns a Page and takes a page param
+	PageItem string
+}
+
+type tsParam struct {
+	Name        string
+	Type        string
+	Required    bool
+	Description string
+}
+
+func (ts *tsTypes) operations(doc *openapi3.T) []tsOperation {
+	if doc.Paths == nil {
+		return nil
+	}
+	var ops []tsOperation
+	used := map[string]int{}
+	paths := doc.Paths.Map()
+	keys := make([]string, 0, len(paths))
+	for k := range paths {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, p := range keys {
+		item := paths[p]
+		for _, method := range operationMethods {
+			op := item.GetOperation(method)
+			if op == nil {
+				continue
+			}
+			name := op.OperationID
+			if name == "" {
+				name = generateFunctionName(method, p)
+			}
+			name = tsCamel(name)
+			if n := used[name]; n > 0 {
+				used[name]++
+				name += strconv.Itoa(n + 1)
+			} else {
+				used[name] = 1
+			}
+			o := tsOperation{Name: name, Method: method, Path: p, Description: op.Summary, Return: "void"}
+			if op.Description != "" {
+				o.Description = op.Description
+			}
+			for _, ref := range mergedParameters(item.Parameters, op.Parameters) {
+				prm := ref.Value
+				tp := tsParam{Name: prm.Name, Type: ts.typeOf(prm.Schema), Required: prm.Required, Description: prm.Description}
+				if prm.Schema == nil {
+					tp.Type = "string"
+				}
+				switch prm.In {
+				case openapi3.ParameterInPath:
+					tp.Required = true
+					o.PathParams = append(o.PathParams, tp)
+				case openapi3.ParameterInQuery:
+					o.QueryParams = append(o.QueryParams, tp)
+				case openapi3.ParameterInHeader:
+					o.Headers = append(o.Headers, tp)
+				}
+			}
+			if op.RequestBody != nil && op.RequestBody.Value != nil {
+				if schema := jsonSchema(op.RequestBody.Value.Content); schema != nil {
+					o.Body = ts.typeOf(schema)
+					o.BodyOptional = !op.RequestBody.Value.Required
+				}
+			}
+			if op.Responses != nil {
+				for _, code := range []string{"200", "201", "202", "203", "206"} {
+					resp := op.Responses.Value(code)
+					if resp == nil || resp.Value == nil {
+						continue
+					}
+					if schema := jsonSchema(resp.Value.Content); schema != nil {
+						o.Return = ts.typeOf(schema)
+					}
+					break
+				}
+			}
+			if strings.HasPrefix(o.Return, "Page<") && o.hasQuery("page") {
+				o.PageItem = strings.TrimSuffix(strings.TrimPrefix(o.Return, "Page<"), ">")
+			}
+			ops = append(ops, o)
+		}
+	}
+	return ops
+}
+
+func (ts *tsTypes) client(doc *openapi3.T) string {
+	ops := ts.operations(doc)
+	className := apiName(doc) + "Client"
+
+	var b strings.Builder
+	b.WriteString(tsClientRuntime)
+
+	for _, op := range ops {
+		if len(op.PathParams)+len(op.QueryParams)+len(op.Headers) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\nexport interface %sParams {\n", tsIdent(op.Name))
+		for _, group := range [][]tsParam{op.PathParams, op.QueryParams, op.Headers} {
+			for _, p := range group {
+				tsDoc(&b, "  ", p.Description)
+				optional := "?"
+				if p.Required {
+					optional = ""
+				}
+				fmt.Fprintf(&b, "  %s%s: %s;\n", tsProp(p.Name), optional, p.Type)
+			}
+		}
+		b.WriteString("}\n")
+	}
+
+	fmt.Fprintf(&b, "\nexport class %s extends BaseClient {\n", className)
+	for i, op := range ops {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		writeTSMethod(&b, op)
+	}
+	b.WriteString("}\n")
+
+	imports := ts.referencedTypes(doc, b.String())
+	return tsHeader + fmt.Sprintf("import type { %s } from './models';\n\n", strings.Join(imports, ", ")) + b.String()
+}
+
+// referencedTypes lists the model types used in the client source.
+func (ts *tsTypes) referencedTypes(doc *openapi3.T, src string) []string {
+	names := []string{"Page"}
+	if doc.Components == nil {
+		return names
+	}
+	for _, name := range sortedSchemaNames(doc.Components.Schemas) {
+		id := tsIdent(name)
+		if _, isPage := ts.pages[id]; isPage {
+			continue
+		}
+		if regexp.MustCompile(`\b` + id + `\b`).MatchString(src) {
+			names = append(names, id)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// apiName is the PascalCase name of the service, its title without " API".
+func apiName(doc *openapi3.T) string {
+	title := "Api"
+	if doc.Info != nil && doc.Info.Title != "" {
+		title = doc.Info.Title
+	}
+	return tsIdent(strings.TrimSuffix(strings.TrimSpace(title), " API"))
+}
+
+// methodArgs returns the parameter list of the client method for op.
+func methodArgs(op tsOperation) []string {
+	paramsType := tsIdent(op.Name) + "Params"
+	var args []string
+	if op.hasParams() {
+		if op.paramsRequired() {
+			args = append(args, "params: "+paramsType)
+		} else {
+			args = append(args, "params: "+paramsType+" = {}")
+		}
+	}
+	if op.Body != "" {
+		if op.BodyOptional {
+			args = append(args, "body?: "+op.Body)
+		} else {
+			args = append(args, "body: "+op.Body)
+		}
+	}
+	return append(args, "options: RequestOptions = {}")
+}
+
+// argNames returns the names of args, for forwarding them to another call.
+func argNames(args []string) []string {
+	names := make([]string, len(args))
+	for i, a := range args {
+		names[i] = strings.TrimSuffix(strings.SplitN(a, ":", 2)[0], "?")
+	}
+	return names
+}
+
+func (op tsOperation) hasParams() bool {
+	return len(op.PathParams)+len(op.QueryParams)+len(op.Headers) > 0
+}
+
+func (op tsOperation) paramsRequired() bool {
+	if len(op.PathParams) > 0 {
+		return true
+	}
+	for _, group := range [][]tsParam{op.QueryParams, op.Headers} {
+		for _, p := range group {
+			if p.Required {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (op tsOperation) hasQuery(name string) bool {
+	for _, q := range op.QueryParams {
+		if q.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func writeTSMethod(b *strings.Builder, op tsOperation) {
+	args := methodArgs(op)
+
+	b.WriteString("  /**\n")
+	if op.Description != "" {
+		for _, line := range strings.Split(strings.TrimSpace(op.Description), "\n") {
+			fmt.Fprintf(b, "   * %s\n", strings.ReplaceAll(strings.TrimSpace(line), "*/", "*\\/"))
+		}
+		b.WriteString("   *\n")
+	}
+	fmt.Fprintf(b, "   * %s %s\n   */\n", op.Method, op.Path)
+	fmt.Fprintf(b, "  %s(%s): Promise<%s> {\n", op.Name, strings.Join(args, ", "), op.Return)
+
+	urlPath := strconv.Quote(op.Path)
+	if len(op.PathParams) > 0 {
+		urlPath = "`" + op.Path + "`"
+		for _, p := range op.PathParams {
+			urlPath = strings.ReplaceAll(urlPath, "{"+p.Name+"}", "${encodeURIComponent(String(params["+strconv.Quote(p.Name)+"]))}")
+		}
+	}
+	fmt.Fprintf(b, "    return this.request<%s>(%q, %s, {\n      ...options,\n", op.Return, op.Method, urlPath)
+	if len(op.QueryParams) > 0 {
+		b.WriteString("      query: {")
+		for i, p := range op.QueryParams {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			fmt.Fprintf(b, " %s: params[%q]", tsProp(p.Name), p.Name)
+		}
+		b.WriteString(" },\n")
+	}
+	if len(op.Headers) > 0 {
+		b.WriteString("      headers: {")
+		for i, p := range op.Headers {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			fmt.Fprintf(b, " %s: params[%q]", strconv.Quote(p.Name), p.Name)
+		}
+		b.WriteString(", ...options.headers },\n")
+	}
+	if op.Body != "" {
+		b.WriteString("      body,\n")
+	}
+	b.WriteString("    });\n  }\n")
+
+	if op.PageItem == "" {
+		return
+	}
+	callArgs := argNames(args)
+	fmt.Fprintf(b, "\n  /** Iterates the items of every page of %s, starting at params.page. */\n", op.Name)
+	fmt.Fprintf(b, "  %sAll(%s): AsyncGenerator<%s> {\n", op.Name, strings.Join(args, ", "), op.PageItem)
+	callArgs[0] = "{ ...params, page }"
+	fmt.Fprintf(b, "    return paginate((page) => this.%s(%s), params.page);\n  }\n", op.Name, strings.Join(callArgs, ", "))
+}
+
+// operationMethods is the order operations of a path are emitted in.
+var operationMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodHead, http.MethodOptions,
+}
+
+func hasType(s *openapi3.Schema, t string) bool {
+	return s.Type != nil && s.Type.Is(t)
+}
+
+func sortedSchemaNames(schemas openapi3.Schemas) []string {
+	names := make([]string, 0, len(schemas))
+	for k := range schemas {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// mergedParameters applies operation parameters over the path item ones.
+func mergedParameters(pathParams, opParams openapi3.Parameters) []*openapi3.ParameterRef {
+	var out []*openapi3.ParameterRef
+	index := map[string]int{}
+	for _, list := range []openapi3.Parameters{pathParams, opParams} {
+		for _, ref := range list {
+			if ref == nil || ref.Value == nil {
+				continue
+			}
+			key := ref.Value.In + ":" + ref.Value.Name
+			if i, ok := index[key]; ok {
+				out[i] = ref
+				continue
+			}
+			index[key] = len(out)
+			out = append(out, ref)
+		}
+	}
+	return out
+}
+
+// jsonSchema returns the schema of the JSON media type of content, if any.
+func jsonSchema(content openapi3.Content) *openapi3.SchemaRef {
+	if mt := content.Get("application/json"); mt != nil && mt.Schema != nil {
+		return mt.Schema
+	}
+	for name, mt := range content {
+		if strings.HasSuffix(name, "+json") && mt.Schema != nil {
+			return mt.Schema
+		}
+	}
+	return nil
+}
+
+const tsClientRuntime = `/** Performs the HTTP requests of the client, window.fetch by default. */
+export type FetchAdapter = (url: string, init: RequestInit) => Promise<Response>;
+
+export interface ClientOptions {
+  /** Base URL of the service, e.g. https://api.example.com or /api */
+  baseURL: string;
+  /** Replaces fetch, e.g. Nuxt's $fetch.raw wrapper or a mock in tests */
+  fetch?: FetchAdapter;
+  /** Headers sent with every request, a function is called per request */
+  headers?: Record<string, string> | (() => Record<string, string> | Promise<Record<string, string>>);
+  /** Defaults to "include" so the session cookie is sent */
+  credentials?: RequestCredentials;
+}
+
+export interface RequestOptions {
+  headers?: Record<string, string | undefined>;
+  signal?: AbortSignal;
+}
+
+interface RequestConfig extends RequestOptions {
+  query?: Record<string, unknown>;
+  body?: unknown;
+}
+
+/** Thrown for non-2xx responses, body is the decoded error payload. */
+export class ApiError extends Error {
+  constructor(
+    public readonly status: number,
+    public readonly body: unknown,
+    message: string,
+  ) {
+    super(message);
+    this.name = 'ApiError';
+  }
+}
+
+/** Joins baseURL and path with a single slash, new URL() throws for a relative baseURL such as /api. */
+function joinURL(baseURL: string, path: string): string {
+  return baseURL.replace(/\/+$/, '') + '/' + path.replace(/^\/+/, '');
+}
+
+export class BaseClient {
+  protected readonly options: ClientOptions;
+
+  constructor(options: ClientOptions) {
+    this.options = { credentials: 'include', ...options };
+  }
+
+  protected async request<T>(method: string, path: string, config: RequestConfig = {}): Promise<T> {
+    const query = new URLSearchParams();
+    for (const [key, value] of Object.entries(config.query ?? {})) {
+      if (value === undefined || value === null) continue;
+      for (const v of Array.isArray(value) ? value : [value]) {
+        query.append(key, String(v));
+      }
+    }
+    const search = query.toString();
+    const url = joinURL(this.options.baseURL, path) + (search ? '?' + search : '');
+    const defaults = typeof this.options.headers === 'function' ? await this.options.headers() : this.options.headers;
+    const headers: Record<string, string> = { Accept: 'application/json', ...defaults };
+    for (const [key, value] of Object.entries(config.headers ?? {})) {
+      if (value !== undefined) headers[key] = value;
+    }
+    const init: RequestInit = { method, headers, credentials: this.options.credentials, signal: config.signal };
+    if (config.body !== undefined) {
+      if (config.body instanceof Blob || config.body instanceof FormData) {
+        init.body = config.body;
+      } else {
+        headers['Content-Type'] = 'application/json';
+        init.body = JSON.stringify(config.body);
+      }
+    }
+    const doFetch: FetchAdapter = this.options.fetch ?? ((u, i) => fetch(u, i));
+    const response = await doFetch(url, init);
+    const text = await response.text();
+    let data: unknown = undefined;
+    if (text) {
+      try {
+        data = JSON.parse(text);
+      } catch {
+        data = text;
+      }
+    }
+    if (!response.ok) {
+      const message = (data as { error?: string } | undefined)?.error ?? response.statusText;
+      throw new ApiError(response.status, data, message);
+    }
+    return data as T;
+  }
+}
+
+/** Yields the items of consecutive pages until totalPages is reached. */
+export async function* paginate<T>(fetchPage: (page: number) => Promise<Page<T>>, start = 1): AsyncGenerator<T> {
+  for (let page = start; ; page++) {
+    const result = await fetchPage(page);
+    yield* result.items ?? [];
+    if (page >= result.totalPages || (result.items ?? []).length === 0) return;
+  }
+}
+
+/** Collects every item of an async iterable, e.g. a client's ...All method. */
+export async function collect<T>(items: AsyncIterable<T>): Promise<T[]> {
+  const out: T[] = [];
+  for await (const item of items) out.push(item);
+  return out;
+}
+`
@@ -0,0 +1,584 @@
+package mserve
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/DarlingGoose/mserve/nuxt3FromOpenApi"
+	"github.com/DarlingGoose/mserve/openapidiff"
+	"github.com/DarlingGoose/rbac"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3gen"
+	"github.com/spf13/cobra"
+)
+
+// Security scheme names declared in components.securitySchemes.
+const (
+	SecuritySchemeSession = "cookieSession"
+	SecuritySchemeBearer  = "bearerAuth"
+	SecuritySchemeOAuth2  = "oauth2"
+	SecuritySchemeAPIKey  = "apiKey"
+
+	sessionCookieName = "session"
+)
+
+// securitySchemes declares the session cookie and bearer token schemes, the
+// X-API-Key header after SetupAPIKeys, plus an OAuth2 authorization code flow
+// when the oauth server endpoints (/authorize and /token) are registered.
+func securitySchemes(server *Server, baseURL string, endpoints []Endpoint) openapi3.SecuritySchemes {
+	schemes := openapi3.SecuritySchemes{
+		SecuritySchemeSession: &openapi3.SecuritySchemeRef{Value: &openapi3.SecurityScheme{
+			Type:        "apiKey",
+			In:          "cookie",
+			Name:        sessionCookieName,
+			Description: "Signed session cookie set by the login endpoints",
+		}},
+		SecuritySchemeBearer: &openapi3.SecuritySchemeRef{Value: &openapi3.SecurityScheme{
+			Type:         "http",
+			Scheme:       "bearer",
+			BearerFormat: "JWT",
+			Description:  "Access token issued by the token endpoint",
+		}},
+	}
+	if server.apiKeys != nil {
+		schemes[SecuritySchemeAPIKey] = &openapi3.SecuritySchemeRef{Value: &openapi3.SecurityScheme{
+			Type:        "apiKey",
+			In:          "header",
+			Name:        APIKeyHeader,
+			Description: "API key of a service account",
+		}}
+	}
+	if !hasOAuthServer(endpoints) {
+		return schemes
+	}
+	scopes := map[string]string{}
+	for _, e := range endpoints {
+		if e.Scope != "" {
+			scopes[e.Scope] = e.Scope
+		}
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	schemes[SecuritySchemeOAuth2] = &openapi3.SecuritySchemeRef{Value: &openapi3.SecurityScheme{
+		Type: "oauth2",
+		Flows: &openapi3.OAuthFlows{
+			AuthorizationCode: &openapi3.OAuthFlow{
+				AuthorizationURL: baseURL + "/authorize",
+				TokenURL:         baseURL + "/token",
+				Scopes:           scopes,
+			},
+			ClientCredentials: &openapi3.OAuthFlow{
+				TokenURL: baseURL + "/token",
+				Scopes:   scopes,
+			},
+		},
+	}}
+	return schemes
+}
+
+func hasOAuthServer(endpoints []Endpoint) bool {
+	var authorize, token bool
+	for _, e := range endpoints {
+		switch e.Path {
+		case "/authorize":
+			authorize = true
+		case "/token":
+			token = true
+		}
+	}
+	return authorize && token
+}
+
+// operationSecurity returns the alternative requirements for ep. Endpoints
+// with Roles need a session, bearer token or API key, those with a Scope also
+// accept an oauth2 token carrying it. Endpoints with neither are open to the default
+// role, so authentication is optional ({}), and the health check is public.
+func operationSecurity(server *Server, ep Endpoint, schemes openapi3.SecuritySchemes) *openapi3.SecurityRequirements {
+	if server.healthCheckPath != "" && ep.Path == server.healthCheckPath {
+		return &openapi3.SecurityRequirements{}
+	}
+	reqs := openapi3.SecurityRequirements{
+		{SecuritySchemeSession: []string{}},
+		{SecuritySchemeBearer: []string{}},
+	}
+	if _, ok := schemes[SecuritySchemeAPIKey]; ok {
+		reqs = append(reqs, openapi3.SecurityRequirement{SecuritySchemeAPIKey: []string{}})
+	}
+	if _, ok := schemes[SecuritySchemeOAuth2]; ok && ep.Scope != "" {
+		reqs = append(reqs, openapi3.SecurityRequirement{SecuritySchemeOAuth2: []string{ep.Scope}})
+	}
+	if len(ep.Roles) == 0 && ep.Scope == "" {
+		reqs = append(reqs, openapi3.SecurityRequirement{})
+	}
+	return &reqs
+}
+
+// operationRoles returns the x-roles of ep for method, with the access the
+// role is granted, resolved from the method when the Role leaves it empty.
+func operationRoles(ep Endpoint, method string) []Role {
+	roles := make([]Role, 0, len(ep.Roles))
+	for _, r := range ep.Roles {
+		if r.Access == "" {
+			r.Access = rbac.HTTPMethodToAction(method)
+		}
+		roles = append(roles, r)
+	}
+	return roles
+}
+
+// pathTag derives the tag of an endpoint from the first static segment of its
+// path, e.g. "/users/get" and "/users/{id}" are both tagged "users".
+func pathTag(p string) string {
+	for _, seg := range strings.Split(p, "/") {
+		seg = strings.TrimPrefix(seg, ".")
+		if seg == "" || strings.HasPrefix(seg, "{") {
+			continue
+		}
+		return seg
+	}
+	return "default"
+}
+
+// endpointTags returns the sorted tag list for the document.
+func endpointTags(endpoints []Endpoint) openapi3.Tags {
+	seen := map[string]bool{}
+	var names []string
+	for _, e := range endpoints {
+		if e.Internal {
+			continue
+		}
+		if t := pathTag(e.Path); !seen[t] {
+			seen[t] = true
+			names = append(names, t)
+		}
+	}
+	sort.Strings(names)
+	tags := make(openapi3.Tags, 0, len(names))
+	for _, name := range names {
+		tags = append(tags, &openapi3.Tag{Name: name})
+	}
+	return tags
+}
+
+// roptionSchema builds the schema of a param or header from its ROption.
+func roptionSchema(o ROption) *openapi3.SchemaRef {
+	sch := &openapi3.Schema{Type: &openapi3.Types{openapi3.TypeString}}
+	switch strings.ToLower(o.Type) {
+	case "int", "integer":
+		sch.Type = &openapi3.Types{openapi3.TypeInteger}
+	case "float", "number":
+		sch.Type = &openapi3.Types{openapi3.TypeNumber}
+	case "bool", "boolean":
+		sch.Type = &openapi3.Types{openapi3.TypeBoolean}
+	case "date-time", "uuid", "email", "uri":
+		sch.Format = strings.ToLower(o.Type)
+	}
+	for _, v := range o.Enum {
+		sch.Enum = append(sch.Enum, typedValue(sch.Type, v))
+	}
+	if o.Default != "" {
+		sch.Default = typedValue(sch.Type, o.Default)
+	}
+	return openapi3.NewSchemaRef("", sch)
+}
+
+// typedValue converts a string default or enum value to the schema type, so it
+// validates against the schema.
+func typedValue(t *openapi3.Types, v string) interface{} {
+	switch {
+	case t.Is(openapi3.TypeInteger):
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n
+		}
+	case t.Is(openapi3.TypeNumber):
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	case t.Is(openapi3.TypeBoolean):
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return v
+}
+
+// responseHeaders converts the declared response headers.
+func responseHeaders(headers map[string]ROption) openapi3.Headers {
+	if len(headers) == 0 {
+		return nil
+	}
+	out := openapi3.Headers{}
+	for name, o := range headers {
+		out[http.CanonicalHeaderKey(name)] = &openapi3.HeaderRef{Value: &openapi3.Header{
+			Parameter: openapi3.Parameter{
+				Description: o.Description,
+				Required:    o.Required,
+				Schema:      roptionSchema(o),
+			},
+		}}
+	}
+	return out
+}
+
+// withExample sets example on every media type of content. The example is
+// round-tripped through JSON so it validates against the generated schema.
+func withExample(content openapi3.Content, example interface{}) openapi3.Content {
+	if example == nil {
+		return content
+	}
+	if raw, err := json.Marshal(example); err == nil {
+		var v interface{}
+		if json.Unmarshal(raw, &v) == nil {
+			example = v
+		}
+	}
+	for _, mt := range content {
+		mt.Example = example
+	}
+	return content
+}
+
+// pathVarPattern matches gorilla/mux path variables, with an optional regexp.
+var pathVarPattern = regexp.MustCompile(`\{([^{}:]+)(:[^{}]*)?\}`)
+
+// openAPIPath strips gorilla/mux variable patterns, "/a/{id:[0-9]+}" -> "/a/{id}".
+func openAPIPath(p string) string {
+	return pathVarPattern.ReplaceAllString(p, "{$1}")
+}
+
+// operationParameters declares params found in the path template as path
+// params and every other param as a query param. Template variables without a
+// declared param are added as required strings.
+func operationParameters(ep Endpoint, p string) openapi3.Parameters {
+	params := openapi3.Parameters{}
+	inPath := map[string]bool{}
+	for _, m := range pathVarPattern.FindAllStringSubmatch(p, -1) {
+		inPath[m[1]] = true
+	}
+	for _, name := range sortedKeys(ep.Request.Params) {
+		o := ep.Request.Params[name]
+		in, required := openapi3.ParameterInQuery, o.Required
+		if inPath[name] {
+			in, required = openapi3.ParameterInPath, true
+			delete(inPath, name)
+		}
+		params = append(params, &openapi3.ParameterRef{Value: &openapi3.Parameter{
+			Name:        name,
+			In:          in,
+			Required:    required,
+			Description: o.Description,
+			Schema:      roptionSchema(o),
+		}})
+	}
+	for _, m := range pathVarPattern.FindAllStringSubmatch(p, -1) {
+		if !inPath[m[1]] {
+			continue
+		}
+		params = append(params, &openapi3.ParameterRef{Value: &openapi3.Parameter{
+			Name:     m[1],
+			In:       openapi3.ParameterInPath,
+			Required: true,
+			Schema:   openapi3.NewStringSchema().NewRef(),
+		}})
+	}
+	for _, name := range sortedKeys(ep.Request.Headers) {
+		o := ep.Request.Headers[name]
+		params = append(params, &openapi3.ParameterRef{Value: &openapi3.Parameter{
+			Name:        name,
+			In:          openapi3.ParameterInHeader,
+			Required:    o.Required,
+			Description: o.Description,
+			Schema:      roptionSchema(o),
+		}})
+	}
+	return params
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// operationIDs hands out unique operation IDs. The endpoint Name is used as is
+// when only one operation carries it, otherwise the method is appended
+// ("Clients Post") and, as a last resort, a counter.
+type operationIDs struct {
+	counts map[string]int
+	used   map[string]bool
+}
+
+func newOperationIDs(endpoints []Endpoint) *operationIDs {
+	ids := &operationIDs{counts: map[string]int{}, used: map[string]bool{}}
+	for _, ep := range endpoints {
+		if ep.Internal {
+			continue
+		}
+		for _, m := range ep.Methods {
+			ids.counts[operationBaseName(ep, m)]++
+		}
+	}
+	return ids
+}
+
+func operationBaseName(ep Endpoint, method string) string {
+	if ep.Name != "" {
+		return ep.Name
+	}
+	return strings.ToLower(method) + " " + strings.Trim(openAPIPath(ep.Path), "/")
+}
+
+func (ids *operationIDs) next(ep Endpoint, method string) string {
+	id := operationBaseName(ep, method)
+	if ids.counts[id] > 1 {
+		id += " " + nuxt3FromOpenApi.ToPascalCase(method)
+	}
+	candidate := id
+	for i := 2; ids.used[candidate]; i++ {
+		candidate = fmt.Sprintf("%s %d", id, i)
+	}
+	ids.used[candidate] = true
+	return candidate
+}
+
+// schemaRegistry registers struct types in components.schemas and returns
+// $refs to them. Names are the Go type name; generic instantiations are
+// flattened ("Page[pkg.User]" -> "PageUser"), anonymous structs are named after
+// their operation, and clashes between packages are prefixed with the package name.
+type schemaRegistry struct {
+	schemas openapi3.Schemas
+	names   map[reflect.Type]string
+	types   map[string]reflect.Type
+}
+
+func newSchemaRegistry(schemas openapi3.Schemas) *schemaRegistry {
+	return &schemaRegistry{schemas: schemas, names: map[reflect.Type]string{}, types: map[string]reflect.Type{}}
+}
+
+func (r *schemaRegistry) ref(v interface{}, fallback string) (*openapi3.SchemaRef, error) {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		// untyped nil, e.g. the element of an []interface{}
+		return openapi3.NewSchema().NewRef(), nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		if k := t.Elem().Kind(); k == reflect.Uint8 || k == reflect.Interface {
+			break
+		}
+		items, err := r.ref(reflect.New(t.Elem()).Elem().Interface(), fallback+"Item")
+		if err != nil {
+			return nil, err
+		}
+		arr := openapi3.NewArraySchema()
+		arr.Items = items
+		return arr.NewRef(), nil
+	case reflect.Struct:
+		if name, ok := r.names[t]; ok {
+			return openapi3.NewSchemaRef("#/components/schemas/"+name, r.schemas[name].Value), nil
+		}
+		sch, err := openapi3gen.NewSchemaRefForValue(reflect.New(t).Elem().Interface(), nil)
+		if err != nil {
+			return nil, err
+		}
+		name := r.name(t, fallback)
+		sch.Value.Title = name
+		r.names[t] = name
+		r.types[name] = t
+		r.schemas[name] = sch
+		return openapi3.NewSchemaRef("#/components/schemas/"+name, sch.Value), nil
+	}
+	return openapi3gen.NewSchemaRefForValue(v, nil)
+}
+
+func (r *schemaRegistry) name(t reflect.Type, fallback string) string {
+	name := t.Name()
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		// generic instantiation, keep the last path element of each type argument
+		var b strings.Builder
+		b.WriteString(name[:i])
+		for _, arg := range strings.FieldsFunc(name[i:], func(c rune) bool { return strings.ContainsRune("[], *", c) }) {
+			if j := strings.LastIndexAny(arg, "./"); j >= 0 {
+				arg = arg[j+1:]
+			}
+			b.WriteString(nuxt3FromOpenApi.ToPascalCase(arg))
+		}
+		name = b.String()
+	}
+	if name == "" {
+		name = fallback
+	}
+	if other, taken := r.types[name]; taken && other != t {
+		name = nuxt3FromOpenApi.ToPascalCase(path.Base(t.PkgPath())) + name
+	}
+	candidate := name
+	for i := 2; r.types[candidate] != nil && r.types[candidate] != t; i++ {
+		candidate = fmt.Sprintf("%s%d", name, i)
+	}
+	return candidate
+}
+
+// ConvertOpenAPI31 rewrites a generated 3.0 document as OpenAPI 3.1.0:
+// nullable schemas become type unions with "null".
+func ConvertOpenAPI31(doc *openapi3.T) {
+	doc.OpenAPI = "3.1.0"
+	walkSchemas(doc, func(sch *openapi3.Schema) {
+		if sch.Nullable {
+			sch.Nullable = false
+			if sch.Type != nil && !sch.Type.Includes("null") {
+				types := append(*sch.Type, "null")
+				sch.Type = &types
+			}
+		}
+	})
+}
+
+// convertOpenAPI30 reverts ConvertOpenAPI31: type unions with "null" become
+// nullable schemas again.
+func convertOpenAPI30(doc *openapi3.T) {
+	doc.OpenAPI = "3.0.3"
+	walkSchemas(doc, func(sch *openapi3.Schema) {
+		if sch.Type == nil || !sch.Type.Includes("null") {
+			return
+		}
+		types := openapi3.Types{}
+		for _, t := range *sch.Type {
+			if t != "null" {
+				types = append(types, t)
+			}
+		}
+		sch.Type = &types
+		sch.Nullable = true
+	})
+}
+
+// walkSchemas calls f once for every schema of doc, nested ones included.
+func walkSchemas(doc *openapi3.T, f func(sch *openapi3.Schema)) {
+	seen := map[*openapi3.Schema]bool{}
+	var walk func(ref *openapi3.SchemaRef)
+	walk = func(ref *openapi3.SchemaRef) {
+		if ref == nil || ref.Value == nil || seen[ref.Value] {
+			return
+		}
+		sch := ref.Value
+		seen[sch] = true
+		f(sch)
+		walk(sch.Items)
+		walk(sch.Not)
+		if sch.AdditionalProperties.Schema != nil {
+			walk(sch.AdditionalProperties.Schema)
+		}
+		for _, p := range sch.Properties {
+			walk(p)
+		}
+		for _, list := range []openapi3.SchemaRefs{sch.AllOf, sch.AnyOf, sch.OneOf} {
+			for _, s := range list {
+				walk(s)
+			}
+		}
+	}
+	if doc.Components != nil {
+		for _, sch := range doc.Components.Schemas {
+			walk(sch)
+		}
+	}
+	for _, pi := range doc.Paths.Map() {
+		for _, op := range pi.Operations() {
+			for _, p := range op.Parameters {
+				walk(p.Value.Schema)
+			}
+			if op.RequestBody != nil {
+				for _, mt := range op.RequestBody.Value.Content {
+					walk(mt.Schema)
+				}
+			}
+			for _, resp := range op.Responses.Map() {
+				for _, mt := range resp.Value.Content {
+					walk(mt.Schema)
+				}
+			}
+		}
+	}
+}
+
+// ValidateOpenAPI validates doc and, when it is invalid, returns a report with
+// one error per failing component, path and operation instead of only the first.
+//
+// kin-openapi only validates OpenAPI 3.0, so a 3.1 document can not be checked
+// as such: a copy with its "null" type unions turned back into nullable
+// schemas is validated instead, other 3.1 constructs are reported as invalid.
+func ValidateOpenAPI(ctx context.Context, doc *openapi3.T) error {
+	if strings.HasPrefix(doc.OpenAPI, "3.1") {
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		if doc, err = openapi3.NewLoader().LoadFromData(data); err != nil {
+			return err
+		}
+		convertOpenAPI30(doc)
+	}
+	if err := doc.Validate(ctx); err == nil {
+		return nil
+	} else if doc.Paths == nil {
+		return err
+	}
+	var errs []error
+	if err := doc.Components.Validate(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("components: %w", err))
+	}
+	if err := doc.Info.Validate(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("info: %w", err))
+	}
+	if err := doc.Servers.Validate(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("servers: %w", err))
+	}
+	for _, p := range doc.Paths.InMatchingOrder() {
+		single := openapi3.NewPaths(openapi3.WithPath(p, doc.Paths.Value(p)))
+		if err := single.Validate(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	ids := map[string]string{}
+	for _, p := range doc.Paths.InMatchingOrder() {
+		for method, op := range doc.Paths.Value(p).Operations() {
+			if other, ok := ids[op.OperationID]; ok && op.OperationID != "" {
+				errs = append(errs, fmt.Errorf("operation %s %s: duplicate operationId %q (also %s)", method, p, op.OperationID, other))
+			}
+			ids[op.OperationID] = method + " " + p
+		}
+	}
+	if len(errs) == 0 {
+		return doc.Validate(ctx)
+	}
+	return errors.Join(errs...)
+}
+
+// OpenAPICommand returns an "openapi" command for the service binary with a
+// "diff <saved>" subcommand comparing a saved document to the one generated
+// from the registered endpoints; it exits non-zero on breaking changes.
+func (s *Server) OpenAPICommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "openapi",
+		Short: "Work with the service OpenAPI document",
+	}
+	cmd.AddCommand(openapidiff.Command(func() (*openapi3.T, error) {
+		return GenerateOpenAPI(s, s.endpoints)
+	}))
+	return cmd
+}
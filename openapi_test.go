@@ -0,0 +1,26 @@
+package mserve
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGenerateOpenAPIInterfaceSlice(t *testing.T) {
+	endpoints := []Endpoint{{
+		Name:    "list things",
+		Methods: []string{http.MethodGet},
+		Path:    "/things",
+		Responses: []Response{
+			{Status: http.StatusOK, Body: []interface{}{}},
+		},
+	}}
+	doc, err := GenerateOpenAPI(&Server{ServiceName: "things"}, endpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := doc.Paths.Value("/things").Get.Responses.Status(http.StatusOK)
+	sch := resp.Value.Content.Get("application/json").Schema.Value
+	if !sch.Type.Is("array") || sch.Items == nil {
+		t.Errorf("got schema %+v, want an array", sch)
+	}
+}
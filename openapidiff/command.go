@@ -0,0 +1,84 @@
+package openapidiff
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/spf13/cobra"
+)
+
+// ErrBreakingChanges is returned by the diff command when breaking changes are
+// found, so the process exits non-zero.
+var ErrBreakingChanges = errors.New("breaking OpenAPI changes detected")
+
+// Command returns the "diff <saved> [current]" subcommand. When current is not
+// given, the document returned by generate is compared instead, which lets a
+// service binary diff its freshly generated spec. generate may be nil.
+func Command(generate func() (*openapi3.T, error)) *cobra.Command {
+	var (
+		format        string
+		allowBreaking bool
+		onlyBreaking  bool
+		usage         = "diff <saved> [current]"
+	)
+	if generate == nil {
+		usage = "diff <saved> <current>"
+	}
+	cmd := &cobra.Command{
+		Use:   usage,
+		Short: "Classify the changes between two OpenAPI documents as breaking or non-breaking",
+		Long: "Compares a saved OpenAPI document (file or URL) with the current one and exits\n" +
+			"non-zero when a change would break existing clients: removed paths, operations\n" +
+			"or params, newly required fields, type changes and enum narrowing.",
+		Args:         cobra.RangeArgs(1, 2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			saved, err := Load(ctx, args[0])
+			if err != nil {
+				return fmt.Errorf("loading %s: %w", args[0], err)
+			}
+			var current *openapi3.T
+			switch {
+			case len(args) == 2:
+				current, err = Load(ctx, args[1])
+				if err != nil {
+					return fmt.Errorf("loading %s: %w", args[1], err)
+				}
+			case generate != nil:
+				current, err = generate()
+				if err != nil {
+					return fmt.Errorf("generating current document: %w", err)
+				}
+			default:
+				return errors.New("current document is required")
+			}
+
+			report := Diff(saved, current)
+			if onlyBreaking {
+				report = &Report{Changes: report.Breaking()}
+			}
+			out := cmd.OutOrStdout()
+			switch format {
+			case "json":
+				err = report.WriteJSON(out)
+			case "text":
+				err = report.WriteText(out)
+			default:
+				return fmt.Errorf("unsupported format %q", format)
+			}
+			if err != nil {
+				return err
+			}
+			if report.HasBreaking() && !allowBreaking {
+				return ErrBreakingChanges
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", "text", "output format: text or json")
+	cmd.Flags().BoolVar(&allowBreaking, "allow-breaking", false, "exit zero even when breaking changes are found")
+	cmd.Flags().BoolVar(&onlyBreaking, "only-breaking", false, "report breaking changes only")
+	return cmd
+}
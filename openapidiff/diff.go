@@ -0,0 +1,429 @@
+// Package openapidiff compares two OpenAPI documents and classifies every
+// change as breaking or non-breaking for existing clients.
+package openapidiff
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+type Severity string
+
+const (
+	Breaking    = Severity("breaking")
+	NonBreaking = Severity("non-breaking")
+)
+
+// Change is a single difference between two documents.
+type Change struct {
+	Severity Severity `json:"severity"`
+	Path     string   `json:"path"`
+	Method   string   `json:"method,omitempty"`
+	// Location inside the operation, e.g. "query param limit" or "response 200 body .items[].id"
+	Location string `json:"location,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (c Change) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s] ", c.Severity)
+	if c.Method != "" {
+		b.WriteString(c.Method + " ")
+	}
+	b.WriteString(c.Path)
+	if c.Location != "" {
+		b.WriteString(" " + c.Location)
+	}
+	b.WriteString(": " + c.Message)
+	return b.String()
+}
+
+// Report is the result of Diff.
+type Report struct {
+	Changes []Change `json:"changes"`
+}
+
+// HasBreaking reports whether any change is breaking.
+func (r *Report) HasBreaking() bool {
+	return len(r.Breaking()) > 0
+}
+
+// Breaking returns the breaking changes only.
+func (r *Report) Breaking() []Change {
+	var out []Change
+	for _, c := range r.Changes {
+		if c.Severity == Breaking {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// WriteText writes one line per change, breaking changes first.
+func (r *Report) WriteText(w io.Writer) error {
+	if len(r.Changes) == 0 {
+		_, err := fmt.Fprintln(w, "no changes")
+		return err
+	}
+	for _, c := range r.Changes {
+		if _, err := fmt.Fprintln(w, c.String()); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d changes, %d breaking\n", len(r.Changes), len(r.Breaking()))
+	return err
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// Load reads a document from a file path or an http(s) URL, resolving $refs.
+func Load(ctx context.Context, location string) (*openapi3.T, error) {
+	loader := openapi3.NewLoader()
+	loader.Context = ctx
+	loader.IsExternalRefsAllowed = true
+	if u, err := url.Parse(location); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		return loader.LoadFromURI(u)
+	}
+	return loader.LoadFromFile(location)
+}
+
+// Diff compares the saved document old with the current document new.
+func Diff(old, new *openapi3.T) *Report {
+	d := &differ{}
+	oldPaths, newPaths := pathMap(old), pathMap(new)
+	for _, p := range sortedKeys(oldPaths) {
+		np, ok := newPaths[p]
+		if !ok {
+			d.add(Breaking, p, "", "", "path removed")
+			continue
+		}
+		d.pathItem(p, oldPaths[p], np)
+	}
+	for _, p := range sortedKeys(newPaths) {
+		if _, ok := oldPaths[p]; !ok {
+			d.add(NonBreaking, p, "", "", "path added")
+		}
+	}
+	sort.SliceStable(d.report.Changes, func(i, j int) bool {
+		return d.report.Changes[i].Severity == Breaking && d.report.Changes[j].Severity != Breaking
+	})
+	return &d.report
+}
+
+type differ struct {
+	report Report
+}
+
+func (d *differ) add(sev Severity, path, method, location, msg string) {
+	d.report.Changes = append(d.report.Changes, Change{Severity: sev, Path: path, Method: method, Location: location, Message: msg})
+}
+
+func (d *differ) pathItem(p string, old, new *openapi3.PathItem) {
+	oldOps, newOps := old.Operations(), new.Operations()
+	for _, m := range sortedKeys(oldOps) {
+		nop, ok := newOps[m]
+		if !ok {
+			d.add(Breaking, p, m, "", "operation removed")
+			continue
+		}
+		d.operation(p, m, oldOps[m], nop, old.Parameters, new.Parameters)
+	}
+	for _, m := range sortedKeys(newOps) {
+		if _, ok := oldOps[m]; !ok {
+			d.add(NonBreaking, p, m, "", "operation added")
+		}
+	}
+}
+
+func (d *differ) operation(p, m string, old, new *openapi3.Operation, oldShared, newShared openapi3.Parameters) {
+	if old.OperationID != new.OperationID {
+		d.add(NonBreaking, p, m, "", fmt.Sprintf("operationId changed from %q to %q (renames generated client methods)", old.OperationID, new.OperationID))
+	}
+	oldParams, newParams := paramMap(oldShared, old.Parameters), paramMap(newShared, new.Parameters)
+	for _, k := range sortedKeys(oldParams) {
+		op := oldParams[k]
+		loc := op.In + " param " + op.Name
+		np, ok := newParams[k]
+		if !ok {
+			d.add(Breaking, p, m, loc, "parameter removed")
+			continue
+		}
+		if !op.Required && np.Required {
+			d.add(Breaking, p, m, loc, "parameter became required")
+		} else if op.Required && !np.Required {
+			d.add(NonBreaking, p, m, loc, "parameter became optional")
+		}
+		d.schema(p, m, loc, schemaOf(op.Schema), schemaOf(np.Schema), true, map[[2]*openapi3.Schema]bool{})
+	}
+	for _, k := range sortedKeys(newParams) {
+		if _, ok := oldParams[k]; ok {
+			continue
+		}
+		np := newParams[k]
+		if np.Required {
+			d.add(Breaking, p, m, np.In+" param "+np.Name, "required parameter added")
+		} else {
+			d.add(NonBreaking, p, m, np.In+" param "+np.Name, "optional parameter added")
+		}
+	}
+
+	d.requestBody(p, m, old.RequestBody, new.RequestBody)
+	d.responses(p, m, old.Responses, new.Responses)
+}
+
+func (d *differ) requestBody(p, m string, old, new *openapi3.RequestBodyRef) {
+	oldBody, newBody := requestBodyOf(old), requestBodyOf(new)
+	switch {
+	case oldBody == nil && newBody == nil:
+		return
+	case oldBody == nil:
+		if newBody.Required {
+			d.add(Breaking, p, m, "request body", "required request body added")
+		} else {
+			d.add(NonBreaking, p, m, "request body", "optional request body added")
+		}
+		return
+	case newBody == nil:
+		d.add(NonBreaking, p, m, "request body", "request body removed")
+		return
+	}
+	if !oldBody.Required && newBody.Required {
+		d.add(Breaking, p, m, "request body", "request body became required")
+	}
+	for _, ct := range sortedKeys(oldBody.Content) {
+		nmt, ok := newBody.Content[ct]
+		if !ok {
+			d.add(Breaking, p, m, "request body", "media type "+ct+" no longer accepted")
+			continue
+		}
+		d.schema(p, m, "request body", schemaOf(oldBody.Content[ct].Schema), schemaOf(nmt.Schema), true, map[[2]*openapi3.Schema]bool{})
+	}
+}
+
+func (d *differ) responses(p, m string, old, new *openapi3.Responses) {
+	oldResp, newResp := responseMap(old), responseMap(new)
+	for _, status := range sortedKeys(oldResp) {
+		loc := "response " + status
+		nr, ok := newResp[status]
+		if !ok {
+			sev := NonBreaking
+			if strings.HasPrefix(status, "2") {
+				sev = Breaking
+			}
+			d.add(sev, p, m, loc, "response removed")
+			continue
+		}
+		or := oldResp[status]
+		for _, h := range sortedKeys(or.Headers) {
+			if _, ok := nr.Headers[h]; !ok {
+				d.add(Breaking, p, m, loc+" header "+h, "response header removed")
+			}
+		}
+		for _, ct := range sortedKeys(or.Content) {
+			nmt, ok := nr.Content[ct]
+			if !ok {
+				d.add(Breaking, p, m, loc, "media type "+ct+" no longer returned")
+				continue
+			}
+			d.schema(p, m, loc+" body", schemaOf(or.Content[ct].Schema), schemaOf(nmt.Schema), false, map[[2]*openapi3.Schema]bool{})
+		}
+	}
+	for _, status := range sortedKeys(newResp) {
+		if _, ok := oldResp[status]; !ok {
+			d.add(NonBreaking, p, m, "response "+status, "response added")
+		}
+	}
+}
+
+// schema compares two schemas. request is true for data sent by the client,
+// where narrowing is breaking, and false for data returned to it, where
+// removing or loosening fields is breaking.
+func (d *differ) schema(p, m, loc string, old, new *openapi3.Schema, request bool, seen map[[2]*openapi3.Schema]bool) {
+	if old == nil || new == nil {
+		if old != nil || new != nil {
+			d.add(Breaking, p, m, loc, "schema "+presence(old, new))
+		}
+		return
+	}
+	if seen[[2]*openapi3.Schema{old, new}] {
+		return
+	}
+	seen[[2]*openapi3.Schema{old, new}] = true
+
+	if ot, nt := typeName(old), typeName(new); ot != nt && ot != "" && nt != "" {
+		d.add(Breaking, p, m, loc, fmt.Sprintf("type changed from %s to %s", ot, nt))
+		return
+	}
+	if old.Format != new.Format && old.Format != "" {
+		d.add(Breaking, p, m, loc, fmt.Sprintf("format changed from %q to %q", old.Format, new.Format))
+	}
+	d.enum(p, m, loc, old.Enum, new.Enum, request)
+
+	oldReq, newReq := stringSet(old.Required), stringSet(new.Required)
+	for _, name := range sortedKeys(old.Properties) {
+		ploc := loc + " ." + name
+		np, ok := new.Properties[name]
+		if !ok {
+			if request {
+				d.add(NonBreaking, p, m, ploc, "property removed")
+			} else {
+				d.add(Breaking, p, m, ploc, "property removed")
+			}
+			continue
+		}
+		if request && !oldReq[name] && newReq[name] {
+			d.add(Breaking, p, m, ploc, "property became required")
+		}
+		if !request && oldReq[name] && !newReq[name] {
+			d.add(Breaking, p, m, ploc, "property is no longer always present")
+		}
+		d.schema(p, m, ploc, schemaOf(old.Properties[name]), schemaOf(np), request, seen)
+	}
+	for _, name := range sortedKeys(new.Properties) {
+		if _, ok := old.Properties[name]; ok {
+			continue
+		}
+		if request && newReq[name] {
+			d.add(Breaking, p, m, loc+" ."+name, "required property added")
+		} else {
+			d.add(NonBreaking, p, m, loc+" ."+name, "property added")
+		}
+	}
+	if old.Items != nil || new.Items != nil {
+		d.schema(p, m, loc+"[]", schemaOf(old.Items), schemaOf(new.Items), request, seen)
+	}
+}
+
+func (d *differ) enum(p, m, loc string, old, new []interface{}, request bool) {
+	if len(old) == 0 && len(new) == 0 {
+		return
+	}
+	oldSet, newSet := valueSet(old), valueSet(new)
+	if len(old) == 0 {
+		if request {
+			d.add(Breaking, p, m, loc, "enum restriction added")
+		} else {
+			d.add(NonBreaking, p, m, loc, "enum restriction added")
+		}
+		return
+	}
+	for _, v := range sortedKeys(oldSet) {
+		if len(new) > 0 && !newSet[v] {
+			if request {
+				d.add(Breaking, p, m, loc, "enum value "+v+" removed")
+			} else {
+				d.add(NonBreaking, p, m, loc, "enum value "+v+" no longer returned")
+			}
+		}
+	}
+	for _, v := range sortedKeys(newSet) {
+		if !oldSet[v] {
+			if request {
+				d.add(NonBreaking, p, m, loc, "enum value "+v+" added")
+			} else {
+				d.add(Breaking, p, m, loc, "enum value "+v+" may now be returned")
+			}
+		}
+	}
+}
+
+func pathMap(doc *openapi3.T) map[string]*openapi3.PathItem {
+	if doc == nil || doc.Paths == nil {
+		return map[string]*openapi3.PathItem{}
+	}
+	return doc.Paths.Map()
+}
+
+// paramMap keys operation params (which override path-level ones) by in+name.
+func paramMap(lists ...openapi3.Parameters) map[string]*openapi3.Parameter {
+	out := map[string]*openapi3.Parameter{}
+	for _, list := range lists {
+		for _, ref := range list {
+			if ref == nil || ref.Value == nil {
+				continue
+			}
+			out[ref.Value.In+":"+ref.Value.Name] = ref.Value
+		}
+	}
+	return out
+}
+
+func responseMap(r *openapi3.Responses) map[string]*openapi3.Response {
+	out := map[string]*openapi3.Response{}
+	if r == nil {
+		return out
+	}
+	for status, ref := range r.Map() {
+		if ref != nil && ref.Value != nil {
+			out[status] = ref.Value
+		}
+	}
+	return out
+}
+
+func requestBodyOf(ref *openapi3.RequestBodyRef) *openapi3.RequestBody {
+	if ref == nil {
+		return nil
+	}
+	return ref.Value
+}
+
+func schemaOf(ref *openapi3.SchemaRef) *openapi3.Schema {
+	if ref == nil {
+		return nil
+	}
+	return ref.Value
+}
+
+func typeName(s *openapi3.Schema) string {
+	if s.Type == nil {
+		return ""
+	}
+	types := append([]string{}, s.Type.Slice()...)
+	sort.Strings(types)
+	return strings.Join(types, "|")
+}
+
+func presence(old, new *openapi3.Schema) string {
+	if old == nil {
+		return "added"
+	}
+	return "removed"
+}
+
+func stringSet(values []string) map[string]bool {
+	out := map[string]bool{}
+	for _, v := range values {
+		out[v] = true
+	}
+	return out
+}
+
+func valueSet(values []interface{}) map[string]bool {
+	out := map[string]bool{}
+	for _, v := range values {
+		out[fmt.Sprint(v)] = true
+	}
+	return out
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -21,6 +21,8 @@ type Pagination struct {
 	Limit      int `json:"limit"`
 	Total      int `json:"total"`
 	TotalPages int `json:"totalPages"`
+	// NextCursor is set by cursor paginated lists, empty on their last page
+	NextCursor string `json:"nextCursor,omitempty"`
 }
 
 type Page[T any] struct {
@@ -29,6 +31,8 @@ type Page[T any] struct {
 	Limit      int `json:"limit"`
 	Total      int `json:"total"`
 	TotalPages int `json:"totalPages"`
+	// NextCursor is set by cursor paginated lists, empty on their last page
+	NextCursor string `json:"nextCursor,omitempty"`
 }
 
 // Paginate slices `items` according to page & limit.
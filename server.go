@@ -7,8 +7,12 @@ import (
 	"html/template"
 	"log"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"path"
+	"reflect"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
@@ -43,11 +47,35 @@ type Server struct {
 	allowedOrigins []string
 	muOrigins      sync.RWMutex
 	sessionClient  *session.Client
+	apiKeys        APIKeyStore
 
 	goCache         *goCache.Cache
 	SSLConfig       SSLConfig
 	healthCheckPath string
 	endpoints       []Endpoint
+	middlewares     []string
+	startedAt       time.Time
+	adminPrefix     string
+	flags           FlagStore
+	flagDefaults    map[string]bool
+	muFlags         sync.RWMutex
+	listeners       []ListenerSpec
+	addrs           []net.Addr
+	listenErr       error
+	muListeners     sync.Mutex
+	ready           chan struct{}
+	readyOnce       sync.Once
+	// accessConditions are checked after the RBAC roles grant access
+	accessConditions []AccessCondition
+	// RetryAfter is sent with 503 responses from disabled flags and maintenance mode
+	RetryAfter time.Duration
+	// MountPrefix is the path the router is reachable under behind a proxy, used
+	// for links in the docs pages. Defaults to the X-Forwarded-Prefix header of
+	// the trusted proxies of SetupClientIP.
+	MountPrefix string
+	clientIP    *ClientIPResolver
+	docs        DocsConfig
+	gateway     *gateway
 	//tp              *trace.TracerProvider
 	mr *metric.MeterProvider
 	//rootEnabled bool
@@ -72,8 +100,13 @@ func NewServer(serviceName string, r *rbac.Manager, domains []string, sessionCli
 		sessionClient:  sessionClient,
 		goCache:        goCache.New(time.Minute*5, time.Minute),
 		SSLConfig:      ssl,
+		startedAt:      time.Now(),
+		flags:          NewMemoryFlagStore(),
+		flagDefaults:   map[string]bool{},
+		RetryAfter:     defaultRetryAfter,
+		ready:          make(chan struct{}),
 	}
-	router.Use(s.corsMiddleware)
+	s.AddMiddleware(s.corsMiddleware, s.maintenanceMiddleware)
 	return s
 }
 
@@ -131,9 +164,17 @@ func (s *Server) matchOrigin(r *http.Request) (string, error) {
 func (s *Server) AddMiddleware(lists ...func(next http.Handler) http.Handler) {
 	for _, list := range lists {
 		s.router.Use(list)
+		s.middlewares = append(s.middlewares, middlewareName(list))
 	}
 }
 
+// middlewareName returns a short, human readable name for a middleware func,
+// e.g. "mserve.(*Server).corsMiddleware".
+func middlewareName(mw func(next http.Handler) http.Handler) string {
+	name := runtime.FuncForPC(reflect.ValueOf(mw).Pointer()).Name()
+	return path.Base(strings.TrimSuffix(name, "-fm"))
+}
+
 // AddOrigin dynamically adds a new CORS origin
 func (s *Server) AddOrigin(origin string) {
 	s.muOrigins.Lock()
@@ -193,6 +234,11 @@ func (s *Server) AddEndpoints(ctx context.Context, endpoints ...*Endpoint) error
 		}
 
 		handler := e.Handler
+		if e.FeatureFlag != "" {
+			s.DeclareFlag(e.FeatureFlag, !e.FeatureFlagOff)
+			handler = s.featureFlagHandler(e.FeatureFlag, handler)
+			e.middleware = append(e.middleware, "mserve.(*Server).featureFlagHandler")
+		}
 		err := e.Init(ctx, s.ServiceName, s.rbac)
 		if err != nil {
 			return err
@@ -202,11 +248,13 @@ func (s *Server) AddEndpoints(ctx context.Context, endpoints ...*Endpoint) error
 			s.router.
 				PathPrefix(e.Path).
 				HandlerFunc(handler).
-				Methods(m...)
+				Methods(m...).
+				Name(e.Name)
 		} else {
 			s.router.
 				HandleFunc(e.Path, handler).
-				Methods(m...)
+				Methods(m...).
+				Name(e.Name)
 		}
 		s.endpoints = append(s.endpoints, *e)
 	}
@@ -239,30 +287,40 @@ type SSLConfig struct {
 	DefaultHostName string
 }
 
-// Run starts the server with CertMagic and OpenTelemetry
+// Run starts the server on every registered listener, or on SSLConfig when
+// none were added, and blocks until ctx is done or a listener fails.
 func (s *Server) Run(ctx context.Context) error {
 	certmagic.DefaultACME.Agreed = s.SSLConfig.Agreed
 	certmagic.DefaultACME.Email = s.SSLConfig.Email
 	rootHandler := s.router
 	//rootHandler := otelhttp.NewHandler(s.router, "http-server")
-	go func() {
-		if !s.SSLConfig.Enabled {
-			if s.SSLConfig.Port <= 0 {
-				s.SSLConfig.Port = 8081
-			}
-			slog.Info("starting http server",
-				"host", "http://"+s.SSLConfig.DefaultHostName+":"+strconv.Itoa(s.SSLConfig.Port))
-			if err := http.ListenAndServe(":"+strconv.Itoa(s.SSLConfig.Port), rootHandler); err != nil {
-				log.Fatalf("failed to start https server: %v", err)
-			}
-			return
+	specs := s.listeners
+	if len(specs) == 0 {
+		if s.SSLConfig.Enabled {
+			go func() {
+				slog.Info("starting https server")
+				if err := certmagic.HTTPS(s.domains, rootHandler); err != nil {
+					log.Fatalf("CertMagic HTTPS failed: %v", err)
+				}
+			}()
+			s.readyOnce.Do(func() { close(s.ready) })
+			<-ctx.Done()
+			s.shutdown()
+			return nil
 		}
-		slog.Info("starting https server")
-		if err := certmagic.HTTPS(s.domains, rootHandler); err != nil {
-			log.Fatalf("CertMagic HTTPS failed: %v", err)
+		if s.SSLConfig.Port <= 0 {
+			s.SSLConfig.Port = 8081
 		}
-	}()
-	<-ctx.Done()
+		slog.Info("starting http server",
+			"host", "http://"+s.SSLConfig.DefaultHostName+":"+strconv.Itoa(s.SSLConfig.Port))
+		specs = []ListenerSpec{{Addr: ":" + strconv.Itoa(s.SSLConfig.Port)}}
+	}
+	err := s.serveListeners(ctx, rootHandler, specs)
+	s.shutdown()
+	return err
+}
+
+func (s *Server) shutdown() {
 	slog.Info("shutting down")
 	//if s.tp != nil {
 	//	_ = s.tp.Shutdown(context.Background())
@@ -270,7 +328,6 @@ func (s *Server) Run(ctx context.Context) error {
 	if s.mr != nil {
 		_ = s.mr.Shutdown(context.Background())
 	}
-	return nil
 }
 
 // HealthCheck registers a health check handler
@@ -292,25 +349,14 @@ func (s *Server) HealthCheck(path string, f func(ctx context.Context) error) *Se
 func (s *Server) Endpoints() []Endpoint {
 	return s.endpoints
 }
+
+// Handler returns the server's router, e.g. for use with httptest.NewServer.
+func (s *Server) Handler() http.Handler {
+	return s.router
+}
 func (s *Server) SetupOServer(ctx context.Context, o oserver.OServer) *Server {
 	handler := oserver.NewHandler(o, oserver.ContentTypeJSON)
-	//fix this resouce needs to be calculated dynamicly
-	s.AddMiddleware(func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			usersession, ctx, _ := s.sessionClient.Authenticate(w, r)
-			p := r.URL.Path
-			for k, v := range mux.Vars(r) {
-				p = strings.ReplaceAll(p, "/"+v, "/{"+k+"}")
-			}
-			if !s.hasAccess(ctx, endpointResourceName(s.ServiceName, p), usersession.UserID, usersession.AccountID, r.Method) {
-				slog.Error("forbidden", "user", usersession, "path", p, "resource", endpointResourceName(s.ServiceName, p))
-				http.Error(w, "forbidden "+p, http.StatusForbidden)
-				return
-			}
-			next.ServeHTTP(w, r.WithContext(ctx))
-
-		})
-	})
+	s.SetupAccessControl()
 	err := s.AddEndpoints(ctx, makeEndpoints(handler)...)
 
 	if err != nil {
@@ -320,6 +366,39 @@ func (s *Server) SetupOServer(ctx context.Context, o oserver.OServer) *Server {
 	return s
 }
 
+// SetupAccessControl authenticates every request through the session client and
+// rejects it unless the user's roles grant access to the endpoint's RBAC resource.
+func (s *Server) SetupAccessControl() *Server {
+	s.AddMiddleware(s.accessMiddleware)
+	return s
+}
+
+func (s *Server) accessMiddleware(next http.Handler) http.Handler {
+	//fix this resouce needs to be calculated dynamicly
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.gateway.proxies(mux.CurrentRoute(r)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		usersession, ctx, err := s.authenticate(w, r)
+		if err != nil {
+			slog.InfoContext(ctx, "unauthorized", "path", r.URL.Path, "err", err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		p := r.URL.Path
+		for k, v := range mux.Vars(r) {
+			p = strings.ReplaceAll(p, "/"+v, "/{"+k+"}")
+		}
+		if !s.hasAccess(ctx, endpointResourceName(s.ServiceName, p), usersession.UserID, usersession.AccountID, r.Method) {
+			slog.ErrorContext(ctx, "forbidden", "user", usersession, "path", p, "resource", endpointResourceName(s.ServiceName, p))
+			http.Error(w, "forbidden "+p, http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 func (s *Server) SetupSlog(level slog.Level) *Server {
 	opts := &slog.HandlerOptions{
 		Level: level, // reads the value each log call
@@ -352,10 +431,50 @@ func (s *Server) SetupOClient(o oclient.OAuthService) *Server {
 	return s
 }
 
+// AccessRequest is the access check passed to conditions added with AddAccessCondition.
+type AccessRequest struct {
+	Resource  string
+	UserID    string
+	AccountID string
+	Method    string
+	// Client is the resolved client IP and geo data, nil without SetupClientIP
+	Client *ClientInfo
+}
+
+// AccessCondition further restricts a request the RBAC roles already allow,
+// e.g. by client network or country. Conditions are evaluated on every request.
+type AccessCondition func(ctx context.Context, req AccessRequest) bool
+
+// AddAccessCondition adds conditions that must all hold for hasAccess to pass.
+func (s *Server) AddAccessCondition(conditions ...AccessCondition) *Server {
+	s.accessConditions = append(s.accessConditions, conditions...)
+	return s
+}
+
 func (s *Server) hasAccess(ctx context.Context, resource string, userId, accountId string, method string, scopes ...string) bool {
 	if endpointResourceName(s.ServiceName, s.healthCheckPath) == resource {
 		return true
 	}
+	if !s.hasRoleAccess(ctx, resource, userId, accountId, method) {
+		return false
+	}
+	req := AccessRequest{
+		Resource:  resource,
+		UserID:    userId,
+		AccountID: accountId,
+		Method:    method,
+		Client:    ClientInfoFromContext(ctx),
+	}
+	for _, condition := range s.accessConditions {
+		if !condition(ctx, req) {
+			slog.InfoContext(ctx, "access condition failed", "user_id", userId, "resource", resource)
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) hasRoleAccess(ctx context.Context, resource string, userId, accountId string, method string) bool {
 	k := resource + userId + accountId + method
 	hasAccess, ok := s.goCache.Get(k)
 	if ok {
@@ -377,19 +496,34 @@ func (s *Server) hasAccess(ctx context.Context, resource string, userId, account
 	return can
 }
 
-func (s *Server) GenerateOpenAPIDocs() *Server {
-	api, err := GenerateOpenAPI(s, s.endpoints)
+// GenerateOpenAPIDocs serves the generated OpenAPI document and Swagger UI. The
+// document is validated first: with WithStrictOpenAPI an invalid document
+// panics, otherwise the diagnostics report is logged.
+func (s *Server) GenerateOpenAPIDocs(opts ...OpenAPIOption) *Server {
+	options := OpenAPIOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	api, err := GenerateOpenAPI(s, s.endpoints, opts...)
+	if err == nil {
+		err = ValidateOpenAPI(context.Background(), api)
+	}
 	if err != nil {
-		return s
+		if options.Strict {
+			panic(fmt.Sprintf("invalid OpenAPI document for %s:\n%v", s.ServiceName, err))
+		}
+		slog.Warn("invalid OpenAPI document", "service", s.ServiceName, "report", err.Error())
+		if api == nil {
+			return s
+		}
 	}
 
-	swaggerUITmpl := template.Must(template.New("swaggerUI").Parse(swaggerUIMasterTemplate))
-
+	_ = s.AddEndpoints(context.Background(), s.docsAssetsEndpoint())
 	_ = s.AddEndpoints(context.Background(), &Endpoint{
 		Name:        "OpenAPI",
 		Description: "",
 		Methods:     []string{"GET"},
-		Path:        "/openapi/v2.yaml",
+		Path:        docsSpecPath,
 		Handler: func(writer http.ResponseWriter, r *http.Request) {
 			if p := r.URL.Query().Get("prefix"); p != "" {
 				slog.Info("preix", "o", p)
@@ -400,14 +534,22 @@ func (s *Server) GenerateOpenAPIDocs() *Server {
 					}
 				}
 
-				a, err := GenerateOpenAPI(s, ep)
+				a, err := GenerateOpenAPI(s, ep, opts...)
 				if err == nil {
 					slog.Info("preix", "o", p, "l", len(ep))
-					Docs(writer, r, a, template.Must(template.New("swaggerUI").Parse(swaggerUIMasterTemplate)), p)
+					if s.gateway != nil {
+						a = filterOpenAPIPaths(s.gatewayDocument(r.Context(), a), p)
+					}
+					if !writeSpec(writer, r, a) {
+						s.renderDocsPage(writer, r, s.docsPage(r, a.Info.Title, p))
+					}
 					return
 				}
 			}
-			Docs(writer, r, api, swaggerUITmpl, "")
+			doc := s.gatewayDocument(r.Context(), api)
+			if !writeSpec(writer, r, doc) {
+				s.renderDocsPage(writer, r, s.docsPage(r, doc.Info.Title, ""))
+			}
 		},
 		Internal: false,
 		Request: Request{
@@ -415,7 +557,7 @@ func (s *Server) GenerateOpenAPIDocs() *Server {
 				"render": {
 					Default:  "",
 					Required: false,
-					Enum:     []string{"json", "yaml"},
+					Enum:     []string{"json", "yaml", "redoc"},
 				},
 				"prefix": {
 					Default:  "",
@@ -453,19 +595,46 @@ func (s *Server) GenerateOpenAPIDocs() *Server {
 						ep = append(ep, e)
 					}
 				}
-				a, err := GenerateOpenAPI(s, ep)
+				a, err := GenerateOpenAPI(s, ep, opts...)
 				if err == nil {
+					if s.gateway != nil {
+						a = filterOpenAPIPaths(s.gatewayDocument(r.Context(), a), p)
+					}
 					NuxtPlugin(w, r, a)
 					return
 				}
 			}
-			NuxtPlugin(w, r, api)
+			NuxtPlugin(w, r, s.gatewayDocument(r.Context(), api))
+		},
+	})
+	_ = s.AddEndpoints(context.Background(), &Endpoint{
+		Name:        "Nuxt Module",
+		Description: "Typed Nuxt 3 module with composables and session handling, as a zip archive",
+		Methods:     []string{"GET"},
+		Path:        "/openapi/nuxt/module",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			NuxtModule(w, r, s.gatewayDocument(r.Context(), api))
 		},
 	})
 
 	return s
 }
 
+// NuxtModule writes the Nuxt module generated for api as a zip archive.
+func NuxtModule(w http.ResponseWriter, r *http.Request, api *openapi3.T) {
+	module, err := nuxt3FromOpenApi.GenerateNuxt3ModuleFromSpec(api)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	name := nuxt3FromOpenApi.ToKebabCase(strings.TrimSuffix(api.Info.Title, " API")) + "-api"
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.zip"`)
+	if err := module.WriteZip(w, name); err != nil {
+		slog.Error("Error writing Nuxt module", "err", err)
+	}
+}
+
 func NuxtPlugin(w http.ResponseWriter, r *http.Request, api *openapi3.T) {
 	d, err := api.MarshalYAML()
 	if err != nil {
@@ -487,14 +656,24 @@ func NuxtPlugin(w http.ResponseWriter, r *http.Request, api *openapi3.T) {
 	_, _ = w.Write([]byte(resp))
 }
 
+// Docs writes api as JSON or YAML for render=json/yaml, and otherwise renders
+// the docs page for it with swaggerUITmpl (or ReDoc for render=redoc).
 func Docs(w http.ResponseWriter, r *http.Request, api *openapi3.T, swaggerUITmpl *template.Template, prefix string) {
-	renderUI := r.URL.Query().Get("render")
-	switch renderUI {
+	if writeSpec(w, r, api) {
+		return
+	}
+	s := &Server{docs: DocsConfig{SwaggerTemplate: swaggerUITmpl}}
+	s.renderDocsPage(w, r, s.docsPage(r, api.Info.Title, prefix))
+}
+
+// writeSpec writes api for render=json and render=yaml and reports whether it did.
+func writeSpec(w http.ResponseWriter, r *http.Request, api *openapi3.T) bool {
+	switch r.URL.Query().Get("render") {
 	case "json":
 		d, err := api.MarshalJSON()
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return true
 		}
 		w.Header().Set("Content-Type", "application/json")
 
@@ -503,16 +682,17 @@ func Docs(w http.ResponseWriter, r *http.Request, api *openapi3.T, swaggerUITmpl
 			http.Error(w, "Failed to write JSON: "+writeErr.Error(), http.StatusInternalServerError)
 			slog.Error("Error writing JSON", "err", writeErr)
 		}
+		return true
 	case "yaml":
 		d, err := api.MarshalYAML()
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return true
 		}
 		raw, err := yaml.Marshal(d)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return true
 		}
 		w.Header().Set("Content-Type", "application/x-yaml")
 		_, writeErr := w.Write(raw)
@@ -520,63 +700,11 @@ func Docs(w http.ResponseWriter, r *http.Request, api *openapi3.T, swaggerUITmpl
 			http.Error(w, "Failed to write YAML: "+writeErr.Error(), http.StatusInternalServerError)
 			slog.Error("Error writing YAML", "err", writeErr)
 		}
-	default:
-		// Serve Swagger UI HTML
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		data := struct {
-			OpenAPIYAMLURL string
-		}{
-			OpenAPIYAMLURL: "/openapi/v2.yaml?render=yaml" + "&prefix=" + prefix, // Swagger UI will fetch YAML from this path
-		}
-		if err := swaggerUITmpl.Execute(w, data); err != nil {
-			http.Error(w, "Failed to render Swagger UI: "+err.Error(), http.StatusInternalServerError)
-			slog.Error("Error writing Swagger UI", "err", err)
-		}
+		return true
 	}
+	return false
 }
 
-const swaggerUIMasterTemplate = `
-<!DOCTYPE html>
-<html lang="en">
-<head>
-    <meta charset="UTF-8">
-    <title>Swagger UI</title>
-    <link rel="stylesheet" type="text/css" href="https://cdnjs.cloudflare.com/ajax/libs/swagger-ui/5.17.4/swagger-ui.min.css" >
-    <link rel="icon" type="image/png" href="https://petstore.swagger.io/favicon-32x32.png" sizes="32x32" />
-    <link rel="icon" type="image/png" href="https://petstore.swagger.io/favicon-16x16.png" sizes="16x16" />
-    <style>
-        html { box-sizing: border-box; overflow: -moz-scrollbars-vertical; overflow-y: scroll; }
-        *, *:before, *:after { box-sizing: inherit; }
-        body { margin:0; background: #fafafa; }
-    </style>
-</head>
-<body>
-    <div id="swagger-ui"></div>
-    <script src="https://cdnjs.cloudflare.com/ajax/libs/swagger-ui/5.17.4/swagger-ui-bundle.min.js"></script>
-    <script src="https://cdnjs.cloudflare.com/ajax/libs/swagger-ui/5.17.4/swagger-ui-standalone-preset.min.js"></script>
-    <script>
-        window.onload = function() {
-            // Begin Swagger UI call
-            const ui = SwaggerUIBundle({
-                url: "{{.OpenAPIYAMLURL}}", // Placeholder for your OpenAPI YAML endpoint
-                dom_id: '#swagger-ui',
-                deepLinking: true,
-                presets: [
-                    SwaggerUIBundle.presets.apis,
-                    SwaggerUIStandalonePreset
-                ],
-                plugins: [
-                    SwaggerUIBundle.plugins.DownloadUrl
-                ],
-                layout: "StandaloneLayout"
-            });
-            window.ui = ui;
-        };
-    </script>
-</body>
-</html>
-`
-
 type ErrorR struct {
 	Status    int    `json:"status"`
 	Error     string `json:"error"`
@@ -6,7 +6,8 @@ import (
 	"runtime/debug"
 )
 
-// stackHandler wraps any slog.Handler and injects a stack trace on Warn+.
+// stackHandler wraps any slog.Handler and injects a stack trace on Warn+. Records
+// logged with a request context also carry the resolved client IP and geo data.
 type stackHandler struct{ slog.Handler }
 
 func NewStackHandler(inner slog.Handler) slog.Handler {
@@ -21,6 +22,17 @@ func (h *stackHandler) Handle(ctx context.Context, r slog.Record) error {
 	if r.Level >= slog.LevelWarn {
 		r.AddAttrs(slog.String("stack", string(debug.Stack())))
 	}
+	if info := ClientInfoFromContext(ctx); info != nil {
+		r.AddAttrs(slog.String("client_ip", info.IP.String()))
+		if info.Geo != nil {
+			r.AddAttrs(slog.Group("geo",
+				slog.String("country", info.Geo.Country),
+				slog.String("city", info.Geo.City),
+				slog.Uint64("asn", uint64(info.Geo.ASN)),
+				slog.String("as_org", info.Geo.ASOrg),
+			))
+		}
+	}
 	return h.Handler.Handle(ctx, r)
 }
 